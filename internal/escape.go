@@ -0,0 +1,121 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/aymerick/raymond"
+	"github.com/aymerick/raymond/lexer"
+)
+
+// Escape modes for the output of {{value}} in templates
+const (
+	EscapeNone         = "none"
+	EscapeHTML         = "html"
+	EscapeShell        = "shell"
+	EscapeMarkdownCode = "markdown-code"
+)
+
+// escapeHelpers are the helpers escaping a value for each mode, they also escape single uses like {{escape_shell path}}
+var escapeHelpers = map[string]string{
+	EscapeNone:         "raw",
+	EscapeHTML:         "escape_html",
+	EscapeShell:        "escape_shell",
+	EscapeMarkdownCode: "markdown_code",
+}
+
+// ValidateEscapeMode checks that mode is a known escape mode, empty is none
+func ValidateEscapeMode(mode string) error {
+	if _, ok := escapeHelpers[mode]; !ok && mode != "" {
+		return fmt.Errorf("unsupported escape mode %q, expected none, html, shell or markdown-code", mode)
+	}
+	return nil
+}
+
+var openAmpRegex = regexp.MustCompile(`^\{\{~?&`)
+
+// applyEscapeMode rewrites each {{value}} of a template to {{helper (value)}}, so the helper of the mode escapes
+// the output instead of raymond's HTML escaping. {{{value}}} and {{&value}} stay unescaped.
+// Templates that don't lex are returned as they are, rendering reports the error
+func applyEscapeMode(template string, mode string) string {
+	if mode == EscapeHTML {
+		return template
+	}
+	helper, ok := escapeHelpers[mode]
+	if !ok {
+		helper = escapeHelpers[EscapeNone]
+	}
+
+	var result strings.Builder
+	last := 0
+	inMustache := false
+	for _, token := range lexer.Collect(template) {
+		switch token.Kind {
+		case lexer.TokenError:
+			return template
+		case lexer.TokenOpen:
+			if openAmpRegex.MatchString(token.Val) {
+				continue
+			}
+			end := token.Pos + len(token.Val)
+			result.WriteString(template[last:end])
+			result.WriteString(helper + " (")
+			last = end
+			inMustache = true
+		case lexer.TokenClose:
+			if !inMustache {
+				continue
+			}
+			result.WriteString(template[last:token.Pos])
+			result.WriteString(")")
+			last = token.Pos
+			inMustache = false
+		}
+	}
+	result.WriteString(template[last:])
+	return result.String()
+}
+
+// rawHelper outputs a value without escaping
+func rawHelper(value interface{}) raymond.SafeString {
+	return raymond.SafeString(raymond.Str(value))
+}
+
+// escapeHTMLHelper escapes a value for HTML
+func escapeHTMLHelper(value interface{}) raymond.SafeString {
+	return raymond.SafeString(raymond.Escape(raymond.Str(value)))
+}
+
+// escapeShellHelper quotes a value as a single shell word in single quotes, a quote in the value ends the quoting,
+// is escaped with a backslash and reopens the quoting
+func escapeShellHelper(value interface{}) raymond.SafeString {
+	return raymond.SafeString("'" + strings.ReplaceAll(raymond.Str(value), "'", `'\''`) + "'")
+}
+
+// markdownCodeHelper formats a value as Markdown code, an inline code span or a fenced block for multiple lines.
+// The fence is longer than any backtick run in the value, so the value can't end the code early
+func markdownCodeHelper(value interface{}) raymond.SafeString {
+	text := raymond.Str(value)
+
+	longest, run := 0, 0
+	for _, r := range text {
+		if r == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+
+	if strings.Contains(text, "\n") {
+		fence := strings.Repeat("`", max(3, longest+1))
+		return raymond.SafeString(fence + "\n" + strings.TrimSuffix(text, "\n") + "\n" + fence)
+	}
+
+	fence := strings.Repeat("`", longest+1)
+	if strings.HasPrefix(text, "`") || strings.HasSuffix(text, "`") {
+		text = " " + text + " "
+	}
+	return raymond.SafeString(fence + text + fence)
+}
@@ -0,0 +1,61 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestRenderTemplateEscapeModes(t *testing.T) {
+	values := map[string]interface{}{
+		"expr":    "a < b && c",
+		"path":    "it's here",
+		"snippet": "x := `y`",
+		"code":    "func main() {\n\t```\n}\n",
+		"items":   []string{"<a>", "b"},
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		template string
+		expected string
+	}{
+		{name: "none by default", template: "{{expr}}", expected: "a < b && c"},
+		{name: "none", mode: EscapeNone, template: "{{expr}} {{{expr}}} {{&expr}}", expected: "a < b && c a < b && c a < b && c"},
+		{name: "none in blocks", mode: EscapeNone, template: "{{#each items}}{{this}}{{/each}}", expected: "<a>b"},
+		{name: "none with whitespace control", mode: EscapeNone, template: "x  {{~expr~}}  y", expected: "xa < b && cy"},
+		{name: "none with helper output", mode: EscapeNone, template: `{{upper expr}} {{json items}}`, expected: `A < B && C ["<a>","b"]`},
+		{name: "html", mode: EscapeHTML, template: "{{expr}} {{{expr}}}", expected: "a &lt; b &amp;&amp; c a < b && c"},
+		{name: "shell", mode: EscapeShell, template: "cat {{path}}", expected: `cat 'it'\''s here'`},
+		{name: "markdown code span", mode: EscapeMarkdownCode, template: "Use {{snippet}}", expected: "Use `` x := `y` ``"},
+		{name: "markdown code block", mode: EscapeMarkdownCode, template: "{{code}}", expected: "````\nfunc main() {\n\t```\n}\n````"},
+		{name: "per-use helpers", template: "{{escape_html expr}} {{escape_shell path}} {{markdown_code expr}}", expected: "a &lt; b &amp;&amp; c 'it'\\''s here' `a < b && c`"},
+		{name: "raw in html mode", mode: EscapeHTML, template: "{{raw expr}}", expected: "a < b && c"},
+		{name: "literal braces", mode: EscapeShell, template: `\{{path}} {{path}}`, expected: `{{path}} 'it'\''s here'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateWithOptions(tt.template, values, RenderOptions{Escape: tt.mode})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestValidateEscapeMode(t *testing.T) {
+	for _, mode := range []string{"", EscapeNone, EscapeHTML, EscapeShell, EscapeMarkdownCode} {
+		if err := ValidateEscapeMode(mode); err != nil {
+			t.Errorf("Unexpected error for %q: %v", mode, err)
+		}
+	}
+	if err := ValidateEscapeMode("latex"); err == nil {
+		t.Error("Expected error for unknown escape mode")
+	}
+	if _, err := RenderTemplateWithOptions("{{x}}", nil, RenderOptions{Escape: "latex"}); err == nil {
+		t.Error("Expected render error for unknown escape mode")
+	}
+}
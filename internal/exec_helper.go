@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+)
+
+// Exec runs the commands of {{exec}} for a template
+type Exec interface {
+	// Run runs a command and returns its output
+	Run(command string) (string, error)
+}
+
+// execHelperName is the helper embedding the output of a command, e.g. {{exec "go list ./..."}}
+const execHelperName = "exec"
+
+// execPattern is the pattern reported for exec with a computed command, only commands the prompt declares can run
+const execPattern = "{{exec"
+
+// TemplateCommand is a command a template runs with {{exec}}
+type TemplateCommand struct {
+	Command string
+	Position
+}
+
+// FindCommands returns the commands a template runs with {{exec}} in order of appearance
+func FindCommands(template string) []TemplateCommand {
+	program, err := parseTemplate(template)
+	if err != nil {
+		return nil
+	}
+	return inspectTemplate(template, program).commands
+}
+
+// execHelper returns the exec helper running commands with runner, without one it fails
+func execHelper(runner Exec) func(command string) string {
+	return func(command string) string {
+		if runner == nil {
+			panic(fmt.Errorf("exec is not available"))
+		}
+
+		output, err := runner.Run(command)
+		if err != nil {
+			panic(fmt.Errorf("exec %q: %w", command, err))
+		}
+
+		// SECURITY: Limit the size of the command output in the prompt
+		checkHelperOutput("exec", len(output))
+
+		return output
+	}
+}
@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// fakeExec answers commands with fixed outputs, unknown commands fail
+type fakeExec map[string]string
+
+func (e fakeExec) Run(command string) (string, error) {
+	output, ok := e[command]
+	if !ok {
+		return "", fmt.Errorf("command is not listed")
+	}
+	return output, nil
+}
+
+func TestExecHelper(t *testing.T) {
+	runner := fakeExec{"go list ./...": "example.com/app\nexample.com/app/internal\n"}
+
+	tests := []struct {
+		name        string
+		template    string
+		runner      Exec
+		expected    string
+		expectError string
+	}{
+		{name: "exec", template: `Packages: {{exec "go list ./..."}}`, runner: runner, expected: "Packages: example.com/app\nexample.com/app/internal\n"},
+		{name: "output is not escaped", template: `{{exec "go list ./..."}}`, runner: fakeExec{"go list ./...": "<a & b>"}, expected: "<a & b>"},
+		{name: "failing command", template: `{{exec "rm -rf /"}}`, runner: runner, expectError: `exec "rm -rf /": command is not listed`},
+		{name: "without exec", template: `{{exec "go list ./..."}}`, expectError: "exec is not available"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateWithOptions(tt.template, nil, RenderOptions{Exec: tt.runner})
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestFindCommands(t *testing.T) {
+	commands := FindCommands("Packages:\n{{exec \"go list ./...\"}}\n{{#if tests}}{{exec \"go test ./...\"}}{{/if}}")
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %v", commands)
+	}
+	if commands[0].Command != "go list ./..." || commands[0].Line != 2 || commands[0].Column != 1 {
+		t.Errorf("Unexpected first command %+v", commands[0])
+	}
+	if commands[1].Command != "go test ./..." || commands[1].Line != 3 {
+		t.Errorf("Unexpected second command %+v", commands[1])
+	}
+
+	// Computed commands can't be checked against the declared commands
+	issues := FindDangerousPatterns(`{{exec command}}`)
+	if len(issues) != 1 || issues[0].Pattern != "{{exec" {
+		t.Errorf("Expected a computed command issue, got %v", issues)
+	}
+	if err := validateTemplate(`{{exec (lookup commands 0)}}`, nil); err == nil {
+		t.Error("Expected a computed command to fail validation")
+	}
+}
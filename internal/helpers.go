@@ -0,0 +1,270 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aymerick/raymond"
+)
+
+// maxOutputSize is the maximum size of a rendered template, helpers never produce more than that
+const maxOutputSize = 10 * 1024 * 1024 // 10MB
+
+// maxIndent is the maximum number of spaces for the indent helper
+const maxIndent = 100
+
+// now returns the current time for the date helper, replaced in tests
+var now = time.Now
+
+// customHelpers are the helpers registered by RegisterHelpers
+var customHelpers = map[string]interface{}{
+	"split":    splitHelper,
+	"eq":       eqHelper,
+	"ne":       neHelper,
+	"and":      andHelper,
+	"or":       orHelper,
+	"not":      notHelper,
+	"upper":    upperHelper,
+	"lower":    lowerHelper,
+	"trim":     trimHelper,
+	"replace":  replaceHelper,
+	"join":     joinHelper,
+	"indent":   indentHelper,
+	"default":  defaultHelper,
+	"truncate": truncateHelper,
+	"json":     jsonHelper,
+	"date":     dateHelper,
+
+	// Escaping, see escape.go
+	"raw":           rawHelper,
+	"escape_html":   escapeHTMLHelper,
+	"escape_shell":  escapeShellHelper,
+	"markdown_code": markdownCodeHelper,
+}
+
+// splitHelper splits a string by separator into trimmed, non-empty parts
+func splitHelper(str string, separator string) []string {
+	if str == "" {
+		return []string{}
+	}
+	parts := strings.Split(str, separator)
+	var result []string
+	for _, part := range parts {
+		if trimmed := strings.TrimSpace(part); trimmed != "" {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// eqHelper reports if two values are equal as strings, e.g. {{#if (eq framework "gin")}}
+func eqHelper(a, b interface{}) bool {
+	return raymond.Str(a) == raymond.Str(b)
+}
+
+// neHelper reports if two values differ as strings
+func neHelper(a, b interface{}) bool {
+	return raymond.Str(a) != raymond.Str(b)
+}
+
+// andHelper reports if both values are truthy, e.g. {{#if (and tests (not legacy))}}
+func andHelper(a, b interface{}) bool {
+	return raymond.IsTrue(a) && raymond.IsTrue(b)
+}
+
+// orHelper reports if one of the values is truthy
+func orHelper(a, b interface{}) bool {
+	return raymond.IsTrue(a) || raymond.IsTrue(b)
+}
+
+// notHelper reports if a value is falsy
+func notHelper(a interface{}) bool {
+	return !raymond.IsTrue(a)
+}
+
+// upperHelper converts a string to upper case
+func upperHelper(str string) string {
+	return strings.ToUpper(str)
+}
+
+// lowerHelper converts a string to lower case
+func lowerHelper(str string) string {
+	return strings.ToLower(str)
+}
+
+// trimHelper removes leading and trailing whitespace
+func trimHelper(str string) string {
+	return strings.TrimSpace(str)
+}
+
+// replaceHelper replaces all occurrences of old with replacement
+func replaceHelper(str, old, replacement string) string {
+	if old == "" {
+		return str
+	}
+
+	// SECURITY: Check the result size before building it
+	size := len(str) + strings.Count(str, old)*(len(replacement)-len(old))
+	checkHelperOutput("replace", size)
+
+	return strings.ReplaceAll(str, old, replacement)
+}
+
+// joinHelper joins the items of a list with a separator, e.g. {{join modules ", "}}
+func joinHelper(list interface{}, separator string) string {
+	value := reflect.ValueOf(list)
+	if value.Kind() != reflect.Slice && value.Kind() != reflect.Array {
+		return raymond.Str(list)
+	}
+
+	items := make([]string, value.Len())
+	size := 0
+	for i := range items {
+		items[i] = raymond.Str(value.Index(i).Interface())
+		size += len(items[i]) + len(separator)
+
+		// SECURITY: Check the result size while building it
+		checkHelperOutput("join", size)
+	}
+	return strings.Join(items, separator)
+}
+
+// indentHelper indents every non-empty line by a number of spaces, e.g. {{indent snippet 4}}
+func indentHelper(str string, spaces interface{}) string {
+	count, err := helperInt(spaces)
+	if err != nil || count < 0 || count > maxIndent {
+		panic(fmt.Errorf("indent needs a number of spaces between 0 and %d, got %v", maxIndent, spaces))
+	}
+
+	prefix := strings.Repeat(" ", count)
+	lines := strings.Split(str, "\n")
+
+	// SECURITY: Check the result size before building it
+	checkHelperOutput("indent", len(str)+len(lines)*count)
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// defaultHelper returns the value, or the fallback if the value is empty, e.g. {{default branch "main"}}.
+// False and zero are values, only missing values, empty strings, lists and maps are empty
+func defaultHelper(value, fallback interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.String:
+		if strings.TrimSpace(v.String()) == "" {
+			return fallback
+		}
+	case reflect.Slice, reflect.Map, reflect.Array:
+		if v.Len() == 0 {
+			return fallback
+		}
+	}
+	return value
+}
+
+// truncateHelper shortens a string to at most length characters, marking the cut with "..."
+func truncateHelper(str string, length interface{}) string {
+	limit, err := helperInt(length)
+	if err != nil || limit < 0 {
+		panic(fmt.Errorf("truncate needs a positive length, got %v", length))
+	}
+
+	runes := []rune(str)
+	if len(runes) <= limit {
+		return str
+	}
+	return string(runes[:limit]) + "..."
+}
+
+// jsonHelper encodes a value as JSON, e.g. {{json services}}. Characters like < are kept, prompts are not HTML
+func jsonHelper(value interface{}) raymond.SafeString {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		panic(fmt.Errorf("json: %w", err))
+	}
+	encoded := bytes.TrimSuffix(buffer.Bytes(), []byte("\n"))
+
+	// SECURITY: Limit the size of the encoded value
+	checkHelperOutput("json", len(encoded))
+
+	return raymond.SafeString(encoded)
+}
+
+// dateLayouts are the named layouts of the date helper, other formats are Go layouts like "Jan 2, 2006"
+var dateLayouts = map[string]string{
+	"date":     "2006-01-02",
+	"datetime": "2006-01-02 15:04",
+	"time":     "15:04",
+	"year":     "2006",
+	"rfc3339":  time.RFC3339,
+}
+
+// dateHelper formats the current date, or the date given as value=, e.g. {{date "date"}} or {{date "Jan 2, 2006" value=released}}
+func dateHelper(format string, options *raymond.Options) string {
+	layout, ok := dateLayouts[format]
+	if !ok {
+		layout = format
+	}
+	if layout == "" {
+		layout = dateLayouts["date"]
+	}
+
+	date := now()
+	if value := options.HashProp("value"); value != nil {
+		parsed, err := parseHelperDate(raymond.Str(value))
+		if err != nil {
+			panic(err)
+		}
+		date = parsed
+	}
+	return date.Format(layout)
+}
+
+// parseHelperDate parses a date in RFC 3339 or YYYY-MM-DD format
+func parseHelperDate(value string) (time.Time, error) {
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if parsed, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return parsed, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("date: %q is not a date like 2006-01-02", value)
+}
+
+// helperInt converts a helper parameter to an int, numbers from templates are ints or strings from .var files
+func helperInt(value interface{}) (int, error) {
+	switch v := value.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == float64(int(v)) {
+			return int(v), nil
+		}
+	case string:
+		return strconv.Atoi(strings.TrimSpace(v))
+	}
+	return 0, fmt.Errorf("%v is not a whole number", value)
+}
+
+// checkHelperOutput aborts rendering if a helper would produce more than the output limit.
+// raymond turns the panic into a render error
+func checkHelperOutput(helper string, size int) {
+	if size > maxOutputSize {
+		panic(fmt.Errorf("%s output too large (%d bytes), maximum allowed is %d bytes", helper, size, maxOutputSize))
+	}
+}
@@ -0,0 +1,112 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHelpers(t *testing.T) {
+	now = func() time.Time { return time.Date(2025, 3, 7, 14, 30, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	values := map[string]interface{}{
+		"framework": "gin",
+		"tests":     true,
+		"legacy":    false,
+		"count":     0,
+		"name":      "  Hello World  ",
+		"modules":   []string{"api", "web"},
+		"empty":     "",
+		"snippet":   "func main() {\n\nreturn\n}",
+		"services":  []interface{}{map[string]interface{}{"name": "api"}},
+		"released":  "2024-12-24",
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+	}{
+		{name: "eq", template: `{{#if (eq framework "gin")}}gin{{else}}other{{/if}}`, expected: "gin"},
+		{name: "ne", template: `{{#if (ne framework "gin")}}other{{else}}gin{{/if}}`, expected: "gin"},
+		{name: "eq number", template: `{{#if (eq count 0)}}zero{{/if}}`, expected: "zero"},
+		{name: "and", template: `{{#if (and tests legacy)}}both{{else}}not both{{/if}}`, expected: "not both"},
+		{name: "or", template: `{{#if (or tests legacy)}}one{{/if}}`, expected: "one"},
+		{name: "not", template: `{{#if (and tests (not legacy))}}modern{{/if}}`, expected: "modern"},
+		{name: "upper", template: `{{upper framework}}`, expected: "GIN"},
+		{name: "lower", template: `{{lower "GIN"}}`, expected: "gin"},
+		{name: "trim", template: `[{{trim name}}]`, expected: "[Hello World]"},
+		{name: "replace", template: `{{replace (trim name) "World" "Go"}}`, expected: "Hello Go"},
+		{name: "join", template: `{{join modules ", "}}`, expected: "api, web"},
+		{name: "join split", template: `{{join (split "a, b,,c" ",") "|"}}`, expected: "a|b|c"},
+		{name: "indent", template: `{{indent snippet 2}}`, expected: "  func main() {\n\n  return\n  }"},
+		{name: "default empty", template: `{{default empty "main"}}`, expected: "main"},
+		{name: "default missing", template: `{{default missing "main"}}`, expected: "main"},
+		{name: "default value", template: `{{default framework "main"}}`, expected: "gin"},
+		{name: "default false", template: `{{default legacy true}}`, expected: "false"},
+		{name: "truncate", template: `{{truncate (trim name) 5}}`, expected: "Hello..."},
+		{name: "truncate short", template: `{{truncate framework 5}}`, expected: "gin"},
+		{name: "json", template: `{{json services}}`, expected: `[{"name":"api"}]`},
+		{name: "date named", template: `{{date "date"}}`, expected: "2025-03-07"},
+		{name: "date layout", template: `{{date "Jan 2, 2006"}}`, expected: "Mar 7, 2025"},
+		{name: "date value", template: `{{date "year" value=released}}`, expected: "2024"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateData(tt.template, values)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestHelperErrors(t *testing.T) {
+	big := strings.Repeat("a", 100*1024)
+
+	tests := []struct {
+		name        string
+		template    string
+		values      map[string]interface{}
+		expectError string
+	}{
+		{
+			name:        "replace output limit",
+			template:    `{{replace big "a" big}}`,
+			values:      map[string]interface{}{"big": big},
+			expectError: "replace output too large",
+		},
+		{
+			name:        "indent limit",
+			template:    `{{indent text 1000}}`,
+			values:      map[string]interface{}{"text": "x"},
+			expectError: "indent needs a number of spaces",
+		},
+		{
+			name:        "truncate length",
+			template:    `{{truncate text "many"}}`,
+			values:      map[string]interface{}{"text": "x"},
+			expectError: "truncate needs a positive length",
+		},
+		{
+			name:        "invalid date",
+			template:    `{{date "date" value=text}}`,
+			values:      map[string]interface{}{"text": "tomorrow"},
+			expectError: "is not a date",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := RenderTemplateData(tt.template, tt.values)
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
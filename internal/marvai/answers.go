@@ -0,0 +1,212 @@
+package marvai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// varEnvPrefix is the prefix of environment variables that answer wizard questions
+const varEnvPrefix = "MARVAI_VAR_"
+
+// WizardAnswers are wizard values supplied without prompting. In increasing priority:
+// MARVAI_VAR_<ID> environment variables, a values file and --set key=value flags
+type WizardAnswers struct {
+	Environ []string
+	Values  map[string]interface{}
+	Set     map[string]string
+}
+
+// NewWizardAnswers parses --set flags and loads the values file, environ is usually os.Environ()
+func NewWizardAnswers(fs afero.Fs, setFlags []string, valuesFile string, environ []string) (WizardAnswers, error) {
+	answers := WizardAnswers{
+		Environ: environ,
+		Set:     make(map[string]string),
+	}
+
+	for _, flag := range setFlags {
+		key, value, found := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if !found || !isValidVariableNameLocal(key) {
+			return WizardAnswers{}, fmt.Errorf("invalid --set %q, use --set id=value", flag)
+		}
+		answers.Set[key] = value
+	}
+
+	if valuesFile != "" {
+		values, err := loadValuesFile(fs, valuesFile)
+		if err != nil {
+			return WizardAnswers{}, err
+		}
+		answers.Values = values
+	}
+
+	return answers, nil
+}
+
+// loadValuesFile loads wizard values from a YAML file
+func loadValuesFile(fs afero.Fs, valuesFile string) (map[string]interface{}, error) {
+	// SECURITY: Prevent symlink attacks
+	if err := validateFileIsNotSymlink(fs, valuesFile); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	info, err := fs.Stat(valuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading values file: %w", err)
+	}
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if info.Size() > 1024*1024 { // 1MB limit
+		return nil, fmt.Errorf("values file too large (%d bytes), maximum allowed is 1MB", info.Size())
+	}
+
+	content, err := afero.ReadFile(fs, valuesFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading values file: %w", err)
+	}
+
+	var values map[string]interface{}
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("error parsing values file %s: %w", valuesFile, err)
+	}
+
+	return values, nil
+}
+
+// varEnvName returns the environment variable answering a wizard variable, e.g. MARVAI_VAR_TEST_FRAMEWORK for test-framework
+func varEnvName(id string) string {
+	return varEnvPrefix + strings.ToUpper(strings.ReplaceAll(id, "-", "_"))
+}
+
+// resolve returns the supplied values for the variables, converted to their types.
+// --set for an unknown variable is an error, values files and the environment may contain values for other prompts
+func (a WizardAnswers) resolve(fs afero.Fs, variables []WizardVariable) (map[string]interface{}, error) {
+	defined := make(map[string]bool)
+	for _, variable := range variables {
+		defined[variable.ID] = true
+	}
+	for key := range a.Set {
+		if !defined[key] {
+			return nil, fmt.Errorf("--set %s: the prompt has no variable %q", key, key)
+		}
+	}
+
+	env := make(map[string]string)
+	for _, entry := range a.Environ {
+		if key, value, found := strings.Cut(entry, "="); found && strings.HasPrefix(key, varEnvPrefix) {
+			env[key] = value
+		}
+	}
+
+	values := make(map[string]interface{})
+	for _, variable := range variables {
+		var value interface{}
+		var origin string
+		if setValue, ok := a.Set[variable.ID]; ok {
+			value, origin = setValue, "--set "+variable.ID
+		} else if fileValue, ok := a.Values[variable.ID]; ok {
+			value, origin = fileValue, "values file"
+		} else if envValue, ok := env[varEnvName(variable.ID)]; ok {
+			value, origin = envValue, varEnvName(variable.ID)
+		} else {
+			continue
+		}
+
+		parsed, err := parseVarValue(fs, variable, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for variable '%s' from %s: %w", variable.ID, origin, err)
+		}
+		values[variable.ID] = parsed
+	}
+
+	return values, nil
+}
+
+// runWizard collects the values for variables. Supplied answers are used without asking,
+// defaults fill in for variables without a prefilled value.
+// With yes the wizard never prompts: prefilled values are kept and missing required variables are an error
+func runWizard(fs afero.Fs, variables []WizardVariable, prefill map[string]interface{}, opts InstallOptions) (map[string]interface{}, error) {
+	answers, err := opts.Answers.resolve(fs, variables)
+	if err != nil {
+		return nil, err
+	}
+
+	prefill = newDefaultResolver(fs, opts).withDefaults(variables, prefill)
+
+	if opts.Yes {
+		return nonInteractiveValues(fs, variables, prefill, answers)
+	}
+
+	// Only ask for the variables without a supplied answer
+	return askOnTerminal(fs, variables, prefill, answers)
+}
+
+// nonInteractiveValues combines prefilled values and answers and fails with all missing required variables.
+// Variables skipped by their when condition are left out and never required
+func nonInteractiveValues(fs afero.Fs, variables []WizardVariable, prefill map[string]interface{}, answers map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	var missing []string
+
+	for _, variable := range variables {
+		asked, err := evaluateWhen(variable, values)
+		if err != nil {
+			return nil, err
+		}
+		if !asked {
+			continue
+		}
+
+		if value, ok := answers[variable.ID]; ok && !isEmptyVarValue(value) {
+			values[variable.ID] = value
+			continue
+		}
+		if existing, ok := prefill[variable.ID]; ok {
+			if parsed, err := parseVarValue(fs, variable, existing); err == nil && !isEmptyVarValue(parsed) {
+				values[variable.ID] = parsed
+				continue
+			}
+		}
+		if variable.Required {
+			missing = append(missing, variable.ID)
+			continue
+		}
+		if value := emptyVarValue(variable); value != nil {
+			values[variable.ID] = value
+		}
+	}
+
+	if len(missing) > 0 {
+		return nil, missingVariablesError(missing)
+	}
+
+	return values, nil
+}
+
+// missingVariablesError lists missing required variables and how to supply them
+func missingVariablesError(missing []string) error {
+	sort.Strings(missing)
+	var lines []string
+	for _, id := range missing {
+		lines = append(lines, fmt.Sprintf("  %s (--set %s=<value> or %s)", id, id, varEnvName(id)))
+	}
+	return fmt.Errorf("missing required variables:\n%s", strings.Join(lines, "\n"))
+}
+
+// confirm asks a yes/no question, with yes the question is answered without reading input
+func confirm(question string, yes bool) bool {
+	fmt.Printf("%s (yes/no) ", question)
+	if yes {
+		fmt.Println("yes")
+		return true
+	}
+
+	var response string
+	if _, err := fmt.Scanln(&response); err != nil {
+		fmt.Printf("Warning: failed to read input: %v\n", err)
+	}
+	return strings.ToLower(strings.TrimSpace(response)) == "yes"
+}
@@ -0,0 +1,136 @@
+package marvai
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestNewWizardAnswers(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "values.yaml", []byte("framework: gin\ncount: 3\n"), 0644); err != nil {
+		t.Fatalf("Failed to write values file: %v", err)
+	}
+
+	answers, err := NewWizardAnswers(fs, []string{"name=a=b", "empty="}, "values.yaml", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if answers.Set["name"] != "a=b" || answers.Set["empty"] != "" {
+		t.Errorf("Unexpected --set values: %v", answers.Set)
+	}
+	if answers.Values["framework"] != "gin" || answers.Values["count"] != 3 {
+		t.Errorf("Unexpected file values: %v", answers.Values)
+	}
+
+	for _, flag := range []string{"novalue", "=value", "bad id=value"} {
+		if _, err := NewWizardAnswers(fs, []string{flag}, "", nil); err == nil {
+			t.Errorf("Expected error for --set %q", flag)
+		}
+	}
+
+	if _, err := NewWizardAnswers(fs, nil, "missing.yaml", nil); err == nil {
+		t.Error("Expected error for missing values file")
+	}
+}
+
+func TestWizardAnswersResolve(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "framework", Type: "choice", Options: []string{"gin", "echo"}},
+		{ID: "test-count", Type: "int"},
+		{ID: "lint", Type: "bool"},
+		{ID: "name"},
+	}
+
+	answers := WizardAnswers{
+		Environ: []string{"MARVAI_VAR_FRAMEWORK=echo", "MARVAI_VAR_TEST_COUNT=5", "MARVAI_VAR_LINT=yes", "MARVAI_VAR_OTHER=x", "PATH=/bin"},
+		Values:  map[string]interface{}{"test-count": 7, "other-prompt": "ignored"},
+		Set:     map[string]string{"framework": "gin"},
+	}
+
+	values, err := answers.resolve(afero.NewMemMapFs(), variables)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]interface{}{"framework": "gin", "test-count": 7, "lint": true}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+
+	if _, err := (WizardAnswers{Set: map[string]string{"unknown": "x"}}).resolve(afero.NewMemMapFs(), variables); err == nil {
+		t.Error("Expected error for --set of unknown variable")
+	}
+
+	_, err = (WizardAnswers{Environ: []string{"MARVAI_VAR_TEST_COUNT=many"}}).resolve(afero.NewMemMapFs(), variables)
+	if err == nil || !strings.Contains(err.Error(), "MARVAI_VAR_TEST_COUNT") {
+		t.Errorf("Expected error naming the environment variable, got %v", err)
+	}
+}
+
+func TestRunWizardNonInteractive(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "language", Required: true},
+		{ID: "framework", Required: true},
+		{ID: "style", Required: true},
+		{ID: "notes"},
+		{ID: "retries", Type: "int"},
+	}
+	opts := InstallOptions{
+		Yes:     true,
+		Answers: WizardAnswers{Set: map[string]string{"language": "Go"}},
+	}
+
+	_, err := runWizard(afero.NewMemMapFs(), variables, nil, opts)
+	if err == nil {
+		t.Fatal("Expected error for missing required variables")
+	}
+	for _, expected := range []string{"framework (--set framework=<value> or MARVAI_VAR_FRAMEWORK)", "style"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected error to contain %q, got %v", expected, err)
+		}
+	}
+
+	prefill := map[string]interface{}{"framework": "gin", "style": "short"}
+	values, err := runWizard(afero.NewMemMapFs(), variables, prefill, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"language": "Go", "framework": "gin", "style": "short", "notes": ""}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestInstallMPromptContentNonInteractive(t *testing.T) {
+	content := "name: hello\n--\n- id: language\n  description: Language\n  required: true\n--\nHello in {{language}}"
+	data, err := ParseMPromptContent([]byte(content), "hello.mprompt")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	noLog := func(success bool) error { return nil }
+
+	fs := afero.NewMemMapFs()
+	err = installMPromptContent(fs, []byte(content), data, "hello", "file", InstallOptions{Yes: true}, noLog)
+	if err == nil || !strings.Contains(err.Error(), "missing required variables") {
+		t.Fatalf("Expected missing required variables error, got %v", err)
+	}
+	if exists, _ := afero.Exists(fs, ".marvai/hello.mprompt"); exists {
+		t.Error("No files should be written when required variables are missing")
+	}
+
+	opts := InstallOptions{Yes: true, Answers: WizardAnswers{Environ: []string{"MARVAI_VAR_LANGUAGE=Go"}}}
+	if err := installMPromptContent(fs, []byte(content), data, "hello", "file", opts, noLog); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	result, err := LoadPrompt(fs, "hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(result) != "Hello in Go" {
+		t.Errorf("Unexpected prompt: %q", result)
+	}
+}
@@ -0,0 +1,33 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// ApprovePromptWithOptions asks the user to allow the commands an installed prompt runs with {{exec}},
+// the approval holds until the prompt version or its commands change
+func ApprovePromptWithOptions(fs afero.Fs, promptName string, opts InstallOptions, w io.Writer) error {
+	data, _, err := loadInstalledPrompt(fs, promptName)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Frontmatter.Commands) == 0 {
+		fmt.Fprintf(w, "Prompt '%s' runs no commands\n", promptName)
+		return nil
+	}
+
+	approved, err := approveCommands(fs, opts.homeDir(), promptName, data, opts.ApproveCommands)
+	if err != nil {
+		return err
+	}
+	if !approved {
+		fmt.Fprintf(w, "Commands not approved.\n")
+		return nil
+	}
+	fmt.Fprintf(w, "Commands of '%s' approved\n", promptName)
+	return nil
+}
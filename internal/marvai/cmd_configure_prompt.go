@@ -0,0 +1,124 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigurePrompt re-runs the wizard of an installed prompt prefilled with its current values
+func ConfigurePrompt(fs afero.Fs, promptName string) error {
+	return ConfigurePromptWithOptions(fs, promptName, InstallOptions{}, os.Stdout)
+}
+
+// ConfigurePromptWithOptions re-runs the wizard of an installed prompt, prints the changed values to w
+// and saves the .var file atomically
+func ConfigurePromptWithOptions(fs afero.Fs, promptName string, opts InstallOptions, w io.Writer) error {
+	data, varFile, err := loadInstalledPrompt(fs, promptName)
+	if err != nil {
+		return err
+	}
+
+	if len(data.Variables) == 0 {
+		fmt.Fprintf(w, "Prompt '%s' has no variables to configure\n", promptName)
+		return nil
+	}
+
+	// Load the current values, a broken .var file must not be overwritten silently
+	existingValues := make(map[string]interface{})
+	varExists, err := afero.Exists(fs, varFile)
+	if err != nil {
+		return fmt.Errorf("error checking .var file: %w", err)
+	}
+	if varExists {
+		existingValues, err = loadVarValues(fs, varFile)
+		if err != nil {
+			return fmt.Errorf("error parsing .var file %s: %w", varFile, err)
+		}
+		if existingValues == nil {
+			existingValues = make(map[string]interface{})
+		}
+	}
+
+	// Secrets are compared and prefilled with their values, the .var file keeps the references
+	storedValues := existingValues
+	existingValues = prefillWithSecrets(fs, opts, data.Variables, storedValues)
+
+	values, err := runWizard(fs, data.Variables, existingValues, opts)
+	if err != nil {
+		return err
+	}
+
+	// Values for variables the prompt doesn't define are kept as they are,
+	// variables skipped by their when condition are removed
+	newValues := make(map[string]interface{}, len(existingValues))
+	for key, value := range existingValues {
+		newValues[key] = value
+	}
+	for _, variable := range data.Variables {
+		delete(newValues, variable.ID)
+	}
+	for key, value := range values {
+		newValues[key] = value
+	}
+
+	changes := 0
+	for _, variable := range data.Variables {
+		oldValue, hadValue := existingValues[variable.ID]
+		if hadValue {
+			if parsed, err := parseVarValue(fs, variable, oldValue); err == nil {
+				oldValue = parsed
+			}
+		}
+		newValue, hasValue := newValues[variable.ID]
+		if hadValue == hasValue && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+
+		if changes == 0 {
+			fmt.Fprintf(w, "\nChanged values:\n")
+		}
+		changes++
+
+		oldText := "(not set)"
+		if hadValue {
+			oldText = displayVarValue(variable, oldValue)
+		}
+		newText := "(not set)"
+		if hasValue {
+			newText = displayVarValue(variable, newValue)
+		}
+		fmt.Fprintf(w, "  %s: %s -> %s\n", variable.ID, oldText, newText)
+	}
+
+	if changes == 0 && varExists {
+		fmt.Fprintf(w, "No changes to prompt '%s'\n", promptName)
+		return nil
+	}
+
+	newValues, err = storeSecrets(fs, opts, data.Variables, newValues, storedValues)
+	if err != nil {
+		return err
+	}
+
+	varData, err := yaml.Marshal(newValues)
+	if err != nil {
+		return fmt.Errorf("error marshaling wizard answers: %w", err)
+	}
+
+	// SECURITY: Never write through a symlink placed after the prompt was loaded
+	if err := validateFileIsNotSymlink(fs, varFile); err != nil {
+		return fmt.Errorf("security error: %w", err)
+	}
+
+	if err := writeFileAtomic(fs, varFile, varData, 0644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Saved configuration of prompt '%s' to %s\n", promptName, varFile)
+	return nil
+}
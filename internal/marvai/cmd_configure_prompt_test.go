@@ -0,0 +1,169 @@
+package marvai
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestConfigurePrompt(t *testing.T) {
+	mprompt := `name: review
+--
+- id: language
+  description: Language
+  required: true
+- id: strict
+  description: Strict review
+  type: bool
+- id: token
+  description: API token
+  type: secret
+--
+Review {{language}}`
+
+	tests := []struct {
+		name             string
+		varContent       string
+		set              map[string]string
+		expectedOutput   []string
+		expectedVar      []string
+		expectUnmodified bool
+		expectedError    string
+	}{
+		{
+			name:       "changed values are shown and saved",
+			varContent: "language: Go\nstrict: false\ntoken: old\nlegacy: kept\n",
+			set:        map[string]string{"language": "Rust", "token": "new"},
+			expectedOutput: []string{
+				"language: Go -> Rust",
+				"token: ******** -> ********",
+				"Saved configuration of prompt 'review'",
+			},
+			expectedVar: []string{"language: Rust", "strict: false", "token: secret:", "legacy: kept"},
+		},
+		{
+			name:             "no changes",
+			varContent:       "language: Go\nstrict: true\ntoken: abc\n",
+			set:              map[string]string{"language": "Go"},
+			expectedOutput:   []string{"No changes to prompt 'review'"},
+			expectUnmodified: true,
+		},
+		{
+			name:           "missing .var file",
+			set:            map[string]string{"language": "Go"},
+			expectedOutput: []string{"language: (not set) -> Go", "strict: (not set) -> no"},
+			expectedVar:    []string{"language: Go", "strict: false"},
+		},
+		{
+			name:             "broken .var file is not overwritten",
+			varContent:       "language: [broken",
+			expectedError:    "error parsing .var file",
+			expectUnmodified: true,
+		},
+		{
+			name:             "missing required value",
+			varContent:       "strict: true\n",
+			expectedError:    "missing required variables",
+			expectUnmodified: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if err := afero.WriteFile(fs, ".marvai/review.mprompt", []byte(mprompt), 0644); err != nil {
+				t.Fatalf("Failed to write .mprompt file: %v", err)
+			}
+			if tt.varContent != "" {
+				if err := afero.WriteFile(fs, ".marvai/review.var", []byte(tt.varContent), 0644); err != nil {
+					t.Fatalf("Failed to write .var file: %v", err)
+				}
+			}
+
+			var output bytes.Buffer
+			opts := InstallOptions{Yes: true, Answers: WizardAnswers{Set: tt.set}, HomeDir: "/home/user"}
+			err := ConfigurePromptWithOptions(fs, "review", opts, &output)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+			} else if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			for _, expected := range tt.expectedOutput {
+				if !strings.Contains(output.String(), expected) {
+					t.Errorf("Expected output containing %q, got:\n%s", expected, output.String())
+				}
+			}
+
+			content, _ := afero.ReadFile(fs, ".marvai/review.var")
+			if tt.expectUnmodified && string(content) != tt.varContent {
+				t.Errorf("Expected .var file to be unmodified, got:\n%s", content)
+			}
+			for _, expected := range tt.expectedVar {
+				if !strings.Contains(string(content), expected) {
+					t.Errorf("Expected .var file containing %q, got:\n%s", expected, content)
+				}
+			}
+			if strings.Contains(string(content), "token: new") {
+				t.Error("Secret must not be written to the .var file")
+			}
+			if exists, _ := afero.Exists(fs, ".marvai/review.var.tmp"); exists {
+				t.Error("Temporary file was not removed")
+			}
+		})
+	}
+}
+
+func TestConfigurePromptNotInstalled(t *testing.T) {
+	var output bytes.Buffer
+	if err := ConfigurePromptWithOptions(afero.NewMemMapFs(), "missing", InstallOptions{Yes: true}, &output); err == nil {
+		t.Error("Expected error for prompt that is not installed")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	fs := afero.NewOsFs()
+
+	file := filepath.Join(dir, "review.var")
+	if err := writeFileAtomic(fs, file, []byte("language: Go\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := writeFileAtomic(fs, file, []byte("language: Rust\n"), 0600); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(file)
+	if err != nil || string(content) != "language: Rust\n" {
+		t.Errorf("Expected replaced content, got %q (%v)", string(content), err)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v (%v)", info.Mode().Perm(), err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %v (%v)", entries, err)
+	}
+
+	// A symlinked destination is refused and its target is not changed
+	target := filepath.Join(dir, "target")
+	if err := os.WriteFile(target, []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to write target: %v", err)
+	}
+	link := filepath.Join(dir, "link.var")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := writeFileAtomic(fs, link, []byte("changed"), 0644); err == nil || !strings.Contains(err.Error(), "is a symbolic link") {
+		t.Errorf("Expected symbolic link error, got %v", err)
+	}
+	if content, _ := os.ReadFile(target); string(content) != "keep" {
+		t.Errorf("Expected target to be unchanged, got %q", string(content))
+	}
+}
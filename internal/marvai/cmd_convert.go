@@ -0,0 +1,62 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// ConvertMPromptFiles upgrades format 1 .mprompt files in place to format 2
+func ConvertMPromptFiles(fs afero.Fs, files []string, w io.Writer) error {
+	for _, file := range files {
+		// SECURITY: Never follow symlinks when rewriting files
+		if err := validateFileIsNotSymlink(fs, file); err != nil {
+			return err
+		}
+
+		info, err := fs.Stat(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		// SECURITY: Limit file size to prevent memory exhaustion
+		if info.Size() > 10*1024*1024 { // 10MB limit
+			return fmt.Errorf("mprompt file %s too large (%d bytes), maximum allowed is 10MB", file, info.Size())
+		}
+
+		content, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		if isMPromptV2(string(content)) {
+			if _, err := fmt.Fprintf(w, "%s: already format %d\n", file, MPromptFormatV2); err != nil {
+				return err
+			}
+			continue
+		}
+
+		sections := splitMPromptSectionsV1(string(content))
+		converted, err := ConvertMPromptToV2(content)
+		if err != nil {
+			return fmt.Errorf("error converting %s: %w", file, err)
+		}
+
+		// An interrupted conversion leaves the original intact
+		if err := writeFileAtomic(fs, file, converted, info.Mode().Perm()); err != nil {
+			return err
+		}
+
+		if _, err := fmt.Fprintf(w, "%s: converted to format %d\n", file, MPromptFormatV2); err != nil {
+			return err
+		}
+		for _, line := range sections.DroppedSeparators {
+			if _, err := fmt.Fprintf(w, "Warning: %s:%d: -- line was dropped from the template by format 1 and is not carried over\n", file, line); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
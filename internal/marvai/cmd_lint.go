@@ -0,0 +1,56 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/afero"
+)
+
+// LintMPromptFiles lints .mprompt files and prints diagnostics as file:line:column: severity: message
+func LintMPromptFiles(fs afero.Fs, files []string, w io.Writer) error {
+	errorCount := 0
+	warningCount := 0
+
+	for _, file := range files {
+		info, err := fs.Stat(file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		// SECURITY: Limit file size to prevent memory exhaustion
+		if info.Size() > 10*1024*1024 { // 10MB limit
+			return fmt.Errorf("mprompt file %s too large (%d bytes), maximum allowed is 10MB", file, info.Size())
+		}
+
+		content, err := afero.ReadFile(fs, file)
+		if err != nil {
+			return fmt.Errorf("error reading %s: %w", file, err)
+		}
+
+		diagnostics := LintMPromptContent(content)
+		if len(diagnostics) == 0 {
+			if _, err := fmt.Fprintf(w, "%s: no problems found\n", file); err != nil {
+				return err
+			}
+			continue
+		}
+
+		for _, diagnostic := range diagnostics {
+			if diagnostic.Severity == LintError {
+				errorCount++
+			} else {
+				warningCount++
+			}
+			if _, err := fmt.Fprintf(w, "%s:%s\n", file, diagnostic); err != nil {
+				return err
+			}
+		}
+	}
+
+	if errorCount > 0 {
+		return fmt.Errorf("found %d error(s) and %d warning(s)", errorCount, warningCount)
+	}
+
+	return nil
+}
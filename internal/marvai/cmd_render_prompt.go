@@ -0,0 +1,138 @@
+package marvai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// RenderPromptOptions are the options for rendering a prompt without running an agent
+type RenderPromptOptions struct {
+	PromptOptions
+
+	// Output is the file to write the prompt to, empty writes it to stdout
+	Output string
+	// Diff shows the changes since the last render instead of the prompt
+	Diff bool
+	// ShowSecrets shows the values of secret variables instead of redacting them
+	ShowSecrets bool
+}
+
+// RenderPrompt templates an installed prompt like running it would and writes it to stdout or the output file.
+// Secret values are redacted unless ShowSecrets is set. The render is kept, redacted, for the next --diff
+func RenderPrompt(fs afero.Fs, promptName string, opts RenderPromptOptions, stdout, stderr io.Writer) error {
+	if opts.Diff && opts.Output != "" {
+		return fmt.Errorf("--diff and --output can't be used together")
+	}
+
+	prompt, err := renderPrompt(fs, promptName, opts.PromptOptions)
+	if err != nil {
+		return err
+	}
+
+	redacted := prompt.redacted()
+	content := redacted
+	if opts.ShowSecrets {
+		content = prompt.Content
+	}
+
+	lastFile := lastRenderFile(opts.HomeDir, promptName)
+
+	switch {
+	case opts.Diff:
+		if lastFile == "" {
+			return fmt.Errorf("--diff needs a home directory to keep the last render")
+		}
+		last, found, err := readLastRender(fs, lastFile)
+		if err != nil {
+			return err
+		}
+		// Diffs always compare the redacted prompts, the kept render has no secrets
+		diff := unifiedDiff(last, redacted, "last render", "current render")
+		switch {
+		case !found:
+			fmt.Fprintf(stdout, "No previous render of '%s', showing the whole prompt as added\n%s", promptName, diff)
+		case diff == "":
+			fmt.Fprintf(stdout, "No changes since the last render of '%s'\n", promptName)
+		default:
+			fmt.Fprint(stdout, diff)
+		}
+
+	case opts.Output != "":
+		// SECURITY: Don't write through a symlink
+		if err := validateFileIsNotSymlink(fs, opts.Output); err != nil {
+			return fmt.Errorf("security error: %w", err)
+		}
+		perm := os.FileMode(0644)
+		if opts.ShowSecrets {
+			perm = 0600
+		}
+		if err := writeFileAtomic(fs, opts.Output, []byte(content), perm); err != nil {
+			return err
+		}
+		fmt.Fprintf(stdout, "Rendered '%s' to %s\n", promptName, opts.Output)
+
+	default:
+		if !strings.HasSuffix(content, "\n") {
+			content += "\n"
+		}
+		if _, err := io.WriteString(stdout, content); err != nil {
+			return fmt.Errorf("error writing prompt: %w", err)
+		}
+	}
+
+	if lastFile != "" {
+		if err := saveLastRender(fs, lastFile, redacted); err != nil {
+			fmt.Fprintf(stderr, "Warning: failed to keep the render for --diff: %v\n", err)
+		}
+	}
+	return nil
+}
+
+// lastRenderFile returns the file keeping the last render of a prompt in the current project, empty without
+// a home directory. Renders live in the user's config directory so they are never committed
+func lastRenderFile(homeDir, promptName string) string {
+	if homeDir == "" {
+		return ""
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	project := sha256.Sum256([]byte(cwd))
+	return filepath.Join(userConfigDir(homeDir), "renders", hex.EncodeToString(project[:8]), promptName+".md")
+}
+
+// readLastRender reads the last render of a prompt and reports if there is one
+func readLastRender(fs afero.Fs, lastFile string) (string, bool, error) {
+	// SECURITY: Prevent symlink attacks by checking if the file is a symlink
+	if err := validateFileIsNotSymlink(fs, lastFile); err != nil {
+		return "", false, fmt.Errorf("security error: %w", err)
+	}
+	content, err := afero.ReadFile(fs, lastFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", false, nil
+		}
+		return "", false, fmt.Errorf("error reading last render: %w", err)
+	}
+	return string(content), true, nil
+}
+
+// saveLastRender keeps a render for the next --diff
+func saveLastRender(fs afero.Fs, lastFile string, content string) error {
+	if err := fs.MkdirAll(filepath.Dir(lastFile), 0700); err != nil {
+		return fmt.Errorf("error creating %s: %w", filepath.Dir(lastFile), err)
+	}
+	// SECURITY: Prevent symlink attacks by checking if the file is a symlink
+	if err := validateFileIsNotSymlink(fs, lastFile); err != nil {
+		return fmt.Errorf("security error: %w", err)
+	}
+	return writeFileAtomic(fs, lastFile, []byte(content), 0600)
+}
@@ -0,0 +1,144 @@
+package marvai
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestRenderPrompt(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	mprompt := `name: Deploy
+--
+- id: target
+  description: Target
+- id: token
+  description: Token
+  type: secret
+--
+Deploy to {{target}} with {{token}} using {{marvai.agent}}.`
+	if err := afero.WriteFile(fs, ".marvai/deploy.mprompt", []byte(mprompt), 0644); err != nil {
+		t.Fatalf("Failed to write .mprompt file: %v", err)
+	}
+
+	opts := RenderPromptOptions{PromptOptions: PromptOptions{
+		HomeDir:   "/home/user",
+		Agent:     "gemini",
+		Overrides: map[string]string{"target": "staging", "token": "s3cr3t-token"},
+	}}
+
+	// Secrets are redacted unless asked for
+	var stdout, stderr bytes.Buffer
+	if err := RenderPrompt(fs, "deploy", opts, &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Deploy to staging with ******** using gemini.\n"; stdout.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, stdout.String())
+	}
+
+	shown := opts
+	shown.ShowSecrets = true
+	shown.Output = "prompt.md"
+	stdout.Reset()
+	if err := RenderPrompt(fs, "deploy", shown, &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := afero.ReadFile(fs, "prompt.md")
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if expected := "Deploy to staging with s3cr3t-token using gemini."; string(content) != expected {
+		t.Errorf("Expected %q in output file, got %q", expected, string(content))
+	}
+
+	// The diff compares with the last render
+	diff := opts
+	diff.Diff = true
+	stdout.Reset()
+	if err := RenderPrompt(fs, "deploy", diff, &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "No changes since the last render") {
+		t.Errorf("Expected no changes, got %q", stdout.String())
+	}
+
+	diff.Overrides = map[string]string{"target": "production", "token": "s3cr3t-token"}
+	stdout.Reset()
+	if err := RenderPrompt(fs, "deploy", diff, &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, expected := range []string{
+		"-Deploy to staging with ******** using gemini.",
+		"+Deploy to production with ******** using gemini.",
+	} {
+		if !strings.Contains(stdout.String(), expected) {
+			t.Errorf("Expected diff containing %q, got %q", expected, stdout.String())
+		}
+	}
+	if strings.Contains(stdout.String(), "s3cr3t-token") {
+		t.Errorf("Expected secrets to be redacted in the diff, got %q", stdout.String())
+	}
+
+	// Without a previous render the whole prompt is new
+	stdout.Reset()
+	diff.HomeDir = "/home/other"
+	if err := RenderPrompt(fs, "deploy", diff, &stdout, &stderr); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "No previous render") || !strings.Contains(stdout.String(), "+Deploy to production") {
+		t.Errorf("Expected the whole prompt as added, got %q", stdout.String())
+	}
+
+	diff.Output = "prompt.md"
+	if err := RenderPrompt(fs, "deploy", diff, &stdout, &stderr); err == nil {
+		t.Error("Expected error for --diff with --output")
+	}
+	if stderr.Len() > 0 {
+		t.Errorf("Unexpected warnings: %q", stderr.String())
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{name: "equal", from: "a\nb\n", to: "a\nb\n", expected: ""},
+		{
+			name:     "changed line",
+			from:     "a\nb\nc\n",
+			to:       "a\nx\nc\n",
+			expected: "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+x\n c\n",
+		},
+		{
+			name:     "added to empty",
+			from:     "",
+			to:       "a\nb",
+			expected: "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "separate hunks",
+			from:     "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n",
+			to:       "0\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n13\n",
+			expected: "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+0\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+13\n",
+		},
+		{
+			name:     "close changes share a hunk",
+			from:     "1\n2\n3\n4\n5\n",
+			to:       "0\n2\n3\n4\n6\n",
+			expected: "--- old\n+++ new\n@@ -1,5 +1,5 @@\n-1\n+0\n 2\n 3\n 4\n-5\n+6\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := unifiedDiff(tt.from, tt.to, "old", "new"); result != tt.expected {
+				t.Errorf("Expected:\n%s\ngot:\n%s", tt.expected, result)
+			}
+		})
+	}
+}
@@ -17,7 +17,19 @@ func RunWithPrompt(fs afero.Fs, promptName string, cliTool string) error {
 
 // RunWithPromptAndRunner executes the specified CLI tool with a prompt using dependency injection for testing
 func RunWithPromptAndRunner(fs afero.Fs, promptName string, cliTool string, runner CommandRunner, stdout, stderr io.Writer) error {
-	content, err := LoadPrompt(fs, promptName)
+	return RunWithPromptOptions(fs, promptName, cliTool, PromptOptions{HomeDir: userHomeDir()}, runner, stdout, stderr)
+}
+
+// RunWithPromptOptions executes the specified CLI tool with a prompt loaded with the given options, e.g. variable overrides
+func RunWithPromptOptions(fs afero.Fs, promptName string, cliTool string, opts PromptOptions, runner CommandRunner, stdout, stderr io.Writer) error {
+	if opts.Agent == "" {
+		opts.Agent = cliTool
+	}
+	// The runtime context, the repo helpers and {{exec}} run their commands with the same runner as the CLI tool
+	if opts.Runner == nil {
+		opts.Runner = runner
+	}
+	prompt, err := renderPrompt(fs, promptName, opts)
 	if err != nil {
 		// Log failed execution
 		if logErr := LogPromptExecution(fs, promptName, cliTool, false); logErr != nil {
@@ -26,10 +38,19 @@ func RunWithPromptAndRunner(fs afero.Fs, promptName string, cliTool string, runn
 		return fmt.Errorf("error reading file: %w", err)
 	}
 
+	content := []byte(prompt.Content)
+
 	cliPath := FindCliBinary(cliTool)
 
 	var cmd *exec.Cmd
 	if cliTool == "codex" {
+		// SECURITY: Command line arguments are visible to other processes, e.g. with ps
+		if prompt.redacted() != prompt.Content {
+			if logErr := LogPromptExecution(fs, promptName, cliTool, false); logErr != nil {
+				fmt.Printf("Warning: failed to log prompt execution: %v\n", logErr)
+			}
+			return fmt.Errorf("prompt %q contains values of secret variables, codex would get them as a command line argument visible to other processes, use claude or gemini instead", promptName)
+		}
 		// For codex, pass the prompt as a command-line argument
 		cmd = runner.Command(cliPath, string(content))
 		cmd.Stdout = stdout
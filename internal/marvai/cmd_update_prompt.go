@@ -3,10 +3,7 @@ package marvai
 import (
 	"fmt"
 	"io"
-	"net/http"
 	"path/filepath"
-	"strings"
-	"time"
 
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v3"
@@ -14,6 +11,15 @@ import (
 
 // UpdatePrompt checks for new version of a prompt and updates it safely
 func UpdatePrompt(fs afero.Fs, promptName string) error {
+	opts, err := DefaultInstallOptions(fs)
+	if err != nil {
+		return err
+	}
+	return UpdatePromptWithOptions(fs, promptName, opts)
+}
+
+// UpdatePromptWithOptions checks the registries for a new version of a prompt and updates it safely
+func UpdatePromptWithOptions(fs afero.Fs, promptName string, opts InstallOptions) error {
 	// Validate prompt name
 	if err := ValidatePromptName(promptName); err != nil {
 		return fmt.Errorf("invalid prompt name: %w", err)
@@ -37,14 +43,8 @@ func UpdatePrompt(fs afero.Fs, promptName string) error {
 
 	fmt.Printf("Checking for updates to prompt '%s'...\n", promptName)
 
-	// Fetch remote prompts to get latest version
-	prompts, err := fetchRemotePrompts("")
-	if err != nil {
-		return fmt.Errorf("error fetching remote prompts: %w", err)
-	}
-
-	// Find the prompt entry
-	promptEntry, err := findPromptByName(prompts, promptName)
+	// Find the prompt entry in the registries to get latest version
+	registry, promptEntry, err := opts.Registries.FindPrompt("", promptName)
 	if err != nil {
 		return fmt.Errorf("prompt '%s' not found in remote registry: %w", promptName, err)
 	}
@@ -62,82 +62,52 @@ func UpdatePrompt(fs afero.Fs, promptName string) error {
 	fmt.Println()
 
 	// Ask user for confirmation
-	fmt.Printf("Do you want to update '%s' to version %s? (yes/no) ", promptName, promptEntry.Version)
-	var response string
-	if _, err := fmt.Scanln(&response); err != nil {
-		fmt.Printf("Warning: failed to read input: %v\n", err)
-	}
-
-	if strings.ToLower(strings.TrimSpace(response)) != "yes" {
+	if !confirm(fmt.Sprintf("Do you want to update '%s' to version %s?", promptName, promptEntry.Version), opts.Yes) {
 		fmt.Println("Update cancelled.")
 		return nil
 	}
 
 	// Backup existing .var file
-	var existingValues map[string]string
+	var existingValues map[string]interface{}
 	varExists, err := afero.Exists(fs, varFile)
 	if err != nil {
 		return fmt.Errorf("error checking .var file: %w", err)
 	}
 
 	if varExists {
-		existingValues, err = loadVarFile(fs, varFile)
+		existingValues, err = loadVarValues(fs, varFile)
 		if err != nil {
 			fmt.Printf("Warning: Could not load existing .var file: %v\n", err)
-			existingValues = make(map[string]string)
+			existingValues = make(map[string]interface{})
 		}
 	} else {
-		existingValues = make(map[string]string)
+		existingValues = make(map[string]interface{})
 	}
 
-	// Backup current .mprompt file
-	backupMpromptFile := mpromptFile + ".backup"
-	if err := copyFileAfero(fs, mpromptFile, backupMpromptFile); err != nil {
-		return fmt.Errorf("error backing up .mprompt file: %w", err)
-	}
-
-	// Download new version
-	promptURL := fmt.Sprintf("https://registry.marvai.dev/dist/marvai/%s", promptEntry.File)
-
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
-
-	resp, err := client.Get(promptURL)
+	// Download new version and verify it against the PROMPTS entry
+	newContent, newData, err := fetchVerifiedPrompt(registry, "", promptEntry)
 	if err != nil {
 		return fmt.Errorf("error downloading new version: %w", err)
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			fmt.Printf("Warning: failed to close response body: %v\n", err)
-		}
-	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("download failed with status code: %d", resp.StatusCode)
-	}
+	storedValues := existingValues
+	existingValues = prefillWithSecrets(fs, opts, newData.Variables, storedValues)
 
-	// Read new content
-	const maxSize = 10 * 1024 * 1024 // 10MB limit
-	limitReader := io.LimitReader(resp.Body, maxSize+1)
-	newContent, err := io.ReadAll(limitReader)
-	if err != nil {
-		return fmt.Errorf("error reading new version: %w", err)
-	}
-
-	if len(newContent) > maxSize {
-		return fmt.Errorf("new version too large (%d bytes)", len(newContent))
+	// Invalid answers and, without prompting, missing required variables fail the update before anything is changed
+	var newValues map[string]interface{}
+	if opts.Yes {
+		newValues, err = runWizard(fs, newData.Variables, existingValues, opts)
+	} else {
+		_, err = opts.Answers.resolve(fs, newData.Variables)
 	}
-
-	// Parse new content
-	newData, err := ParseMPromptContent(newContent, fmt.Sprintf("remote-%s", promptName))
 	if err != nil {
-		return fmt.Errorf("error parsing new version: %w", err)
+		return err
 	}
 
-	// Verify SHA256 hash
-	if err := verifySHA256([]byte(newData.Template), promptEntry.SHA256); err != nil {
-		return fmt.Errorf("SHA256 verification failed: %w", err)
+	// Backup current .mprompt file
+	backupMpromptFile := mpromptFile + ".backup"
+	if err := copyFileAfero(fs, mpromptFile, backupMpromptFile); err != nil {
+		return fmt.Errorf("error backing up .mprompt file: %w", err)
 	}
 
 	// Install new version
@@ -159,21 +129,16 @@ func UpdatePrompt(fs afero.Fs, promptName string) error {
 
 	// Run wizard with prefilled values if there are variables
 	if len(newData.Variables) > 0 {
-		fmt.Printf("\nRunning configuration wizard for updated prompt '%s'...\n", promptName)
-		fmt.Println("You can press Enter to keep existing values or type new ones.")
-
-		newValues, err := ExecuteWizardWithPrefills(newData.Variables, existingValues)
+		if newValues == nil {
+			fmt.Printf("\nRunning configuration wizard for updated prompt '%s'...\n", promptName)
+			fmt.Println("You can press Enter to keep existing values or type new ones.")
+			newValues, err = runWizard(fs, newData.Variables, existingValues, opts)
+		}
 		if err != nil {
 			fmt.Printf("Warning: Configuration wizard failed: %v\n", err)
 
 			// Ask if user wants to rollback
-			fmt.Print("Do you want to rollback to the previous version? (yes/no) ")
-			var rollbackResponse string
-			if _, err := fmt.Scanln(&rollbackResponse); err != nil {
-				fmt.Printf("Warning: failed to read input: %v\n", err)
-			}
-
-			if strings.ToLower(strings.TrimSpace(rollbackResponse)) == "yes" {
+			if confirm("Do you want to rollback to the previous version?", opts.Yes) {
 				// Restore backup
 				if err := copyFileAfero(fs, backupMpromptFile, mpromptFile); err != nil {
 					fmt.Printf("Error: Could not rollback: %v\n", err)
@@ -189,8 +154,11 @@ func UpdatePrompt(fs afero.Fs, promptName string) error {
 			// Keep new version but warn about configuration
 			fmt.Printf("Prompt '%s' updated but may need manual configuration.\n", promptName)
 		} else {
-			// Save new configuration
-			if err := saveVarFile(fs, varFile, newValues); err != nil {
+			// Save new configuration, secrets go to the user's secret store
+			newValues, err = storeSecrets(fs, opts, newData.Variables, newValues, storedValues)
+			if err != nil {
+				fmt.Printf("Warning: Could not save new configuration: %v\n", err)
+			} else if err := saveVarValues(fs, varFile, newValues); err != nil {
 				fmt.Printf("Warning: Could not save new configuration: %v\n", err)
 			}
 		}
@@ -202,6 +170,9 @@ func UpdatePrompt(fs afero.Fs, promptName string) error {
 	}
 
 	fmt.Printf("Successfully updated prompt '%s' to version %s\n", promptName, promptEntry.Version)
+
+	// SECURITY: A new version needs a new approval of its commands
+	approveInstalledCommands(fs, opts, promptName, newData)
 	return nil
 }
 
@@ -231,14 +202,32 @@ func copyFileAfero(fs afero.Fs, src, dst string) error {
 	return err
 }
 
-// loadVarFile loads variables from a .var file
+// loadVarFile loads variables from a .var file as strings
 func loadVarFile(fs afero.Fs, filePath string) (map[string]string, error) {
+	values, err := loadVarValues(fs, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return formatVarValues(values), nil
+}
+
+// saveVarFile saves string variables to a .var file
+func saveVarFile(fs afero.Fs, filePath string, values map[string]string) error {
+	typedValues := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		typedValues[key] = value
+	}
+	return saveVarValues(fs, filePath, typedValues)
+}
+
+// loadVarValues loads typed variables from a .var file
+func loadVarValues(fs afero.Fs, filePath string) (map[string]interface{}, error) {
 	content, err := afero.ReadFile(fs, filePath)
 	if err != nil {
 		return nil, err
 	}
 
-	var values map[string]string
+	var values map[string]interface{}
 	if err := yaml.Unmarshal(content, &values); err != nil {
 		return nil, err
 	}
@@ -246,8 +235,8 @@ func loadVarFile(fs afero.Fs, filePath string) (map[string]string, error) {
 	return values, nil
 }
 
-// saveVarFile saves variables to a .var file
-func saveVarFile(fs afero.Fs, filePath string, values map[string]string) error {
+// saveVarValues saves typed variables to a .var file, values keep their YAML types
+func saveVarValues(fs afero.Fs, filePath string, values map[string]interface{}) error {
 	data, err := yaml.Marshal(values)
 	if err != nil {
 		return err
@@ -0,0 +1,341 @@
+package marvai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// maxCommands limits the commands a prompt can declare for {{exec}}
+const maxCommands = 20
+
+// maxCommandLength limits the length of a declared command
+const maxCommandLength = 1024
+
+// execTimeout is how long a command of {{exec}} can run before it is killed
+const execTimeout = 60 * time.Second
+
+// validateCommands checks the commands the frontmatter declares for {{exec}}
+func validateCommands(commands []string) error {
+	if len(commands) > maxCommands {
+		return fmt.Errorf("too many commands (%d), maximum allowed is %d", len(commands), maxCommands)
+	}
+	seen := make(map[string]bool)
+	for _, command := range commands {
+		if strings.TrimSpace(command) == "" {
+			return fmt.Errorf("command cannot be empty")
+		}
+		if len(command) > maxCommandLength {
+			return fmt.Errorf("command %q is too long (max %d characters)", command, maxCommandLength)
+		}
+		// SECURITY: A newline would hide a command from the approval
+		for _, r := range command {
+			if unicode.IsControl(r) {
+				return fmt.Errorf("command %q contains control characters", command)
+			}
+		}
+		if _, err := splitCommand(command); err != nil {
+			return fmt.Errorf("command %q: %w", command, err)
+		}
+		if seen[command] {
+			return fmt.Errorf("duplicate command %q", command)
+		}
+		seen[command] = true
+	}
+	return nil
+}
+
+// splitCommand splits a command into its arguments like a shell without expansions: whitespace separates
+// arguments, single quotes keep text as it is, double quotes and backslashes escape
+func splitCommand(command string) ([]string, error) {
+	var args []string
+	var arg strings.Builder
+	inArg := false
+	var quote rune
+	escaped := false
+	for _, r := range command {
+		switch {
+		case escaped:
+			// In double quotes a backslash only escapes quotes and backslashes
+			if quote == '"' && r != '"' && r != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(r)
+			escaped = false
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\\':
+			escaped = true
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				arg.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case unicode.IsSpace(r):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(r)
+			inArg = true
+		}
+	}
+	if escaped {
+		return nil, errors.New("ends with a backslash")
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("has an unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, errors.New("command cannot be empty")
+	}
+	return args, nil
+}
+
+// approvalsFile returns the file with the approved commands of prompts
+func approvalsFile(homeDir string) string {
+	return filepath.Join(userConfigDir(homeDir), "approvals.yaml")
+}
+
+// approvalKey identifies a prompt version for approvals
+func approvalKey(promptName string, data *MPromptData) string {
+	return promptName + "@" + data.Frontmatter.Version
+}
+
+// commandsDigest returns the SHA256 hash of the declared commands, a changed command needs a new approval
+func commandsDigest(commands []string) string {
+	hash := sha256.Sum256([]byte(strings.Join(commands, "\n")))
+	return hex.EncodeToString(hash[:])
+}
+
+// loadApprovals returns the digests of the approved commands by prompt version
+func loadApprovals(fs afero.Fs, homeDir string) (map[string]string, error) {
+	approvals := make(map[string]string)
+	if homeDir == "" {
+		return approvals, nil
+	}
+
+	file := approvalsFile(homeDir)
+
+	// SECURITY: Prevent symlink attacks by checking if the file is a symlink
+	if err := validateFileIsNotSymlink(fs, file); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	content, err := afero.ReadFile(fs, file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return approvals, nil
+		}
+		return nil, fmt.Errorf("error reading approvals %s: %w", file, err)
+	}
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if len(content) > 1024*1024 { // 1MB limit for approvals
+		return nil, fmt.Errorf("approvals file too large (%d bytes), maximum allowed is 1MB", len(content))
+	}
+
+	if err := yaml.Unmarshal(content, &approvals); err != nil {
+		return nil, fmt.Errorf("error parsing approvals %s: %w", file, err)
+	}
+	return approvals, nil
+}
+
+// commandsApproved reports if the user approved the commands of this version of a prompt
+func commandsApproved(fs afero.Fs, homeDir string, promptName string, data *MPromptData) (bool, error) {
+	approvals, err := loadApprovals(fs, homeDir)
+	if err != nil {
+		return false, err
+	}
+	return approvals[approvalKey(promptName, data)] == commandsDigest(data.Frontmatter.Commands), nil
+}
+
+// approveCommands asks the user once per prompt version to allow the commands the prompt runs with {{exec}},
+// approve allows them without asking
+func approveCommands(fs afero.Fs, homeDir string, promptName string, data *MPromptData, approve bool) (bool, error) {
+	if len(data.Frontmatter.Commands) == 0 {
+		return true, nil
+	}
+	if homeDir == "" {
+		return false, fmt.Errorf("approving commands needs a home directory")
+	}
+
+	approvals, err := loadApprovals(fs, homeDir)
+	if err != nil {
+		return false, err
+	}
+	key := approvalKey(promptName, data)
+	digest := commandsDigest(data.Frontmatter.Commands)
+	if approvals[key] == digest {
+		return true, nil
+	}
+
+	fmt.Printf("Prompt '%s' runs these commands when it is rendered:\n", promptName)
+	for _, command := range data.Frontmatter.Commands {
+		fmt.Printf("  %s\n", command)
+	}
+	if !confirm("Do you want to allow these commands?", approve) {
+		return false, nil
+	}
+
+	approvals[key] = digest
+	content, err := yaml.Marshal(approvals)
+	if err != nil {
+		return false, fmt.Errorf("error marshaling approvals: %w", err)
+	}
+	if err := fs.MkdirAll(userConfigDir(homeDir), 0700); err != nil {
+		return false, fmt.Errorf("error creating config directory: %w", err)
+	}
+	if err := writeFileAtomic(fs, approvalsFile(homeDir), content, 0600); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkCommandsApproved fails rendering a prompt with commands the user didn't approve
+func checkCommandsApproved(fs afero.Fs, homeDir string, promptName string, data *MPromptData) error {
+	if len(data.Frontmatter.Commands) == 0 {
+		return nil
+	}
+	approved, err := commandsApproved(fs, homeDir, promptName, data)
+	if err != nil {
+		return err
+	}
+	if !approved {
+		return fmt.Errorf("prompt %q runs commands that are not approved, run 'marvai approve %s'", promptName, promptName)
+	}
+	return nil
+}
+
+// commandExec runs the declared commands of a prompt for {{exec}}
+type commandExec struct {
+	runner   CommandRunner
+	commands map[string]bool
+	timeout  time.Duration
+	root     string
+	resolved bool
+}
+
+// newCommandExec returns an exec running only the declared commands
+func newCommandExec(runner CommandRunner, commands []string) *commandExec {
+	allowed := make(map[string]bool, len(commands))
+	for _, command := range commands {
+		allowed[command] = true
+	}
+	return &commandExec{runner: runner, commands: allowed, timeout: execTimeout}
+}
+
+// Run runs a declared command and returns its output and errors. A failing command is not an error,
+// its output ends with the exit status, so prompts can embed test failures
+func (e *commandExec) Run(command string) (string, error) {
+	// SECURITY: Only commands the prompt declares and the user approved can run
+	if !e.commands[command] {
+		return "", fmt.Errorf("command is not listed in the commands of the frontmatter")
+	}
+
+	// SECURITY: Commands run without a shell, so ;, | and $() are plain arguments
+	args, err := splitCommand(command)
+	if err != nil {
+		return "", err
+	}
+	if _, err := e.runner.LookPath(args[0]); err != nil {
+		return "", fmt.Errorf("%s not found: %w", args[0], err)
+	}
+
+	// Commands run in the repository root like the repo helpers, wherever marvai is run,
+	// outside of a repository in the working directory
+	if !e.resolved {
+		e.root = gitOutput(e.runner, "rev-parse", "--show-toplevel")
+		e.resolved = true
+	}
+
+	// SECURITY: Limit the output, stderr is captured with it instead of reaching the terminal
+	output := &limitedBuffer{limit: maxRepoHelperOutput}
+	cmd := e.runner.Command(args[0], args[1:]...)
+	cmd.Dir = e.root
+	cmd.Stdout = output
+	cmd.Stderr = output
+	// Child processes still writing after a kill must not block Wait
+	cmd.WaitDelay = time.Second
+
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+
+	select {
+	case err = <-done:
+	case <-time.After(e.timeout):
+		_ = cmd.Process.Kill()
+		<-done
+		return "", fmt.Errorf("timed out after %s", e.timeout)
+	}
+
+	if output.exceeded {
+		return "", fmt.Errorf("output is too large (max %d bytes)", maxRepoHelperOutput)
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result := output.String()
+		if result != "" && !strings.HasSuffix(result, "\n") {
+			result += "\n"
+		}
+		return result + fmt.Sprintf("[exit status %d]", exitErr.ExitCode()), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// approveInstalledCommands asks to approve the commands of an installed or updated prompt,
+// declined commands only fail rendering
+func approveInstalledCommands(fs afero.Fs, opts InstallOptions, promptName string, data *MPromptData) {
+	if len(data.Frontmatter.Commands) == 0 {
+		return
+	}
+
+	var approved bool
+	var err error
+	if opts.Yes && !opts.ApproveCommands {
+		// SECURITY: --yes skips confirmations but doesn't allow commands, that takes --approve-commands
+		// or 'marvai approve'
+		approved, err = commandsApproved(fs, opts.homeDir(), promptName, data)
+	} else {
+		approved, err = approveCommands(fs, opts.homeDir(), promptName, data, opts.ApproveCommands)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to approve commands: %v\n", err)
+		return
+	}
+	if !approved {
+		fmt.Printf("Commands not approved, run 'marvai approve %s' before using the prompt\n", promptName)
+	}
+}
@@ -0,0 +1,241 @@
+package marvai
+
+import (
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+func TestValidateCommands(t *testing.T) {
+	tests := []struct {
+		name        string
+		commands    []string
+		expectError string
+	}{
+		{name: "commands", commands: []string{"go list ./...", "go test ./..."}},
+		{name: "empty command", commands: []string{" "}, expectError: "command cannot be empty"},
+		{name: "duplicate command", commands: []string{"go test", "go test"}, expectError: `duplicate command "go test"`},
+		{name: "hidden command", commands: []string{"go test\nrm -rf /"}, expectError: "contains control characters"},
+		{name: "unterminated quote", commands: []string{"go list -f '{{.Dir}}"}, expectError: "has an unterminated ' quote"},
+		{name: "too long", commands: []string{strings.Repeat("a", maxCommandLength+1)}, expectError: "is too long"},
+		{name: "too many", commands: strings.Fields(strings.Repeat("a ", maxCommands+1)), expectError: "too many commands"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateCommands(tt.commands)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		command     string
+		expected    []string
+		expectError string
+	}{
+		{command: "go test ./...", expected: []string{"go", "test", "./..."}},
+		{command: "go list -f '{{.Dir}} {{.Name}}' ./...", expected: []string{"go", "list", "-f", "{{.Dir}} {{.Name}}", "./..."}},
+		{command: `echo "a \"b\" \n" c\ d '' x"y"z`, expected: []string{"echo", `a "b" \n`, "c d", "", "xyz"}},
+		{command: "echo $(id) ; rm", expected: []string{"echo", "$(id)", ";", "rm"}},
+		{command: `echo "open`, expectError: `unterminated " quote`},
+		{command: `echo \`, expectError: "ends with a backslash"},
+		{command: "''", expected: []string{""}},
+		{command: "  ", expectError: "command cannot be empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			args, err := splitCommand(tt.command)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(args, tt.expected) {
+				t.Errorf("Expected %q, got %q", tt.expected, args)
+			}
+		})
+	}
+}
+
+// rootCommandRunner runs commands on the OS and answers git with root as the repository root
+type rootCommandRunner struct {
+	root string
+}
+
+func (r rootCommandRunner) Command(name string, arg ...string) *exec.Cmd {
+	if name == "git" {
+		if r.root == "" {
+			return exec.Command("false")
+		}
+		return exec.Command("echo", r.root)
+	}
+	return exec.Command(name, arg...)
+}
+
+func (r rootCommandRunner) LookPath(file string) (string, error) {
+	return exec.LookPath(file)
+}
+
+func TestCommandExec(t *testing.T) {
+	commands := []string{"echo hello world", "echo $(id) ; rm", "ls /nonexistent-marvai-dir", "sleep 5", `printf "%s|" 'a b' "c d"`, "pwd"}
+	root := t.TempDir()
+
+	tests := []struct {
+		name        string
+		command     string
+		timeout     time.Duration
+		expected    string
+		contains    []string
+		expectError string
+	}{
+		{name: "output", command: "echo hello world", expected: "hello world\n"},
+		{name: "no shell", command: "echo $(id) ; rm", expected: "$(id) ; rm\n"},
+		{name: "failing command with stderr", command: "ls /nonexistent-marvai-dir", contains: []string{"nonexistent-marvai-dir", "[exit status 2]"}},
+		{name: "undeclared command", command: "echo other", expectError: "command is not listed in the commands of the frontmatter"},
+		{name: "timeout", command: "sleep 5", timeout: 100 * time.Millisecond, expectError: "timed out after 100ms"},
+		{name: "quoted arguments", command: `printf "%s|" 'a b' "c d"`, expected: "a b|c d|"},
+		{name: "repository root", command: "pwd", expected: root + "\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			runner := newCommandExec(rootCommandRunner{root: root}, commands)
+			if tt.timeout > 0 {
+				runner.timeout = tt.timeout
+			}
+
+			output, err := runner.Run(tt.command)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if tt.expected != "" && output != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, output)
+			}
+			for _, expected := range tt.contains {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected output to contain %q, got %q", expected, output)
+				}
+			}
+		})
+	}
+
+	// Outside of a repository commands run in the working directory
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+	output, err := newCommandExec(rootCommandRunner{}, commands).Run("pwd")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if output != wd+"\n" {
+		t.Errorf("Expected %q, got %q", wd+"\n", output)
+	}
+}
+
+func TestLoadPromptCommands(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	homeDir := "/home/user"
+	prompt := "@@@ frontmatter\nformat: 2\nname: packages\nversion: 1.0.0\ncommands: [\"echo example.com/app\"]\n@@@ template\nPackages: {{exec \"echo example.com/app\"}}"
+	if err := afero.WriteFile(fs, ".marvai/packages.mprompt", []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write .mprompt file: %v", err)
+	}
+
+	opts := PromptOptions{HomeDir: homeDir, Runner: rootCommandRunner{root: t.TempDir()}}
+	if _, err := LoadPromptWithOptions(fs, "packages", opts); err == nil || !strings.Contains(err.Error(), "run 'marvai approve packages'") {
+		t.Fatalf("Expected unapproved commands to fail rendering, got %v", err)
+	}
+
+	var output strings.Builder
+	if err := ApprovePromptWithOptions(fs, "packages", InstallOptions{HomeDir: homeDir, ApproveCommands: true}, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "approved") {
+		t.Errorf("Expected approval message, got %q", output.String())
+	}
+
+	content, err := LoadPromptWithOptions(fs, "packages", opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := "Packages: example.com/app\n"; string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+
+	// A new version and changed commands need a new approval
+	for _, changed := range []string{
+		strings.Replace(prompt, "version: 1.0.0", "version: 1.1.0", 1),
+		strings.Replace(prompt, "commands: [\"echo example.com/app\"]", "commands: [\"echo example.com/app\", \"go env\"]", 1),
+	} {
+		if err := afero.WriteFile(fs, ".marvai/packages.mprompt", []byte(changed), 0644); err != nil {
+			t.Fatalf("Failed to write .mprompt file: %v", err)
+		}
+		if _, err := LoadPromptWithOptions(fs, "packages", opts); err == nil || !strings.Contains(err.Error(), "not approved") {
+			t.Errorf("Expected changed prompt to need a new approval, got %v", err)
+		}
+	}
+}
+
+func TestInstallCommandsApproval(t *testing.T) {
+	prompt := "@@@ frontmatter\nformat: 2\nname: packages\nversion: 1.0.0\ncommands: [\"go list ./...\"]\n@@@ template\nPackages: {{exec \"go list ./...\"}}\n"
+
+	tests := []struct {
+		name     string
+		opts     InstallOptions
+		expected bool
+	}{
+		// --yes skips confirmations, it never allows commands
+		{name: "yes", opts: InstallOptions{Yes: true}, expected: false},
+		{name: "approve commands", opts: InstallOptions{Yes: true, ApproveCommands: true}, expected: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := newInstallFs(t, map[string]string{"prompts/packages.mprompt": prompt})
+			opts := tt.opts
+			opts.Runner = installRunner
+			opts.HomeDir = "/home/user"
+
+			if err := InstallMPromptFromSourceWithOptions(fs, "./prompts/packages.mprompt", opts); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			data, _, err := loadInstalledPrompt(fs, "packages")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			approved, err := commandsApproved(fs, opts.HomeDir, "packages", data)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if approved != tt.expected {
+				t.Errorf("Expected commands approved %v, got %v", tt.expected, approved)
+			}
+		})
+	}
+}
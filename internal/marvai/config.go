@@ -0,0 +1,73 @@
+package marvai
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// Config represents the user configuration in ~/.config/marvai/config.yaml
+type Config struct {
+	// Registries lists the registries in priority order
+	Registries []string `yaml:"registries,omitempty"`
+}
+
+// userHomeDir returns the home directory of the current user
+func userHomeDir() string {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return homeDir
+}
+
+// userConfigDir returns the marvai configuration directory of the user
+func userConfigDir(homeDir string) string {
+	return filepath.Join(homeDir, ".config", "marvai")
+}
+
+// userCacheDir returns the marvai cache directory of the user
+func userCacheDir() string {
+	cacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(cacheDir, "marvai")
+}
+
+// LoadConfig loads the user configuration, a missing configuration file results in an empty configuration
+func LoadConfig(fs afero.Fs, homeDir string) (*Config, error) {
+	config := &Config{}
+	if homeDir == "" {
+		return config, nil
+	}
+
+	configFile := filepath.Join(userConfigDir(homeDir), "config.yaml")
+
+	// SECURITY: Prevent symlink attacks by checking if the file is a symlink
+	if err := validateFileIsNotSymlink(fs, configFile); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	content, err := afero.ReadFile(fs, configFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, fmt.Errorf("error reading config file %s: %w", configFile, err)
+	}
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if len(content) > 1024*1024 { // 1MB limit for config file
+		return nil, fmt.Errorf("config file too large (%d bytes), maximum allowed is 1MB", len(content))
+	}
+
+	if err := yaml.Unmarshal(content, config); err != nil {
+		return nil, fmt.Errorf("error parsing config file %s: %w", configFile, err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,215 @@
+package marvai
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// envDefaultPrefix is the prefix of dynamic defaults read from an environment variable, e.g. env:TEAM
+const envDefaultPrefix = "env:"
+
+// defaultResolvers are the dynamic defaults a wizard variable can declare with default_from
+var defaultResolvers = map[string]func(r *defaultResolver) string{
+	"git.user.name": (*defaultResolver).gitUserName,
+	"go.module":     (*defaultResolver).goModule,
+	"repo.name":     (*defaultResolver).repoName,
+	"repo.language": (*defaultResolver).repoLanguage,
+}
+
+var envNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sensitiveEnvParts mark environment variables that must not become defaults
+var sensitiveEnvParts = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH", "SESSION", "COOKIE"}
+
+// validateDefaultFrom checks that default_from names a known resolver or a safe environment variable
+func validateDefaultFrom(defaultFrom string) error {
+	if name, ok := strings.CutPrefix(defaultFrom, envDefaultPrefix); ok {
+		if !envNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		// SECURITY: Prompts from registries must not read credentials from the environment
+		upperName := strings.ToUpper(name)
+		for _, part := range sensitiveEnvParts {
+			if strings.Contains(upperName, part) {
+				return fmt.Errorf("environment variable %q may contain credentials", name)
+			}
+		}
+		return nil
+	}
+
+	if _, ok := defaultResolvers[defaultFrom]; !ok {
+		var names []string
+		for name := range defaultResolvers {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("unknown default_from %q, expected one of %s or env:<NAME>", defaultFrom, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// defaultResolver resolves dynamic defaults from the repository in the current directory
+type defaultResolver struct {
+	fs      afero.Fs
+	runner  CommandRunner
+	environ []string
+}
+
+func newDefaultResolver(fs afero.Fs, opts InstallOptions) *defaultResolver {
+	return &defaultResolver{fs: fs, runner: opts.runner(), environ: opts.Answers.Environ}
+}
+
+// withDefaults returns the prefilled values completed with the defaults of variables without a value.
+// A dynamic default that can't be resolved falls back to the static default
+func (r *defaultResolver) withDefaults(variables []WizardVariable, prefill map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(prefill))
+	for key, value := range prefill {
+		result[key] = value
+	}
+
+	for _, variable := range variables {
+		if existing, ok := prefill[variable.ID]; ok && !isEmptyVarValue(existing) {
+			continue
+		}
+		if value, ok := r.defaultValue(variable); ok {
+			result[variable.ID] = value
+		}
+	}
+
+	return result
+}
+
+// defaultValue returns the default of a variable converted to its type
+func (r *defaultResolver) defaultValue(variable WizardVariable) (interface{}, bool) {
+	if variable.DefaultFrom != "" {
+		if value := r.resolve(variable.DefaultFrom); value != "" {
+			if parsed, err := parseVarValue(r.fs, variable, value); err == nil {
+				return parsed, true
+			}
+		}
+	}
+
+	if variable.Default != nil {
+		if parsed, err := parseVarValue(r.fs, variable, variable.Default); err == nil && !isEmptyVarValue(parsed) {
+			return parsed, true
+		}
+	}
+
+	return nil, false
+}
+
+// resolve returns the value of a dynamic default, empty if it can't be determined
+func (r *defaultResolver) resolve(defaultFrom string) string {
+	if validateDefaultFrom(defaultFrom) != nil {
+		return ""
+	}
+	if name, ok := strings.CutPrefix(defaultFrom, envDefaultPrefix); ok {
+		for _, entry := range r.environ {
+			if key, value, found := strings.Cut(entry, "="); found && key == name {
+				return strings.TrimSpace(value)
+			}
+		}
+		return ""
+	}
+	return defaultResolvers[defaultFrom](r)
+}
+
+// gitUserName returns the configured git user.name
+func (r *defaultResolver) gitUserName() string {
+	if _, err := r.runner.LookPath("git"); err != nil {
+		return ""
+	}
+	output, err := r.runner.Command("git", "config", "user.name").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+var goModuleRegex = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// goModule returns the module path from go.mod
+func (r *defaultResolver) goModule() string {
+	// SECURITY: Don't follow symlinks out of the repository
+	if err := validateFileIsNotSymlink(r.fs, "go.mod"); err != nil {
+		return ""
+	}
+	info, err := r.fs.Stat("go.mod")
+	if err != nil || info.Size() > 1024*1024 { // 1MB limit
+		return ""
+	}
+	content, err := afero.ReadFile(r.fs, "go.mod")
+	if err != nil {
+		return ""
+	}
+	if matches := goModuleRegex.FindSubmatch(content); matches != nil {
+		return string(matches[1])
+	}
+	return ""
+}
+
+// repoName returns the name of the repository directory
+func (r *defaultResolver) repoName() string {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return ""
+	}
+	return filepath.Base(workDir)
+}
+
+// languageExtensions map file extensions to programming languages for language detection
+var languageExtensions = map[string]string{
+	".go": "Go", ".py": "Python", ".js": "JavaScript", ".jsx": "JavaScript", ".mjs": "JavaScript",
+	".ts": "TypeScript", ".tsx": "TypeScript", ".java": "Java", ".kt": "Kotlin", ".scala": "Scala",
+	".rb": "Ruby", ".rs": "Rust", ".c": "C", ".h": "C", ".cpp": "C++", ".cc": "C++", ".hpp": "C++",
+	".cs": "C#", ".php": "PHP", ".swift": "Swift", ".ex": "Elixir", ".exs": "Elixir",
+	".dart": "Dart", ".lua": "Lua", ".sh": "Shell", ".clj": "Clojure", ".hs": "Haskell",
+}
+
+// skippedLanguageDirs are not looked at for language detection
+var skippedLanguageDirs = map[string]bool{
+	"node_modules": true, "vendor": true, "dist": true, "build": true, "target": true,
+}
+
+// repoLanguage returns the language with the most source files in the repository
+func (r *defaultResolver) repoLanguage() string {
+	counts := make(map[string]int)
+	visited := 0
+
+	_ = afero.Walk(r.fs, ".", func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		// SECURITY: Limit the work done for large repositories
+		visited++
+		if visited > 10000 {
+			return filepath.SkipAll
+		}
+		if info.IsDir() {
+			name := info.Name()
+			if path != "." && (strings.HasPrefix(name, ".") || skippedLanguageDirs[name]) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if language, ok := languageExtensions[strings.ToLower(filepath.Ext(path))]; ok {
+			counts[language]++
+		}
+		return nil
+	})
+
+	best := ""
+	for language, count := range counts {
+		if count > counts[best] || (count == counts[best] && language < best) {
+			best = language
+		}
+	}
+	return best
+}
@@ -0,0 +1,178 @@
+package marvai
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// outputCommandRunner returns commands that print a fixed output
+type outputCommandRunner struct {
+	output string
+}
+
+func (r outputCommandRunner) Command(name string, arg ...string) *exec.Cmd {
+	return exec.Command("echo", r.output)
+}
+
+func (r outputCommandRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func TestValidateDefaultFrom(t *testing.T) {
+	tests := []struct {
+		defaultFrom string
+		expectError bool
+	}{
+		{"git.user.name", false},
+		{"go.module", false},
+		{"repo.name", false},
+		{"repo.language", false},
+		{"env:TEAM_NAME", false},
+		{"env:GITHUB_TOKEN", true},
+		{"env:AWS_SECRET_ACCESS_KEY", true},
+		{"env:BAD-NAME", true},
+		{"env:", true},
+		{"git.user.email", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.defaultFrom, func(t *testing.T) {
+			err := validateDefaultFrom(tt.defaultFrom)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for %q", tt.defaultFrom)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error for %q: %v", tt.defaultFrom, err)
+			}
+		})
+	}
+}
+
+func TestDefaultResolver(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"go.mod":                    "// comment\nmodule github.com/example/service\n\ngo 1.24\n",
+		"main.go":                   "package main",
+		"internal/api/handler.go":   "package api",
+		"web/app.ts":                "",
+		"node_modules/lib/a.js":     "",
+		"node_modules/lib/b.js":     "",
+		"node_modules/lib/c.js":     "",
+		".git/hooks/pre-commit.py":  "",
+		".marvai/helper/script.py":  "",
+		"scripts/generate/tool.py":  "",
+		"scripts/generate/other.rb": "",
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	resolver := newDefaultResolver(fs, InstallOptions{
+		Runner:  outputCommandRunner{output: "Jane Doe"},
+		Answers: WizardAnswers{Environ: []string{"TEAM=platform", "EMPTY="}},
+	})
+
+	workDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Failed to get working directory: %v", err)
+	}
+
+	tests := []struct {
+		defaultFrom string
+		expected    string
+	}{
+		{"git.user.name", "Jane Doe"},
+		{"go.module", "github.com/example/service"},
+		{"repo.name", filepath.Base(workDir)},
+		{"repo.language", "Go"},
+		{"env:TEAM", "platform"},
+		{"env:EMPTY", ""},
+		{"env:MISSING", ""},
+		{"env:API_TOKEN", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.defaultFrom, func(t *testing.T) {
+			if actual := resolver.resolve(tt.defaultFrom); actual != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestWithDefaults(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "team", DefaultFrom: "env:TEAM", Default: "core"},
+		{ID: "owner", DefaultFrom: "env:MISSING", Default: "core"},
+		{ID: "retries", Type: "int", Default: 3},
+		{ID: "strict", Type: "bool", Default: true},
+		{ID: "language", Default: "Go"},
+		{ID: "name"},
+	}
+	prefill := map[string]interface{}{"language": "Rust"}
+
+	resolver := newDefaultResolver(afero.NewMemMapFs(), InstallOptions{Answers: WizardAnswers{Environ: []string{"TEAM=platform"}}})
+	values := resolver.withDefaults(variables, prefill)
+
+	expected := map[string]interface{}{
+		"team":     "platform",
+		"owner":    "core",
+		"retries":  3,
+		"strict":   true,
+		"language": "Rust",
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestRunWizardUsesDefaults(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "language", Required: true, DefaultFrom: "env:LANGUAGE"},
+		{ID: "style", Type: "choice", Options: []string{"short", "long"}, Required: true, Default: "short"},
+	}
+	opts := InstallOptions{Yes: true, Answers: WizardAnswers{Environ: []string{"LANGUAGE=Go"}}}
+
+	values, err := runWizard(afero.NewMemMapFs(), variables, nil, opts)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := map[string]interface{}{"language": "Go", "style": "short"}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("Expected %v, got %v", expected, values)
+	}
+}
+
+func TestValidateWizardVariableDefaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		variable    WizardVariable
+		expectError bool
+	}{
+		{"valid int default", WizardVariable{ID: "a", Type: "int", Default: 3, Min: intPtr(1)}, false},
+		{"int default out of range", WizardVariable{ID: "a", Type: "int", Default: 0, Min: intPtr(1)}, true},
+		{"choice default not an option", WizardVariable{ID: "a", Type: "choice", Options: []string{"x"}, Default: "y"}, true},
+		{"bool default", WizardVariable{ID: "a", Type: "bool", Default: "yes"}, false},
+		{"path default is checked later", WizardVariable{ID: "a", Type: "path", Default: "missing"}, false},
+		{"unknown default_from", WizardVariable{ID: "a", DefaultFrom: "hostname"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWizardVariable(0, tt.variable)
+			if tt.expectError && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package marvai
+
+import (
+	"fmt"
+	"strings"
+)
+
+// diffContextLines is the number of unchanged lines shown around changes
+const diffContextLines = 3
+
+// maxDiffCells limits the work of the line diff, larger texts are shown as replaced completely
+const maxDiffCells = 4 * 1024 * 1024
+
+// diffOp is a line of a diff: ' ' unchanged, '-' removed or '+' added
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// unifiedDiff returns the line changes from one text to another in unified diff format, empty if they are equal
+func unifiedDiff(from, to, fromName, toName string) string {
+	if from == to {
+		return ""
+	}
+
+	ops := diffLines(splitDiffLines(from), splitDiffLines(to))
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "--- %s\n+++ %s\n", fromName, toName)
+
+	for start := 0; start < len(ops); {
+		// Find the next change and the end of its hunk
+		change := start
+		for change < len(ops) && ops[change].kind == ' ' {
+			change++
+		}
+		if change == len(ops) {
+			break
+		}
+		hunkStart := max(start, change-diffContextLines)
+
+		// Changes closer than twice the context share a hunk
+		hunkEnd, unchanged := change, 0
+		for ; hunkEnd < len(ops) && unchanged <= 2*diffContextLines; hunkEnd++ {
+			if ops[hunkEnd].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+		}
+		hunkEnd -= max(0, unchanged-diffContextLines)
+
+		writeDiffHunk(&result, ops, hunkStart, hunkEnd)
+		start = hunkEnd
+	}
+
+	return result.String()
+}
+
+// writeDiffHunk writes the operations from start to end with a hunk header
+func writeDiffHunk(result *strings.Builder, ops []diffOp, start, end int) {
+	fromLine, toLine := 1, 1
+	for _, op := range ops[:start] {
+		if op.kind != '+' {
+			fromLine++
+		}
+		if op.kind != '-' {
+			toLine++
+		}
+	}
+	fromCount, toCount := 0, 0
+	for _, op := range ops[start:end] {
+		if op.kind != '+' {
+			fromCount++
+		}
+		if op.kind != '-' {
+			toCount++
+		}
+	}
+
+	fmt.Fprintf(result, "@@ -%s +%s @@\n", hunkRange(fromLine, fromCount), hunkRange(toLine, toCount))
+	for _, op := range ops[start:end] {
+		result.WriteByte(op.kind)
+		result.WriteString(op.line)
+		result.WriteByte('\n')
+	}
+}
+
+// hunkRange formats the start and length of a hunk, an empty range starts before its line
+func hunkRange(line, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", line-1)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", line)
+	}
+	return fmt.Sprintf("%d,%d", line, count)
+}
+
+// splitDiffLines splits text into lines, a final newline doesn't start another line
+func splitDiffLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the operations turning from into to, based on their longest common subsequence
+func diffLines(from, to []string) []diffOp {
+	// Unchanged lines at the start and end don't need the expensive comparison
+	prefix := 0
+	for prefix < len(from) && prefix < len(to) && from[prefix] == to[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(from)-prefix && suffix < len(to)-prefix && from[len(from)-1-suffix] == to[len(to)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, line := range from[:prefix] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	ops = append(ops, diffMiddle(from[prefix:len(from)-suffix], to[prefix:len(to)-suffix])...)
+	for _, line := range from[len(from)-suffix:] {
+		ops = append(ops, diffOp{kind: ' ', line: line})
+	}
+	return ops
+}
+
+// diffMiddle compares the changed part of two texts
+func diffMiddle(from, to []string) []diffOp {
+	var ops []diffOp
+
+	// SECURITY: Limit memory and time for large prompts
+	if len(from)*len(to) > maxDiffCells {
+		for _, line := range from {
+			ops = append(ops, diffOp{kind: '-', line: line})
+		}
+		for _, line := range to {
+			ops = append(ops, diffOp{kind: '+', line: line})
+		}
+		return ops
+	}
+
+	// common[i][j] is the length of the longest common subsequence of from[i:] and to[j:]
+	common := make([][]int, len(from)+1)
+	for i := range common {
+		common[i] = make([]int, len(to)+1)
+	}
+	for i := len(from) - 1; i >= 0; i-- {
+		for j := len(to) - 1; j >= 0; j-- {
+			if from[i] == to[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(from) || j < len(to) {
+		switch {
+		case i < len(from) && j < len(to) && from[i] == to[j]:
+			ops = append(ops, diffOp{kind: ' ', line: from[i]})
+			i++
+			j++
+		case j < len(to) && (i == len(from) || common[i][j+1] > common[i+1][j]):
+			ops = append(ops, diffOp{kind: '+', line: to[j]})
+			j++
+		default:
+			ops = append(ops, diffOp{kind: '-', line: from[i]})
+			i++
+		}
+	}
+	return ops
+}
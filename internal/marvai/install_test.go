@@ -0,0 +1,116 @@
+package marvai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// installRunner answers the git commands that check for a repository
+var installRunner = outputCommandRunner{output: ".git"}
+
+const installPrompt = "@@@ frontmatter\nformat: 2\nname: hello\nversion: 1.0.0\n@@@ wizard\n- id: language\n  description: For what language\n@@@ template\nWrite hello world in {{language}}.\n"
+
+// newInstallFs returns a filesystem with a git repository to install into
+func newInstallFs(t *testing.T, files map[string]string) afero.Fs {
+	t.Helper()
+	fs := afero.NewMemMapFs()
+	if err := fs.Mkdir(".git", 0755); err != nil {
+		t.Fatalf("Failed to create .git: %v", err)
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return fs
+}
+
+// checkInstalled checks the installed .mprompt and .var files of the hello prompt
+func checkInstalled(t *testing.T, fs afero.Fs, source string) {
+	t.Helper()
+	mprompt, err := afero.ReadFile(fs, ".marvai/hello.mprompt")
+	if err != nil {
+		t.Fatalf("Expected installed .mprompt file: %v", err)
+	}
+	if !strings.Contains(string(mprompt), "source: "+source) || !strings.Contains(string(mprompt), "Write hello world in {{language}}.") {
+		t.Errorf("Unexpected installed .mprompt file:\n%s", mprompt)
+	}
+	vars, err := afero.ReadFile(fs, ".marvai/hello.var")
+	if err != nil {
+		t.Fatalf("Expected installed .var file: %v", err)
+	}
+	if strings.TrimSpace(string(vars)) != "language: Go" {
+		t.Errorf("Expected language: Go in .var file, got %q", string(vars))
+	}
+}
+
+func TestInstallMPromptFromSource(t *testing.T) {
+	fs := newInstallFs(t, map[string]string{"prompts/hello.mprompt": installPrompt})
+	answers, err := NewWizardAnswers(fs, []string{"language=Go"}, "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	opts := InstallOptions{Yes: true, Answers: answers, Runner: installRunner}
+	if err := InstallMPromptFromSourceWithOptions(fs, "./prompts/hello.mprompt", opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkInstalled(t, fs, "file")
+}
+
+func TestInstallMPromptFromDirRegistry(t *testing.T) {
+	fs := newInstallFs(t, map[string]string{
+		"/registry/PROMPTS":       "name: hello\nversion: 1.0.0\nfile: hello.mprompt\nsha256: " + templateHash("Write hello world in {{language}}.") + "\n",
+		"/registry/hello.mprompt": installPrompt,
+	})
+
+	// The registry spec picks the directory registry like --registry /registry
+	opts, err := newInstallOptions(fs, "", []string{"/registry"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, ok := opts.Registries[0].(*DirRegistry); !ok {
+		t.Fatalf("Expected a directory registry, got %T", opts.Registries[0])
+	}
+	opts.Yes = true
+	opts.Runner = installRunner
+	opts.Answers, err = NewWizardAnswers(fs, []string{"language=Go"}, "", nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if err := InstallMPromptByNameWithOptions(fs, "hello", "", opts); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkInstalled(t, fs, "distro")
+}
+
+func TestInstallMPromptNotInGitRepository(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	err := InstallMPromptFromSourceWithOptions(fs, "./prompts/hello.mprompt", InstallOptions{Runner: installRunner})
+	if err == nil || !strings.Contains(err.Error(), "not a git repository") {
+		t.Errorf("Expected not a git repository error, got %v", err)
+	}
+}
+
+func TestInstallMPromptNotInRegistries(t *testing.T) {
+	fs := newInstallFs(t, map[string]string{
+		"/company/PROMPTS": "name: review\nfile: review.mprompt\n",
+		"/public/PROMPTS":  "name: hello\nfile: hello.mprompt\n",
+	})
+	opts, err := newInstallOptions(fs, "", []string{"/company", "/public"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	opts.Runner = installRunner
+
+	err = InstallMPromptByNameWithOptions(fs, "missing", "", opts)
+	if err == nil || !strings.Contains(err.Error(), "'missing' not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+	if exists, _ := afero.Exists(fs, ".marvai/missing.mprompt"); exists {
+		t.Error("Expected nothing to be installed")
+	}
+}
@@ -0,0 +1,301 @@
+package marvai
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/marvai-dev/marvai/internal"
+)
+
+// LintSeverity is the severity of a lint diagnostic
+type LintSeverity string
+
+const (
+	LintError   LintSeverity = "error"
+	LintWarning LintSeverity = "warning"
+)
+
+// LintDiagnostic is a problem found in a .mprompt file at a 1-based line and column
+type LintDiagnostic struct {
+	Line     int
+	Column   int
+	Severity LintSeverity
+	Message  string
+}
+
+// String formats the diagnostic as line:column: severity: message
+func (d LintDiagnostic) String() string {
+	return fmt.Sprintf("%d:%d: %s: %s", d.Line, d.Column, d.Severity, d.Message)
+}
+
+var yamlErrorLineRegex = regexp.MustCompile(`line (\d+): (.*)`)
+
+// LintMPromptContent validates .mprompt content and returns diagnostics sorted by position
+func LintMPromptContent(content []byte) []LintDiagnostic {
+	linter := &mpromptLinter{}
+
+	// SECURITY: Limit file size to prevent memory exhaustion
+	if len(content) > 10*1024*1024 { // 10MB limit
+		linter.report(1, 1, LintError, "mprompt content too large (%d bytes), maximum allowed is 10MB", len(content))
+		return linter.diagnostics
+	}
+
+	sections, err := splitMPromptSections(string(content))
+	if err != nil {
+		var formatErr *MPromptFormatError
+		if errors.As(err, &formatErr) {
+			linter.report(formatErr.Line, 1, LintError, "%s", formatErr.Message)
+		} else {
+			linter.report(1, 1, LintError, "%v", err)
+		}
+		return linter.diagnostics
+	}
+
+	for _, line := range sections.DroppedSeparators {
+		linter.report(line, 1, LintWarning, "-- line is dropped from the template in format 1, use marvai convert to upgrade to format 2")
+	}
+
+	frontmatter := linter.lintFrontmatter(sections)
+	variables := linter.lintWizard(sections.Wizard)
+	partials := linter.lintPartials(sections.Partials)
+	linter.lintTemplate(sections.Template, variables, partials, frontmatter)
+	linter.lintCommands(sections, frontmatter)
+
+	sort.SliceStable(linter.diagnostics, func(i, j int) bool {
+		if linter.diagnostics[i].Line != linter.diagnostics[j].Line {
+			return linter.diagnostics[i].Line < linter.diagnostics[j].Line
+		}
+		return linter.diagnostics[i].Column < linter.diagnostics[j].Column
+	})
+
+	return linter.diagnostics
+}
+
+// mpromptLinter collects diagnostics while linting the sections of a .mprompt file
+type mpromptLinter struct {
+	diagnostics []LintDiagnostic
+}
+
+// lintedVariable is a wizard variable with the position of its definition
+type lintedVariable struct {
+	WizardVariable
+	Line   int
+	Column int
+}
+
+func (l *mpromptLinter) report(line, column int, severity LintSeverity, format string, args ...interface{}) {
+	l.diagnostics = append(l.diagnostics, LintDiagnostic{
+		Line:     line,
+		Column:   column,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// reportYAMLError reports a YAML error at the lines it refers to within a section
+func (l *mpromptLinter) reportYAMLError(section mpromptSection, name string, err error) {
+	matches := yamlErrorLineRegex.FindAllStringSubmatch(err.Error(), -1)
+	if len(matches) == 0 {
+		l.report(section.StartLine, 1, LintError, "%s YAML: %s", name, strings.TrimPrefix(err.Error(), "yaml: "))
+		return
+	}
+	for _, match := range matches {
+		line, _ := strconv.Atoi(match[1])
+		l.report(section.StartLine+line-1, 1, LintError, "%s YAML: %s", name, match[2])
+	}
+}
+
+// lintFrontmatter checks the frontmatter YAML and the declared format, and returns the frontmatter if it parses
+func (l *mpromptLinter) lintFrontmatter(sections mpromptSections) *MPromptFrontmatter {
+	section := sections.Frontmatter
+	frontmatterYaml := strings.Join(section.Lines, "\n")
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if len(frontmatterYaml) > 1024*1024 { // 1MB limit for frontmatter section
+		l.report(section.StartLine, 1, LintError, "frontmatter YAML section too large (%d bytes), maximum allowed is 1MB", len(frontmatterYaml))
+		return nil
+	}
+
+	var frontmatter MPromptFrontmatter
+	if err := yaml.Unmarshal([]byte(frontmatterYaml), &frontmatter); err != nil {
+		l.reportYAMLError(section, "frontmatter", err)
+		return nil
+	}
+
+	if err := validateMPromptFormat(sections, frontmatter); err != nil {
+		l.report(section.StartLine, 1, LintError, "%s", err.Error())
+	}
+	if err := internal.ValidateEscapeMode(frontmatter.Escape); err != nil {
+		l.report(section.StartLine, 1, LintError, "%s", err.Error())
+	}
+	if err := validateSharedPartials(sections, frontmatter); err != nil {
+		l.report(section.StartLine, 1, LintError, "%s", err.Error())
+	}
+	if err := validateCommands(frontmatter.Commands); err != nil {
+		l.report(section.StartLine, 1, LintError, "%s", err.Error())
+	}
+	return &frontmatter
+}
+
+// lintWizard checks the wizard YAML and each variable definition, and returns the valid variables
+func (l *mpromptLinter) lintWizard(section mpromptSection) []lintedVariable {
+	wizardYaml := strings.Join(section.Lines, "\n")
+	if strings.TrimSpace(wizardYaml) == "" {
+		return nil
+	}
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if len(wizardYaml) > 1024*1024 { // 1MB limit for YAML section
+		l.report(section.StartLine, 1, LintError, "wizard YAML section too large (%d bytes), maximum allowed is 1MB", len(wizardYaml))
+		return nil
+	}
+
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(wizardYaml), &document); err != nil {
+		l.reportYAMLError(section, "wizard", err)
+		return nil
+	}
+	if len(document.Content) == 0 {
+		return nil
+	}
+
+	root := document.Content[0]
+	if root.Kind != yaml.SequenceNode {
+		l.report(section.StartLine+root.Line-1, root.Column, LintError, "wizard section must be a list of variables")
+		return nil
+	}
+
+	if len(root.Content) > 100 { // Reasonable limit
+		l.report(section.StartLine+root.Line-1, root.Column, LintError, "too many wizard variables (%d), maximum allowed is 100", len(root.Content))
+	}
+
+	var variables []lintedVariable
+	earlier := make(map[string]bool)
+	for i, node := range root.Content {
+		line := section.StartLine + node.Line - 1
+
+		var variable WizardVariable
+		if err := node.Decode(&variable); err != nil {
+			l.reportYAMLError(section, "wizard", err)
+			continue
+		}
+
+		if err := validateWizardVariable(i, variable); err != nil {
+			l.report(line, node.Column, LintError, "%s", err.Error())
+			continue
+		}
+		if err := validateWhenReferences(i, variable, earlier); err != nil {
+			l.report(line, node.Column, LintError, "%s", err.Error())
+		}
+		earlier[variable.ID] = true
+
+		variables = append(variables, lintedVariable{WizardVariable: variable, Line: line, Column: node.Column})
+	}
+
+	return variables
+}
+
+// lintPartials checks the partial sections like the template, and returns the partials by name
+func (l *mpromptLinter) lintPartials(sections []*mpromptPartial) map[string]string {
+	partials := make(map[string]string)
+	for _, section := range sections {
+		partial := strings.Join(section.Lines, "\n")
+		partials[section.Name] = partial
+
+		for _, issue := range internal.FindDangerousPatterns(partial) {
+			l.report(section.StartLine+issue.Line-1, issue.Column, LintError, "partial %q contains dangerous pattern: %q", section.Name, issue.Pattern)
+		}
+		for _, used := range internal.FindPartials(partial) {
+			l.report(section.StartLine+used.Line-1, used.Column, LintError, "partial %q uses partial %q, partials can't use partials", section.Name, used.Name)
+		}
+		if _, err := internal.TemplateReferences(partial); err != nil {
+			var templateErr *internal.TemplateError
+			if errors.As(err, &templateErr) {
+				l.report(section.StartLine+templateErr.Line-1, templateErr.Column, LintError, "partial %q parse error: %s", section.Name, templateErr.Message)
+			} else {
+				l.report(section.StartLine, 1, LintError, "partial %q parse error: %v", section.Name, err)
+			}
+		}
+	}
+	return partials
+}
+
+// lintCommands reports exec calls of the template and the partials with commands the frontmatter doesn't declare
+func (l *mpromptLinter) lintCommands(sections mpromptSections, frontmatter *MPromptFrontmatter) {
+	declared := make(map[string]bool)
+	if frontmatter != nil {
+		for _, command := range frontmatter.Commands {
+			declared[command] = true
+		}
+	}
+
+	for _, used := range internal.FindCommands(strings.Join(sections.Template.Lines, "\n")) {
+		if !declared[used.Command] {
+			l.report(sections.Template.StartLine+used.Line-1, used.Column, LintError, "template runs command %q, which is not listed in commands", used.Command)
+		}
+	}
+	for _, section := range sections.Partials {
+		for _, used := range internal.FindCommands(strings.Join(section.Lines, "\n")) {
+			if !declared[used.Command] {
+				l.report(section.StartLine+used.Line-1, used.Column, LintError, "partial %q runs command %q, which is not listed in commands", section.Name, used.Command)
+			}
+		}
+	}
+}
+
+// lintTemplate checks the Handlebars template, its variables against the wizard, its partials and dangerous patterns
+func (l *mpromptLinter) lintTemplate(section mpromptSection, variables []lintedVariable, partials map[string]string, frontmatter *MPromptFrontmatter) {
+	template := strings.Join(section.Lines, "\n")
+
+	for _, issue := range internal.FindDangerousPatterns(template) {
+		l.report(section.StartLine+issue.Line-1, issue.Column, LintError, "template contains dangerous pattern: %q", issue.Pattern)
+	}
+
+	shared := make(map[string]bool)
+	if frontmatter != nil {
+		for _, name := range frontmatter.Partials {
+			shared[name] = true
+		}
+	}
+	for _, used := range internal.FindPartials(template) {
+		if _, ok := partials[used.Name]; !ok && !shared[used.Name] {
+			l.report(section.StartLine+used.Line-1, used.Column, LintError, "template uses partial %q, which is neither a partial section nor listed in partials", used.Name)
+		}
+	}
+
+	references, err := internal.TemplateReferencesWithPartials(template, partials)
+	if err != nil {
+		var templateErr *internal.TemplateError
+		if errors.As(err, &templateErr) {
+			l.report(section.StartLine+templateErr.Line-1, templateErr.Column, LintError, "template parse error: %s", templateErr.Message)
+		} else {
+			l.report(section.StartLine, 1, LintError, "template parse error: %v", err)
+		}
+		return
+	}
+
+	defined := map[string]bool{contextNamespace: true}
+	for _, variable := range variables {
+		defined[variable.ID] = true
+	}
+
+	used := make(map[string]bool)
+	for _, reference := range references {
+		if !defined[reference.Name] && !used[reference.Name] {
+			l.report(section.StartLine+reference.Line-1, reference.Column, LintWarning, "template variable %q has no wizard definition", reference.Name)
+		}
+		used[reference.Name] = true
+	}
+
+	for _, variable := range variables {
+		if !used[variable.ID] {
+			l.report(variable.Line, variable.Column, LintWarning, "wizard variable %q is not used in the template", variable.ID)
+		}
+	}
+}
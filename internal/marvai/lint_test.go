@@ -0,0 +1,260 @@
+package marvai
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLintMPromptContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected []string
+	}{
+		{
+			name: "valid prompt",
+			content: `name: Hello
+--
+- id: language
+  description: For what language
+--
+Write hello world in {{language}}.`,
+			expected: nil,
+		},
+		{
+			name: "frontmatter YAML error",
+			content: `name: Hello
+description: [unclosed
+--
+--
+Template`,
+			expected: []string{"error: frontmatter YAML"},
+		},
+		{
+			name: "invalid wizard variable",
+			content: `name: Hello
+--
+- id: language
+  description: Language
+- id: "bad id"
+  description: Bad
+--
+{{language}}`,
+			expected: []string{"5:3: error: variable 1 has invalid ID"},
+		},
+		{
+			name: "unknown escape mode",
+			content: `name: Hello
+escape: latex
+--
+--
+Hello`,
+			expected: []string{`1:1: error: unsupported escape mode "latex"`},
+		},
+		{
+			name: "dangerous words in prose",
+			content: `name: Hello
+--
+- id: language
+  description: Language
+--
+Refactor the constructor in {{language}}.`,
+			expected: nil,
+		},
+		{
+			name: "runtime context",
+			content: `name: Hello
+--
+- id: language
+  description: Language
+--
+Write {{language}} on {{marvai.git.branch}}.`,
+			expected: nil,
+		},
+		{
+			name: "variable named like the runtime context",
+			content: `name: Hello
+--
+- id: marvai
+  description: Reserved
+--
+{{marvai}}`,
+			expected: []string{`3:3: error: variable 0 ID "marvai" is reserved for the runtime context`},
+		},
+		{
+			name: "variable named like a helper",
+			content: `name: Hello
+--
+- id: date
+  description: Release date
+--
+{{date}}`,
+			expected: []string{`3:3: error: variable 0 ID "date" is the name of a template helper`},
+		},
+		{
+			name: "unsupported wizard type",
+			content: `name: Hello
+--
+- id: language
+  description: Language
+  type: number
+--
+{{language}}`,
+			expected: []string{"3:3: error: variable 0 has unsupported type"},
+		},
+		{
+			name: "when references later variable",
+			content: `name: Hello
+--
+- id: framework
+  description: Framework
+  when: language == "go"
+- id: language
+  description: Language
+--
+{{language}} {{framework}}`,
+			expected: []string{`3:3: error: variable 0 when condition references "language"`},
+		},
+		{
+			name: "template parse error",
+			content: `name: Hello
+--
+--
+first line
+{{#if flag}}
+unclosed`,
+			expected: []string{"error: template parse error"},
+		},
+		{
+			name: "undefined and unused variables",
+			content: `name: Hello
+--
+- id: language
+  description: Language
+- id: unused
+  description: Unused
+--
+Write in {{language}}
+for {{  audience}}.
+{{#each (split items ",")}}{{this}} {{../language}}{{/each}}`,
+			expected: []string{
+				`5:3: warning: wizard variable "unused" is not used in the template`,
+				`9:9: warning: template variable "audience" has no wizard definition`,
+				`10:16: warning: template variable "items" has no wizard definition`,
+			},
+		},
+		{
+			name: "dropped format 1 separator",
+			content: `name: Hello
+--
+--
+Intro
+--
+Outro`,
+			expected: []string{"5:1: warning: -- line is dropped from the template in format 1"},
+		},
+		{
+			name:     "format 2 unknown section",
+			content:  "@@@ frontmatter\nformat: 2\n@@@ wizzard\n@@@ template\nHello",
+			expected: []string{"3:1: error: unknown section"},
+		},
+		{
+			name: "dangerous pattern",
+			content: `name: Hello
+--
+--
+Line one
+Call {{constructor}}`,
+			expected: []string{`5:8: error: template contains dangerous pattern: "constructor"`},
+		},
+		{
+			name:     "partials",
+			content:  "@@@ frontmatter\nformat: 2\npartials: [shared]\n@@@ wizard\n- id: language\n  description: Language\n@@@ partial standards\nUse {{language}}.\n@@@ template\n{{> standards}} {{> shared}}",
+			expected: nil,
+		},
+		{
+			name:    "partial problems",
+			content: "@@@ frontmatter\nformat: 2\n@@@ partial nested\n{{> other}}\n@@@ partial unsafe\n{{constructor}}\n@@@ template\n{{> nested}} {{> unknown}}",
+			expected: []string{
+				`4:1: error: partial "nested" uses partial "other"`,
+				`6:3: error: partial "unsafe" contains dangerous pattern: "constructor"`,
+				`8:14: error: template uses partial "unknown", which is neither a partial section nor listed in partials`,
+			},
+		},
+		{
+			name:    "commands",
+			content: "@@@ frontmatter\nformat: 2\ncommands: [\"go list ./...\"]\n@@@ partial tests\n{{exec \"go test ./...\"}}\n@@@ template\n{{exec \"go list ./...\"}}\n{{exec \"rm -rf /\"}}\n{{exec command}}",
+			expected: []string{
+				`5:1: error: partial "tests" runs command "go test ./...", which is not listed in commands`,
+				`8:1: error: template runs command "rm -rf /", which is not listed in commands`,
+				`9:1: error: template contains dangerous pattern: "{{exec"`,
+			},
+		},
+		{
+			name:     "invalid commands",
+			content:  "@@@ frontmatter\nformat: 2\ncommands: [\"go test\", \"go test\"]\n@@@ template\nHello",
+			expected: []string{`2:1: error: duplicate command "go test"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			diagnostics := LintMPromptContent([]byte(tt.content))
+
+			var actual []string
+			for _, diagnostic := range diagnostics {
+				actual = append(actual, diagnostic.String())
+			}
+
+			if len(tt.expected) == 0 && len(actual) > 0 {
+				t.Fatalf("Expected no diagnostics, got %v", actual)
+			}
+
+			for _, expected := range tt.expected {
+				found := false
+				for _, diagnostic := range actual {
+					if strings.Contains(diagnostic, expected) {
+						found = true
+						break
+					}
+				}
+				if !found {
+					t.Errorf("Expected diagnostic containing %q, got %v", expected, actual)
+				}
+			}
+		})
+	}
+}
+
+func TestLintMPromptFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "good.mprompt", []byte("name: Good\n--\n--\nHello"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := afero.WriteFile(fs, "bad.mprompt", []byte("name: Bad\n--\n--\n{{#if x}}"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := LintMPromptFiles(fs, []string{"good.mprompt"}, &output); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "good.mprompt: no problems found") {
+		t.Errorf("Unexpected output: %q", output.String())
+	}
+
+	output.Reset()
+	if err := LintMPromptFiles(fs, []string{"bad.mprompt"}, &output); err == nil {
+		t.Error("Expected error for file with problems")
+	}
+	if !strings.HasPrefix(output.String(), "bad.mprompt:") {
+		t.Errorf("Expected diagnostics prefixed with file name, got %q", output.String())
+	}
+
+	if err := LintMPromptFiles(fs, []string{"missing.mprompt"}, &output); err == nil {
+		t.Error("Expected error for missing file")
+	}
+}
@@ -89,6 +89,18 @@ func LogPromptInstall(fs afero.Fs, promptName string, repo string, success bool)
 	return LogToMarvaiLog(fs, LogActionInstallPrompt, promptName, details)
 }
 
+// LogPromptInstallFromSource logs a prompt installation event from a local file or URL
+func LogPromptInstallFromSource(fs afero.Fs, promptName string, sourceType string, location string, success bool) error {
+	var details string
+	if success {
+		details = fmt.Sprintf("Successfully installed from %s: %s", sourceType, location)
+	} else {
+		details = fmt.Sprintf("Installation from %s failed: %s", sourceType, location)
+	}
+
+	return LogToMarvaiLog(fs, LogActionInstallPrompt, promptName, details)
+}
+
 // LogPromptExecution logs a prompt execution event
 func LogPromptExecution(fs afero.Fs, promptName string, cliTool string, success bool) error {
 	var details string
@@ -1,22 +1,21 @@
 package marvai
 
 import (
-	"bufio"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
-	"time"
 
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 
 	"github.com/marvai-dev/marvai/internal"
+	"github.com/marvai-dev/marvai/internal/source"
 )
 
 // ValidatePromptName validates that a prompt name is safe to use
@@ -42,6 +41,14 @@ func ValidatePromptName(promptName string) error {
 		return fmt.Errorf("prompt name cannot contain '\\'")
 	}
 
+	// The project and local variable files share the .marvai directory with the prompts
+	if promptName == "project" {
+		return fmt.Errorf("prompt name %q is reserved", promptName)
+	}
+	if strings.HasSuffix(promptName, ".local") {
+		return fmt.Errorf("prompt name cannot end with '.local'")
+	}
+
 	// Check for control characters
 	for _, r := range promptName {
 		if r < 32 || r == 127 {
@@ -54,8 +61,87 @@ func ValidatePromptName(promptName string) error {
 
 // LoadPrompt loads and templates a prompt from .mprompt and .var files in the .marvai directory
 func LoadPrompt(fs afero.Fs, promptName string) ([]byte, error) {
+	return LoadPromptWithOptions(fs, promptName, PromptOptions{HomeDir: userHomeDir()})
+}
+
+// LoadPromptWithOptions loads and templates a prompt with the variables resolved from all .var layers and the overrides
+func LoadPromptWithOptions(fs afero.Fs, promptName string, opts PromptOptions) ([]byte, error) {
+	prompt, err := renderPrompt(fs, promptName, opts)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(prompt.Content), nil
+}
+
+// renderedPrompt is a templated prompt with the values it was templated with
+type renderedPrompt struct {
+	Content string
+	Data    *MPromptData
+	Values  map[string]interface{}
+}
+
+// redacted returns the prompt with the values of secret variables replaced
+func (p *renderedPrompt) redacted() string {
+	return redactSecrets(p.Content, p.Data.Variables, p.Values)
+}
+
+// renderPrompt templates an installed prompt with its resolved variables and the runtime context
+func renderPrompt(fs afero.Fs, promptName string, opts PromptOptions) (*renderedPrompt, error) {
+	data, _, err := loadInstalledPrompt(fs, promptName)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateOverrides(data.Variables, opts.Overrides); err != nil {
+		return nil, err
+	}
+
+	resolved, err := ResolveVars(fs, promptName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	values, err := resolveSecrets(fs, opts.HomeDir, data.Variables, resolvedValues(resolved))
+	if err != nil {
+		return nil, err
+	}
+
+	// Template the prompt with the variables and the runtime context, which the variables can't shadow
+	templateValues := normalizeVarValues(fs, data.Variables, values)
+	if usesRuntimeContext(data.Template, data.Partials) {
+		templateValues = withRuntimeContext(templateValues, runtimeContext(promptName, data, opts))
+	} else {
+		delete(templateValues, contextNamespace)
+	}
+	if data.Frontmatter.isStrict() {
+		if err := checkMissingVariables(promptName, data, templateValues); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkCommandsApproved(fs, opts.HomeDir, promptName, data); err != nil {
+		return nil, err
+	}
+	runner := opts.Runner
+	if runner == nil {
+		runner = OSCommandRunner{}
+	}
+	finalPrompt, err := internal.RenderTemplateWithOptions(data.Template, templateValues, internal.RenderOptions{
+		Escape:   data.Frontmatter.Escape,
+		Partials: data.Partials,
+		Repo:     newGitRepo(fs, runner),
+		Exec:     newCommandExec(runner, data.Frontmatter.Commands),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error templating prompt: %s", redactSecrets(err.Error(), data.Variables, values))
+	}
+
+	return &renderedPrompt{Content: finalPrompt, Data: data, Values: values}, nil
+}
+
+// loadInstalledPrompt parses an installed .mprompt file and returns it with the path of its .var file
+func loadInstalledPrompt(fs afero.Fs, promptName string) (*MPromptData, string, error) {
 	if err := ValidatePromptName(promptName); err != nil {
-		return nil, fmt.Errorf("invalid prompt name: %w", err)
+		return nil, "", fmt.Errorf("invalid prompt name: %w", err)
 	}
 
 	mpromptFile := filepath.Join(".marvai", promptName+".mprompt")
@@ -63,49 +149,65 @@ func LoadPrompt(fs afero.Fs, promptName string) ([]byte, error) {
 
 	// SECURITY: Prevent symlink attacks by checking if files are symlinks
 	if err := validateFileIsNotSymlink(fs, mpromptFile); err != nil {
-		return nil, fmt.Errorf("security error: %w", err)
+		return nil, "", fmt.Errorf("security error: %w", err)
 	}
 	if err := validateFileIsNotSymlink(fs, varFile); err != nil {
-		return nil, fmt.Errorf("security error: %w", err)
+		return nil, "", fmt.Errorf("security error: %w", err)
 	}
 
 	// SECURITY: Ensure the resolved paths are still within .marvai directory
 	if err := validateFileWithinMarvaiDirectory(mpromptFile); err != nil {
-		return nil, fmt.Errorf("security error: %w", err)
+		return nil, "", fmt.Errorf("security error: %w", err)
 	}
 	if err := validateFileWithinMarvaiDirectory(varFile); err != nil {
-		return nil, fmt.Errorf("security error: %w", err)
+		return nil, "", fmt.Errorf("security error: %w", err)
 	}
 
 	// Load and parse the .mprompt file
 	content, err := afero.ReadFile(fs, mpromptFile)
 	if err != nil {
-		return nil, fmt.Errorf("error reading .mprompt file: %w", err)
+		return nil, "", fmt.Errorf("error reading .mprompt file: %w", err)
 	}
 
 	data, err := ParseMPromptContent(content, mpromptFile)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing .mprompt file: %w", err)
+		return nil, "", fmt.Errorf("error parsing .mprompt file: %w", err)
 	}
 
-	// Load variables from .var file if it exists
-	var values map[string]string
-	if varContent, err := afero.ReadFile(fs, varFile); err == nil {
-		if err := yaml.Unmarshal(varContent, &values); err != nil {
-			return nil, fmt.Errorf("error parsing .var file: %w", err)
-		}
-	} else {
-		// No .var file exists, use empty values
-		values = make(map[string]string)
+	return data, varFile, nil
+}
+
+// writeFileAtomic writes a file through a temporary file and a rename, so readers never see a partial file
+func writeFileAtomic(fs afero.Fs, filePath string, data []byte, perm os.FileMode) error {
+	// SECURITY: Prevent symlink attacks, the file would be written where the link points on some filesystems
+	if err := validateFileIsNotSymlink(fs, filePath); err != nil {
+		return fmt.Errorf("security error: %w", err)
 	}
 
-	// Template the prompt with the variables
-	finalPrompt, err := SubstituteVariables(data.Template, values)
+	// SECURITY: The temporary file has a random name and is created exclusively, so it can't be prepared as a symlink
+	tmp, err := afero.TempFile(fs, filepath.Dir(filePath), "."+filepath.Base(filePath)+".*.tmp")
 	if err != nil {
-		return nil, fmt.Errorf("error templating prompt: %w", err)
+		return fmt.Errorf("error creating temporary file for %s: %w", filePath, err)
 	}
+	tmpFile := tmp.Name()
 
-	return []byte(finalPrompt), nil
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Chmod(tmpFile, perm)
+	}
+	if err == nil {
+		err = fs.Rename(tmpFile, filePath)
+	}
+	if err != nil {
+		if removeErr := fs.Remove(tmpFile); removeErr != nil {
+			fmt.Printf("Warning: failed to remove temporary file: %v\n", removeErr)
+		}
+		return fmt.Errorf("error replacing %s: %w", filePath, err)
+	}
+	return nil
 }
 
 // validateFileIsNotSymlink checks if a file is a symbolic link
@@ -125,6 +227,30 @@ func validateFileIsNotSymlink(fs afero.Fs, filePath string) error {
 	return nil
 }
 
+// validatePathHasNoSymlinks checks a file and every directory on the way to it below base for symbolic links,
+// a symlinked directory would lead outside of base like a symlinked file. An empty base is the current directory
+func validatePathHasNoSymlinks(fs afero.Fs, base string, filePath string) error {
+	relPath := filepath.Clean(filePath)
+	if base != "" {
+		var err error
+		if relPath, err = filepath.Rel(base, filePath); err != nil {
+			return err
+		}
+	}
+	if relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("file %q is outside of %q", filePath, base)
+	}
+
+	current := base
+	for _, part := range strings.Split(relPath, string(filepath.Separator)) {
+		current = filepath.Join(current, part)
+		if err := validateFileIsNotSymlink(fs, current); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // validateFileWithinMarvaiDirectory ensures the file path resolves within .marvai
 func validateFileWithinMarvaiDirectory(filePath string) error {
 	// Clean the path to resolve any .. or . components
@@ -145,20 +271,39 @@ func validateFileWithinMarvaiDirectory(filePath string) error {
 
 // WizardVariable represents a variable in the wizard section
 type WizardVariable struct {
-	ID          string `yaml:"id"`
-	Description string `yaml:"description"`
-	Type        string `yaml:"type"`
-	Required    bool   `yaml:"required"`
+	ID           string      `yaml:"id"`
+	Description  string      `yaml:"description"`
+	Help         string      `yaml:"help,omitempty"`
+	Type         string      `yaml:"type"`
+	Required     bool        `yaml:"required"`
+	Options      []string    `yaml:"options,omitempty"`
+	Min          *int        `yaml:"min,omitempty"`
+	Max          *int        `yaml:"max,omitempty"`
+	Pattern      string      `yaml:"pattern,omitempty"`
+	MinLength    *int        `yaml:"min_length,omitempty"`
+	MaxLength    *int        `yaml:"max_length,omitempty"`
+	ErrorMessage string      `yaml:"error_message,omitempty"`
+	Default      interface{} `yaml:"default,omitempty"`
+	DefaultFrom  string      `yaml:"default_from,omitempty"`
+	When         string      `yaml:"when,omitempty"`
+	Secret       bool        `yaml:"secret,omitempty"`
 }
 
 // MPromptFrontmatter represents the frontmatter section of a .mprompt file
 type MPromptFrontmatter struct {
+	Format      int    `yaml:"format,omitempty"`
 	Name        string `yaml:"name"`
 	Description string `yaml:"description"`
 	Author      string `yaml:"author"`
 	Version     string `yaml:"version"`
 	File        string `yaml:"file,omitempty"`
 	Source      string `yaml:"source,omitempty"`
+	Strict      *bool  `yaml:"strict,omitempty"`
+	Escape      string `yaml:"escape,omitempty"`
+	// Partials are partials published in the registry repo of the prompt, install adds them as partial sections
+	Partials []string `yaml:"partials,omitempty"`
+	// Commands are the commands the template can run with {{exec}} once the user approves them
+	Commands []string `yaml:"commands,omitempty"`
 }
 
 // PromptEntry represents an entry in the PROMPTS manifest file
@@ -169,6 +314,8 @@ type PromptEntry struct {
 	Version     string `yaml:"version"`
 	File        string `yaml:"file"`
 	SHA256      string `yaml:"sha256,omitempty"`
+	// Partials are the SHA256 hashes of the partials of the prompt by name
+	Partials map[string]string `yaml:"partials,omitempty"`
 }
 
 // MPromptData represents the parsed .mprompt file
@@ -176,6 +323,8 @@ type MPromptData struct {
 	Frontmatter MPromptFrontmatter
 	Variables   []WizardVariable
 	Template    string
+	// Partials are the partial sections by name
+	Partials map[string]string
 }
 
 // ParseMPrompt parses a .mprompt file and separates wizard and template sections with security controls
@@ -199,38 +348,20 @@ func ParseMPrompt(fs afero.Fs, filename string) (*MPromptData, error) {
 }
 
 // ParseMPromptContent parses .mprompt content directly (for use with source handlers)
-// Format: frontmatter -- wizard variables -- template
+// Format 1: frontmatter -- wizard variables -- template, format 2: @@@ section markers
 func ParseMPromptContent(content []byte, displayName string) (*MPromptData, error) {
 	// SECURITY: Limit file size to prevent memory exhaustion
 	if len(content) > 10*1024*1024 { // 10MB limit
 		return nil, fmt.Errorf("mprompt content too large (%d bytes), maximum allowed is 10MB", len(content))
 	}
 
-	lines := strings.Split(string(content), "\n")
-	var frontmatterLines []string
-	var wizardLines []string
-	var templateLines []string
-
-	section := 0 // 0=frontmatter, 1=wizard, 2=template
-
-	for _, line := range lines {
-		if strings.TrimSpace(line) == "--" {
-			section++
-			continue
-		}
-
-		switch section {
-		case 0:
-			frontmatterLines = append(frontmatterLines, line)
-		case 1:
-			wizardLines = append(wizardLines, line)
-		case 2:
-			templateLines = append(templateLines, line)
-		default:
-			// More than 2 separators - treat as part of template
-			templateLines = append(templateLines, line)
-		}
+	sections, err := splitMPromptSections(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("invalid sections in %s: %w", displayName, err)
 	}
+	frontmatterLines := sections.Frontmatter.Lines
+	wizardLines := sections.Wizard.Lines
+	templateLines := sections.Template.Lines
 
 	// Parse frontmatter
 	var frontmatter MPromptFrontmatter
@@ -247,6 +378,19 @@ func ParseMPromptContent(content []byte, displayName string) (*MPromptData, erro
 		}
 	}
 
+	if err := validateMPromptFormat(sections, frontmatter); err != nil {
+		return nil, fmt.Errorf("invalid format in %s: %w", displayName, err)
+	}
+	if err := internal.ValidateEscapeMode(frontmatter.Escape); err != nil {
+		return nil, fmt.Errorf("invalid frontmatter in %s: %w", displayName, err)
+	}
+	if err := validateSharedPartials(sections, frontmatter); err != nil {
+		return nil, fmt.Errorf("invalid frontmatter in %s: %w", displayName, err)
+	}
+	if err := validateCommands(frontmatter.Commands); err != nil {
+		return nil, fmt.Errorf("invalid frontmatter in %s: %w", displayName, err)
+	}
+
 	// Parse wizard variables
 	var variables []WizardVariable
 	if len(wizardLines) > 0 {
@@ -271,10 +415,23 @@ func ParseMPromptContent(content []byte, displayName string) (*MPromptData, erro
 	template := strings.Join(templateLines, "\n")
 	template = strings.TrimSpace(template)
 
+	var partials map[string]string
+	for _, partial := range sections.Partials {
+		if partials == nil {
+			partials = make(map[string]string)
+		}
+		// Partials keep their final newline like a file, so a {{> name}} line renders as a line
+		partials[partial.Name] = ""
+		if lines := trimBlankLines(partial.Lines); len(lines) > 0 {
+			partials[partial.Name] = strings.Join(lines, "\n") + "\n"
+		}
+	}
+
 	return &MPromptData{
 		Frontmatter: frontmatter,
 		Variables:   variables,
 		Template:    template,
+		Partials:    partials,
 	}, nil
 }
 
@@ -321,20 +478,102 @@ func validateWizardVariables(variables []WizardVariable) error {
 		return fmt.Errorf("too many wizard variables (%d), maximum allowed is 100", len(variables))
 	}
 
+	earlier := make(map[string]bool)
 	for i, variable := range variables {
-		// SECURITY: Validate variable ID
-		if !isValidVariableNameLocal(variable.ID) {
-			return fmt.Errorf("variable %d has invalid ID: %q", i, variable.ID)
+		if err := validateWizardVariable(i, variable); err != nil {
+			return err
 		}
+		// Conditions can only depend on answers that were given before
+		if err := validateWhenReferences(i, variable, earlier); err != nil {
+			return err
+		}
+		earlier[variable.ID] = true
+	}
+
+	return nil
+}
+
+// validateWizardVariable validates a single wizard variable definition for security
+func validateWizardVariable(i int, variable WizardVariable) error {
+	// SECURITY: Validate variable ID
+	if !isValidVariableNameLocal(variable.ID) {
+		return fmt.Errorf("variable %d has invalid ID: %q", i, variable.ID)
+	}
 
-		// SECURITY: Limit description length
-		if len(variable.Description) > 1000 {
-			return fmt.Errorf("variable %d description too long: %d characters", i, len(variable.Description))
+	if variable.ID == contextNamespace {
+		return fmt.Errorf("variable %d ID %q is reserved for the runtime context", i, variable.ID)
+	}
+
+	// Helpers take precedence over values in templates, {{date}} would call the helper
+	if internal.IsHelperName(variable.ID) {
+		return fmt.Errorf("variable %d ID %q is the name of a template helper", i, variable.ID)
+	}
+
+	// SECURITY: Limit description length
+	if len(variable.Description) > 1000 {
+		return fmt.Errorf("variable %d description too long: %d characters", i, len(variable.Description))
+	}
+
+	// SECURITY: Limit help text length
+	if len(variable.Help) > 2000 {
+		return fmt.Errorf("variable %d help too long: %d characters", i, len(variable.Help))
+	}
+
+	// SECURITY: Validate variable type
+	if !isWizardVariableType(variable.Type) {
+		return fmt.Errorf("variable %d has unsupported type: %q", i, variable.Type)
+	}
+
+	variableType := variable.variableType()
+	if variableType == VarTypeChoice {
+		if len(variable.Options) == 0 {
+			return fmt.Errorf("variable %d of type choice needs options", i)
+		}
+		if len(variable.Options) > 100 { // Reasonable limit
+			return fmt.Errorf("variable %d has too many options (%d), maximum allowed is 100", i, len(variable.Options))
+		}
+		seen := make(map[string]bool)
+		for _, option := range variable.Options {
+			if strings.TrimSpace(option) == "" {
+				return fmt.Errorf("variable %d has an empty option", i)
+			}
+			if seen[option] {
+				return fmt.Errorf("variable %d has duplicate option: %q", i, option)
+			}
+			seen[option] = true
 		}
+	} else if len(variable.Options) > 0 {
+		return fmt.Errorf("variable %d has options but is not of type choice", i)
+	}
 
-		// SECURITY: Validate variable type
-		if variable.Type != "" && variable.Type != "string" {
-			return fmt.Errorf("variable %d has unsupported type: %q", i, variable.Type)
+	if variableType == VarTypeInt {
+		if variable.Min != nil && variable.Max != nil && *variable.Min > *variable.Max {
+			return fmt.Errorf("variable %d has min %d greater than max %d", i, *variable.Min, *variable.Max)
+		}
+	} else if variable.Min != nil || variable.Max != nil {
+		return fmt.Errorf("variable %d has min or max but is not of type int", i)
+	}
+
+	if err := validateTextRules(i, variable); err != nil {
+		return err
+	}
+
+	// Path defaults are checked against the repository when they are used
+	if variable.Default != nil && variableType != VarTypePath {
+		if _, err := parseVarValue(nil, variable, variable.Default); err != nil {
+			return fmt.Errorf("variable %d has invalid default: %w", i, err)
+		}
+	}
+
+	if variable.DefaultFrom != "" {
+		if err := validateDefaultFrom(variable.DefaultFrom); err != nil {
+			return fmt.Errorf("variable %d has invalid default_from: %w", i, err)
+		}
+	}
+
+	if strings.TrimSpace(variable.When) != "" {
+		if _, _, err := parseWhen(variable.When); err != nil {
+			return fmt.Errorf("variable %d has invalid when: %w", i, err)
 		}
 	}
 
@@ -369,98 +608,16 @@ func isValidVariableNameLocal(name string) bool {
 	return true
 }
 
-// ExecuteWizard prompts the user for variable values
-func ExecuteWizard(variables []WizardVariable) (map[string]string, error) {
-	return ExecuteWizardWithReader(variables, os.Stdin)
-}
-
-// ExecuteWizardWithReader prompts the user for variable values using the provided reader
-func ExecuteWizardWithReader(variables []WizardVariable, reader io.Reader) (map[string]string, error) {
-	if reader == nil {
-		return nil, fmt.Errorf("reader cannot be nil")
-	}
-
-	values := make(map[string]string)
-	scanner := bufio.NewScanner(reader)
-
-	for _, variable := range variables {
-		fmt.Print(variable.Description + "? ")
-		if scanner.Scan() {
-			response := strings.TrimSpace(scanner.Text())
-			if variable.Required && response == "" {
-				return nil, fmt.Errorf("variable '%s' is required", variable.ID)
-			}
-			values[variable.ID] = response
-		} else {
-			if err := scanner.Err(); err != nil {
-				return nil, fmt.Errorf("error reading input for variable '%s': %w", variable.ID, err)
-			}
-			// Handle EOF case - treat as empty input
-			if variable.Required {
-				return nil, fmt.Errorf("variable '%s' is required but EOF encountered", variable.ID)
-			}
-			values[variable.ID] = ""
-		}
-	}
-
-	return values, nil
-}
-
-// ExecuteWizardWithPrefills prompts the user for variable values with prefilled defaults
-func ExecuteWizardWithPrefills(variables []WizardVariable, prefillValues map[string]string) (map[string]string, error) {
-	return ExecuteWizardWithPrefilledReader(variables, prefillValues, os.Stdin)
-}
-
-// ExecuteWizardWithPrefilledReader prompts the user for variable values with prefilled defaults using a custom reader
-func ExecuteWizardWithPrefilledReader(variables []WizardVariable, prefillValues map[string]string, reader io.Reader) (map[string]string, error) {
-	values := make(map[string]string)
-	scanner := bufio.NewScanner(reader)
-
-	for _, variable := range variables {
-		// Get existing value if available
-		existingValue, hasExisting := prefillValues[variable.ID]
-
-		// Show prompt with existing value
-		if hasExisting && existingValue != "" {
-			fmt.Printf("%s [%s]: ", variable.Description, existingValue)
-		} else {
-			fmt.Printf("%s: ", variable.Description)
-		}
-
-		if scanner.Scan() {
-			response := strings.TrimSpace(scanner.Text())
-
-			// If user just pressed Enter, use existing value
-			if response == "" && hasExisting {
-				values[variable.ID] = existingValue
-			} else if response == "" && variable.Required {
-				return nil, fmt.Errorf("variable '%s' is required", variable.ID)
-			} else {
-				values[variable.ID] = response
-			}
-		} else {
-			if err := scanner.Err(); err != nil {
-				return nil, fmt.Errorf("error reading input for variable '%s': %w", variable.ID, err)
-			}
-			// Handle EOF case - use existing value if available
-			if hasExisting {
-				values[variable.ID] = existingValue
-			} else if variable.Required {
-				return nil, fmt.Errorf("variable '%s' is required but EOF encountered", variable.ID)
-			} else {
-				values[variable.ID] = ""
-			}
-		}
-	}
-
-	return values, nil
-}
-
 // SubstituteVariables uses Handlebars templating to replace variables
 func SubstituteVariables(template string, values map[string]string) (string, error) {
 	return internal.RenderTemplate(template, values)
 }
 
+// SubstituteValues uses Handlebars templating to replace variables with typed values
+func SubstituteValues(template string, values map[string]interface{}) (string, error) {
+	return internal.RenderTemplateData(template, values)
+}
+
 // findPromptByName searches for a prompt by name in the list of prompt entries
 func findPromptByName(prompts []PromptEntry, name string) (PromptEntry, error) {
 	name = strings.ToLower(strings.TrimSpace(name))
@@ -482,29 +639,21 @@ func findPromptByName(prompts []PromptEntry, name string) (PromptEntry, error) {
 
 // injectSourceIntoMPrompt adds the source field to the frontmatter of a .mprompt file content
 func injectSourceIntoMPrompt(content []byte, sourceType string) ([]byte, error) {
-	lines := strings.Split(string(content), "\n")
-	var result []string
-	frontmatterLines := []string{}
-
-	i := 0
-	// Collect frontmatter lines
-	for i < len(lines) {
-		line := lines[i]
-		if strings.TrimSpace(line) == "--" {
-			break
-		}
-		frontmatterLines = append(frontmatterLines, line)
-		i++
+	sections, err := splitMPromptSections(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing sections: %w", err)
 	}
 
+	lines := strings.Split(string(content), "\n")
+	frontmatterStart := sections.Frontmatter.StartLine - 1
+	frontmatterEnd := frontmatterStart + len(sections.Frontmatter.Lines)
+
 	// Parse existing frontmatter
 	var frontmatter MPromptFrontmatter
-	if len(frontmatterLines) > 0 {
-		frontmatterYaml := strings.Join(frontmatterLines, "\n")
-		if frontmatterYaml != "" {
-			if err := yaml.Unmarshal([]byte(frontmatterYaml), &frontmatter); err != nil {
-				return nil, fmt.Errorf("error parsing frontmatter YAML: %w", err)
-			}
+	frontmatterYaml := strings.Join(sections.Frontmatter.Lines, "\n")
+	if frontmatterYaml != "" {
+		if err := yaml.Unmarshal([]byte(frontmatterYaml), &frontmatter); err != nil {
+			return nil, fmt.Errorf("error parsing frontmatter YAML: %w", err)
 		}
 	}
 
@@ -517,14 +666,13 @@ func injectSourceIntoMPrompt(content []byte, sourceType string) ([]byte, error)
 		return nil, fmt.Errorf("error marshaling updated frontmatter: %w", err)
 	}
 
-	// Build the result
+	// Build the result, keeping a format 2 section marker before the frontmatter
+	var result []string
+	result = append(result, lines[:frontmatterStart]...)
 	result = append(result, strings.TrimSpace(string(updatedFrontmatter)))
 
-	// Add the rest of the content (from the first -- separator onwards)
-	for i < len(lines) {
-		result = append(result, lines[i])
-		i++
-	}
+	// Add the rest of the content (from the first separator or section marker onwards)
+	result = append(result, lines[frontmatterEnd:]...)
 
 	return []byte(strings.Join(result, "\n")), nil
 }
@@ -534,10 +682,63 @@ func InstallMPromptByName(fs afero.Fs, promptName string) error {
 	return InstallMPromptByNameFromRepo(fs, promptName, "")
 }
 
+// InstallOptions controls where prompts are installed and updated from
+type InstallOptions struct {
+	// Registries are tried in priority order when resolving prompts
+	Registries Registries
+	// Yes answers confirmations with yes and never prompts for wizard values
+	Yes bool
+	// Answers are wizard values supplied with --set, --values or MARVAI_VAR_<ID>
+	Answers WizardAnswers
+	// Runner runs git to check for a repository and to resolve dynamic defaults, OSCommandRunner if nil
+	Runner CommandRunner
+	// HomeDir is the home directory with the secret store, the user's home directory if empty
+	HomeDir string
+	// ApproveCommands allows the commands a prompt runs with {{exec}} without asking, Yes never does
+	ApproveCommands bool
+}
+
+// runner returns the command runner of the options, the OS if none is set
+func (opts InstallOptions) runner() CommandRunner {
+	if opts.Runner != nil {
+		return opts.Runner
+	}
+	return OSCommandRunner{}
+}
+
+// DefaultInstallOptions returns install options from the user configuration
+func DefaultInstallOptions(fs afero.Fs) (InstallOptions, error) {
+	return newInstallOptions(fs, userHomeDir(), nil)
+}
+
+// newInstallOptions returns install options from the user configuration and command line registries
+func newInstallOptions(fs afero.Fs, homeDir string, registryFlags []string) (InstallOptions, error) {
+	config, err := LoadConfig(fs, homeDir)
+	if err != nil {
+		return InstallOptions{}, err
+	}
+
+	registries, err := ResolveRegistries(fs, config, registryFlags)
+	if err != nil {
+		return InstallOptions{}, err
+	}
+
+	return InstallOptions{Registries: registries}, nil
+}
+
 // InstallMPromptByNameFromRepo fetches the PROMPTS file, finds a prompt by name, and installs it from specified repo
 func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) error {
+	opts, err := DefaultInstallOptions(fs)
+	if err != nil {
+		return err
+	}
+	return InstallMPromptByNameWithOptions(fs, promptName, repo, opts)
+}
+
+// InstallMPromptByNameWithOptions finds a prompt by name in the registries and installs it from specified repo
+func InstallMPromptByNameWithOptions(fs afero.Fs, promptName string, repo string, opts InstallOptions) error {
 	// Check if current directory is a git repository
-	if !isGitRepository(fs, OSCommandRunner{}) {
+	if !isGitRepository(fs, opts.runner()) {
 		return fmt.Errorf("current directory is not a git repository - prompts can only be installed in git repositories")
 	}
 
@@ -546,89 +747,111 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 		return fmt.Errorf("invalid prompt name: %w", err)
 	}
 
-	// Fetch remote prompts
-	prompts, err := fetchRemotePrompts(repo)
+	// Find the prompt entry by name in the registries
+	registry, promptEntry, err := opts.Registries.FindPrompt(repo, promptName)
 	if err != nil {
-		// Exit immediately with the error message
-		fmt.Printf("%s\n", err.Error())
-		os.Exit(1)
+		return err
 	}
 
-	// Find the prompt entry by name
-	promptEntry, err := findPromptByName(prompts, promptName)
+	// Download the .mprompt file and verify it against the PROMPTS entry
+	promptContent, data, err := fetchVerifiedPrompt(registry, repo, promptEntry)
 	if err != nil {
 		return err
 	}
 
-	// Handle empty repo case (same as fetchRemotePrompts)
+	// Handle empty repo case for logging
 	actualRepo := repo
 	if strings.TrimSpace(actualRepo) == "" {
-		actualRepo = "marvai"
+		actualRepo = defaultRepo
 	}
 
-	promptURL := fmt.Sprintf("https://registry.marvai.dev/dist/%s/%s", actualRepo, promptEntry.File)
+	// PROMPTS-based installs are marked with the distro source
+	return installMPromptContent(fs, promptContent, data, promptName, "distro", opts, func(success bool) error {
+		return LogPromptInstall(fs, installedName(data, promptName), actualRepo, success)
+	})
+}
+
+// InstallMPromptFromSource installs a .mprompt file from a local path or a direct URL
+func InstallMPromptFromSource(fs afero.Fs, mpromptSource string) error {
+	return InstallMPromptFromSourceWithOptions(fs, mpromptSource, InstallOptions{})
+}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
+// InstallMPromptFromSourceWithOptions installs a .mprompt file from a local path or a direct URL with install options
+func InstallMPromptFromSourceWithOptions(fs afero.Fs, mpromptSource string, opts InstallOptions) error {
+	// Check if current directory is a git repository
+	if !isGitRepository(fs, opts.runner()) {
+		return fmt.Errorf("current directory is not a git repository - prompts can only be installed in git repositories")
 	}
 
-	// Make request to fetch the .mprompt file
-	resp, err := client.Get(promptURL)
+	content, displayName, err := source.NewSourceManager(fs).LoadContent(mpromptSource)
 	if err != nil {
-		return fmt.Errorf("error downloading .mprompt file from %s: %w", promptURL, err)
+		return err
 	}
-	defer func() {
-		if err := resp.Body.Close(); err != nil {
-			fmt.Printf("Warning: failed to close response body: %v\n", err)
-		}
-	}()
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP error %d when downloading .mprompt file from %s", resp.StatusCode, promptURL)
+	// SECURITY: Limit file size to prevent memory exhaustion
+	if len(content) > 10*1024*1024 { // 10MB limit
+		return fmt.Errorf(".mprompt file too large (%d bytes), maximum allowed is 10MB", len(content))
 	}
 
-	// Read response with size limit
-	const maxSize = 10 * 1024 * 1024 // 10MB limit for .mprompt files
-	limitReader := io.LimitReader(resp.Body, maxSize+1)
-	promptContent, err := io.ReadAll(limitReader)
-	if err != nil {
-		return fmt.Errorf("error reading .mprompt file response: %w", err)
+	// Derive the prompt name from the file name, the frontmatter name takes precedence later
+	promptName := strings.TrimSuffix(path.Base(displayName), ".mprompt")
+	if err := ValidatePromptName(promptName); err != nil {
+		return fmt.Errorf("invalid prompt name: %w", err)
 	}
 
-	// Check size limit
-	if len(promptContent) > maxSize {
-		return fmt.Errorf(".mprompt file too large (%d bytes), maximum allowed is %d bytes", len(promptContent), maxSize)
+	data, err := ParseMPromptContent(content, displayName)
+	if err != nil {
+		return fmt.Errorf("failed to parse .mprompt file %s: %w", displayName, err)
 	}
 
-	// Parse the downloaded .mprompt file first to extract the template
-	tempData, err := ParseMPromptContent(promptContent, fmt.Sprintf("remote-%s", promptName))
-	if err != nil {
-		return fmt.Errorf("failed to parse downloaded .mprompt file for hash verification: %w", err)
+	// Partials from a registry repo can't be resolved for a single file
+	if missing := missingSharedPartials(data); len(missing) > 0 {
+		return fmt.Errorf("%s uses the registry partials %s, install it from its registry", displayName, strings.Join(missing, ", "))
 	}
 
-	// Verify SHA256 hash of the template only (not frontmatter or variables)
-	if err := verifySHA256([]byte(tempData.Template), promptEntry.SHA256); err != nil {
-		return fmt.Errorf("SHA256 verification failed for %s: %w", promptURL, err)
+	sourceType := "file"
+	if isURLSource(mpromptSource) {
+		sourceType = "url"
 	}
 
-	// Parse the downloaded .mprompt file
-	data, err := ParseMPromptContent(promptContent, fmt.Sprintf("remote-%s", promptName))
-	if err != nil {
-		return fmt.Errorf("failed to parse downloaded .mprompt file: %w", err)
+	return installMPromptContent(fs, content, data, promptName, sourceType, opts, func(success bool) error {
+		return LogPromptInstallFromSource(fs, installedName(data, promptName), sourceType, displayName, success)
+	})
+}
+
+// isURLSource returns true if the install source is a URL
+func isURLSource(mpromptSource string) bool {
+	return strings.Contains(mpromptSource, "://")
+}
+
+// isFileOrURLSource returns true if the install source refers to a local .mprompt file or a URL
+// instead of a prompt name in the registry
+func isFileOrURLSource(mpromptSource string) bool {
+	if isURLSource(mpromptSource) {
+		return true
 	}
+	if strings.HasSuffix(mpromptSource, ".mprompt") {
+		return true
+	}
+	return strings.HasPrefix(mpromptSource, "./") || strings.HasPrefix(mpromptSource, "../") || filepath.IsAbs(mpromptSource)
+}
 
+// installedName returns the name a prompt is installed under
+func installedName(data *MPromptData, promptName string) string {
 	// Use the frontmatter name if available, otherwise use the provided name
-	finalName := promptName
 	if data.Frontmatter.Name != "" {
-		finalName = data.Frontmatter.Name
-		// Validate the frontmatter name
-		if err := ValidatePromptName(finalName); err != nil {
-			// If frontmatter name is invalid, fall back to provided name
-			finalName = promptName
+		// Validate the frontmatter name, if it is invalid fall back to provided name
+		if err := ValidatePromptName(data.Frontmatter.Name); err == nil {
+			return data.Frontmatter.Name
 		}
 	}
+	return promptName
+}
+
+// installMPromptContent writes already loaded .mprompt content into the .marvai directory,
+// runs the wizard and logs the result with the provided log function
+func installMPromptContent(fs afero.Fs, content []byte, data *MPromptData, promptName string, sourceType string, opts InstallOptions, logInstall func(success bool) error) error {
+	finalName := installedName(data, promptName)
 
 	// Check if prompt is already installed
 	mpromptFile := filepath.Join(".marvai", finalName+".mprompt")
@@ -655,15 +878,19 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 		return nil
 	}
 
-	//
-	// Ask for user confirmation before installing
-	fmt.Printf("Do you want to install '%s'? (yes/no) ", finalName)
-	var response string
-	if _, err := fmt.Scanln(&response); err != nil {
-		fmt.Printf("Warning: failed to read input: %v\n", err)
+	// Invalid answers and, without prompting, missing required variables fail the install before anything is written
+	var values map[string]interface{}
+	if opts.Yes {
+		values, err = runWizard(fs, data.Variables, nil, opts)
+	} else {
+		_, err = opts.Answers.resolve(fs, data.Variables)
+	}
+	if err != nil {
+		return err
 	}
 
-	if strings.ToLower(strings.TrimSpace(response)) != "yes" {
+	// Ask for user confirmation before installing
+	if !confirm(fmt.Sprintf("Do you want to install '%s'?", finalName), opts.Yes) {
 		fmt.Printf("Installation cancelled.\n")
 		return nil
 	}
@@ -672,9 +899,12 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 	if err := fs.MkdirAll(".marvai", 0755); err != nil {
 		return fmt.Errorf("error creating .marvai directory: %w", err)
 	}
+	if err := ensureLocalVarsIgnored(fs); err != nil {
+		fmt.Printf("Warning: failed to write .marvai/.gitignore: %v\n", err)
+	}
 
-	// Inject source information (distro for PROMPTS-based installs)
-	updatedContent, err := injectSourceIntoMPrompt(promptContent, "distro")
+	// Inject source information
+	updatedContent, err := injectSourceIntoMPrompt(content, sourceType)
 	if err != nil {
 		return fmt.Errorf("error injecting source into .mprompt content: %w", err)
 	}
@@ -682,7 +912,7 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 	// Write .mprompt file with the updated content
 	if err := afero.WriteFile(fs, mpromptFile, updatedContent, 0644); err != nil {
 		// Log failed installation
-		if logErr := LogPromptInstall(fs, finalName, actualRepo, false); logErr != nil {
+		if logErr := logInstall(false); logErr != nil {
 			fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
 		}
 		return fmt.Errorf("error writing .mprompt file: %w", err)
@@ -690,10 +920,22 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 
 	// Run wizard and save answers to .var file
 	if len(data.Variables) > 0 {
-		values, err := ExecuteWizard(data.Variables)
+		if values == nil {
+			values, err = runWizard(fs, data.Variables, nil, opts)
+		}
+		if err != nil {
+			// Log failed installation
+			if logErr := logInstall(false); logErr != nil {
+				fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
+			}
+			return err
+		}
+
+		// SECURITY: Secret values are kept in the user's secret store, the .var file only references them
+		values, err = storeSecrets(fs, opts, data.Variables, values, nil)
 		if err != nil {
 			// Log failed installation
-			if logErr := LogPromptInstall(fs, finalName, actualRepo, false); logErr != nil {
+			if logErr := logInstall(false); logErr != nil {
 				fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
 			}
 			return err
@@ -703,7 +945,7 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 		varData, err := yaml.Marshal(values)
 		if err != nil {
 			// Log failed installation
-			if logErr := LogPromptInstall(fs, finalName, actualRepo, false); logErr != nil {
+			if logErr := logInstall(false); logErr != nil {
 				fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
 			}
 			return fmt.Errorf("error marshaling wizard answers: %w", err)
@@ -711,7 +953,7 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 
 		if err := afero.WriteFile(fs, varFile, varData, 0644); err != nil {
 			// Log failed installation
-			if logErr := LogPromptInstall(fs, finalName, actualRepo, false); logErr != nil {
+			if logErr := logInstall(false); logErr != nil {
 				fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
 			}
 			return fmt.Errorf("error writing .var file: %w", err)
@@ -721,10 +963,13 @@ func InstallMPromptByNameFromRepo(fs afero.Fs, promptName string, repo string) e
 		fmt.Printf("Installed %s (no variables to configure)\n", mpromptFile)
 	}
 
+	// SECURITY: The commands of {{exec}} only run once the user allows them
+	approveInstalledCommands(fs, opts, finalName, data)
+
 	fmt.Printf("\nWARNING: Prompts can be dangerous - be careful when executing them in a coding agent.\nBest review them before executing them.\n")
 
 	// Log successful installation
-	if logErr := LogPromptInstall(fs, finalName, actualRepo, true); logErr != nil {
+	if logErr := logInstall(true); logErr != nil {
 		fmt.Printf("Warning: failed to log prompt installation: %v\n", logErr)
 	}
 
@@ -813,6 +1058,11 @@ func showWelcomeScreen(w io.Writer) {
 // Run executes the main application logic using Cobra for command-line parsing
 func Run(args []string, fs afero.Fs, stderr io.Writer, version string) error {
 	var cliTool string
+	var registryFlags []string
+	var yes bool
+	var approveCommands bool
+	var setFlags []string
+	var valuesFile string
 
 	// Create root command
 	rootCmd := &cobra.Command{
@@ -830,7 +1080,8 @@ General Public Licence for details.`,
 			}
 			// Backward compatibility: if no subcommand specified, treat first arg as prompt name
 			promptName := args[0]
-			if err := RunWithPrompt(fs, promptName, cliTool); err != nil {
+			opts := PromptOptions{HomeDir: userHomeDir(), Version: version}
+			if err := RunWithPromptOptions(fs, promptName, cliTool, opts, OSCommandRunner{}, os.Stdout, os.Stderr); err != nil {
 				if _, printErr := fmt.Fprintf(stderr, "Error: %v\n", err); printErr != nil {
 					fmt.Printf("Warning: failed to write error to stderr: %v\n", printErr)
 				}
@@ -842,6 +1093,9 @@ General Public Licence for details.`,
 	// Add global flag for CLI tool selection
 	rootCmd.PersistentFlags().StringVar(&cliTool, "cli", "claude", "CLI tool to use (claude, gemini, codex)")
 
+	// Add global flag for registries, tried before the configured registries
+	rootCmd.PersistentFlags().StringArrayVar(&registryFlags, "registry", nil, "Registry to use before the configured registries (can be repeated)")
+
 	// Add validation for CLI tool
 	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
 		if cliTool != "claude" && cliTool != "gemini" && cliTool != "codex" {
@@ -856,19 +1110,42 @@ General Public Licence for details.`,
 		Short: "Execute a prompt template",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return RunWithPrompt(fs, args[0], cliTool)
+			opts, err := newPromptOptions(fs, setFlags, version)
+			if err != nil {
+				return err
+			}
+			return RunWithPromptOptions(fs, args[0], cliTool, opts, OSCommandRunner{}, os.Stdout, os.Stderr)
 		},
 	}
 
 	// Create install command
 	installCmd := &cobra.Command{
 		Use:   "install <source>",
-		Short: "Install a prompt from a remote source",
-		Long:  "Install a prompt from remote registry using myrepo/myprompt format or myprompt alone (defaults to marvai repo)",
+		Short: "Install a prompt from a remote source, a local file or a URL",
+		Long:  "Install a prompt from remote registry using myrepo/myprompt format or myprompt alone (defaults to marvai repo), from a local .mprompt file or from a marvai.dev URL",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
 			mpromptSource := args[0]
 
+			answers, err := NewWizardAnswers(fs, setFlags, valuesFile, os.Environ())
+			if err != nil {
+				return err
+			}
+
+			// Local files and direct URLs are loaded through the source manager
+			if isFileOrURLSource(mpromptSource) {
+				return InstallMPromptFromSourceWithOptions(fs, mpromptSource, InstallOptions{Yes: yes, Answers: answers, ApproveCommands: approveCommands})
+			}
+
+			opts, err := newInstallOptions(fs, userHomeDir(), registryFlags)
+			if err != nil {
+				return err
+			}
+			opts.Yes = yes
+			opts.Answers = answers
+			opts.ApproveCommands = approveCommands
+
 			// Parse repo/prompt format
 			if strings.Contains(mpromptSource, "/") {
 				// Format: myrepo/myprompt
@@ -878,10 +1155,10 @@ General Public Licence for details.`,
 				}
 				repo := parts[0]
 				promptName := parts[1]
-				return InstallMPromptByNameFromRepo(fs, promptName, repo)
+				return InstallMPromptByNameWithOptions(fs, promptName, repo, opts)
 			} else {
 				// Format: myprompt (defaults to marvai repo)
-				return InstallMPromptByName(fs, mpromptSource)
+				return InstallMPromptByNameWithOptions(fs, mpromptSource, "", opts)
 			}
 		},
 	}
@@ -891,11 +1168,16 @@ General Public Licence for details.`,
 		Use:   "list [repo]",
 		Short: "List available remote prompts",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
 			var repo string
 			if len(args) > 0 {
 				repo = args[0]
 			}
-			return ListRemotePrompts(fs, repo)
+			opts, err := newInstallOptions(fs, userHomeDir(), registryFlags)
+			if err != nil {
+				return err
+			}
+			return ListRemotePromptsFromRegistries(fs, repo, opts.Registries)
 		},
 	}
 
@@ -924,12 +1206,131 @@ General Public Licence for details.`,
 		Long:  "Check for new version of an installed prompt, download and install it safely with rollback capability",
 		Args:  cobra.ExactArgs(1),
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return UpdatePrompt(fs, args[0])
+			opts, err := newInstallOptions(fs, userHomeDir(), registryFlags)
+			if err != nil {
+				return err
+			}
+			opts.Yes = yes
+			opts.ApproveCommands = approveCommands
+			opts.Answers, err = NewWizardAnswers(fs, setFlags, valuesFile, os.Environ())
+			if err != nil {
+				return err
+			}
+			return UpdatePromptWithOptions(fs, args[0], opts)
+		},
+	}
+
+	configureCmd := &cobra.Command{
+		Use:   "configure <prompt-name>",
+		Short: "Change the variables of an installed prompt",
+		Long:  "Run the wizard of an installed prompt again, prefilled with the current values, and save the changed values",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			answers, err := NewWizardAnswers(fs, setFlags, valuesFile, os.Environ())
+			if err != nil {
+				return err
+			}
+			return ConfigurePromptWithOptions(fs, args[0], InstallOptions{Yes: yes, Answers: answers}, os.Stdout)
+		},
+	}
+
+	// Wizard answers for scripted installs, updates and configuration, e.g. in CI
+	for _, cmd := range []*cobra.Command{installCmd, updateCmd, configureCmd} {
+		cmd.Flags().BoolVarP(&yes, "yes", "y", false, "Answer confirmations with yes and never prompt, missing required variables are an error")
+		cmd.Flags().StringArrayVar(&setFlags, "set", nil, "Set a wizard variable (id=value), can be repeated")
+		cmd.Flags().StringVar(&valuesFile, "values", "", "YAML file with wizard variable values")
+	}
+	// Commands of prompts are only allowed explicitly, never by --yes
+	for _, cmd := range []*cobra.Command{installCmd, updateCmd} {
+		cmd.Flags().BoolVar(&approveCommands, "approve-commands", false, "Allow the commands the prompt runs with {{exec}} without asking")
+	}
+
+	approveCmd := &cobra.Command{
+		Use:   "approve <prompt-name>",
+		Short: "Allow the commands of an installed prompt",
+		Long:  "Show the commands an installed prompt runs with {{exec}} when it is rendered and allow them for this version of the prompt",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return ApprovePromptWithOptions(fs, args[0], InstallOptions{ApproveCommands: yes}, os.Stdout)
+		},
+	}
+	approveCmd.Flags().BoolVarP(&yes, "yes", "y", false, "Allow the commands without asking")
+
+	// Create vars command
+	var explain bool
+	varsCmd := &cobra.Command{
+		Use:   "vars <prompt-name>",
+		Short: "Show the variables of an installed prompt",
+		Long:  "Show the variable values of an installed prompt resolved from the user-global, project, prompt and local .var files and --set overrides",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := newPromptOptions(fs, setFlags, version)
+			if err != nil {
+				return err
+			}
+			return ShowVars(fs, args[0], opts, explain, os.Stdout)
+		},
+	}
+	varsCmd.Flags().BoolVar(&explain, "explain", false, "Show where each value comes from")
+
+	// Create render command
+	var renderOpts RenderPromptOptions
+	renderCmd := &cobra.Command{
+		Use:   "render <prompt-name>",
+		Short: "Show the final prompt without running it",
+		Long:  "Template an installed prompt like 'marvai prompt' would and print it, or write it to a file, without starting the AI CLI tool",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			opts, err := newPromptOptions(fs, setFlags, version)
+			if err != nil {
+				return err
+			}
+			opts.Agent = renderOpts.Agent
+			if opts.Agent == "" {
+				opts.Agent = cliTool
+			}
+			if opts.Agent != "claude" && opts.Agent != "gemini" && opts.Agent != "codex" {
+				return fmt.Errorf("invalid agent '%s'. Available agents: claude, gemini, codex", opts.Agent)
+			}
+			renderOpts.PromptOptions = opts
+			return RenderPrompt(fs, args[0], renderOpts, os.Stdout, os.Stderr)
+		},
+	}
+	renderCmd.Flags().StringVar(&renderOpts.Agent, "agent", "", "Render the prompt for this CLI tool (default the --cli tool)")
+	renderCmd.Flags().StringVarP(&renderOpts.Output, "output", "o", "", "Write the prompt to a file")
+	renderCmd.Flags().BoolVar(&renderOpts.Diff, "diff", false, "Show the changes since the last render")
+	renderCmd.Flags().BoolVar(&renderOpts.ShowSecrets, "show-secrets", false, "Show the values of secret variables")
+
+	// Variable overrides when running a prompt
+	for _, cmd := range []*cobra.Command{promptCmd, varsCmd, renderCmd} {
+		cmd.Flags().StringArrayVar(&setFlags, "set", nil, "Override a variable (id=value), can be repeated")
+	}
+
+	// Create lint command
+	lintCmd := &cobra.Command{
+		Use:   "lint <file.mprompt>...",
+		Short: "Validate .mprompt files",
+		Long:  "Check .mprompt files for YAML, wizard and template problems and report them with line and column numbers",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return LintMPromptFiles(fs, args, os.Stdout)
+		},
+	}
+
+	convertCmd := &cobra.Command{
+		Use:   "convert <file.mprompt>...",
+		Short: "Convert .mprompt files to format 2",
+		Long:  "Upgrade .mprompt files from the -- separated format 1 to format 2 with @@@ section markers, in place",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cmd.SilenceUsage = true
+			return ConvertMPromptFiles(fs, args, os.Stdout)
 		},
 	}
 
 	// Add all commands to root
-	rootCmd.AddCommand(promptCmd, installCmd, listCmd, installedCmd, versionCmd, updateCmd)
+	rootCmd.AddCommand(promptCmd, installCmd, listCmd, installedCmd, versionCmd, updateCmd, configureCmd, approveCmd, varsCmd, renderCmd, lintCmd, convertCmd)
 
 	// Set up command line arguments
 	rootCmd.SetArgs(args[1:]) // Skip program name
@@ -395,10 +395,39 @@ func TestLoadPrompt(t *testing.T) {
 			expectedResult: "Hello World!",
 			expectedError:  false,
 		},
+		{
+			name:           "load prompt without escaping",
+			promptName:     "compare",
+			mpromptContent: "name: Compare\n--\n- id: expr\n  description: Expression\n--\nCheck {{expr}}",
+			varContent:     "expr: a < b && c",
+			expectedResult: "Check a < b && c",
+			expectedError:  false,
+		},
+		{
+			name:           "load prompt with shell escaping",
+			promptName:     "cleanup",
+			mpromptContent: "name: Cleanup\nescape: shell\n--\n- id: dir\n  description: Directory\n--\nRun rm -r {{dir}}",
+			varContent:     "dir: it's; rm -rf /",
+			expectedResult: "Run rm -r 'it'\\''s; rm -rf /'",
+			expectedError:  false,
+		},
+		{
+			name:           "load prompt with unknown escape mode",
+			promptName:     "unknown",
+			mpromptContent: "name: Unknown\nescape: latex\n--\n--\nHello",
+			expectedError:  true,
+		},
 		{
 			name:           "load prompt with missing variable file",
 			promptName:     "missing-vars",
 			mpromptContent: "name: Test\n--\n- id: name\n  question: \"What is your name?\"\n--\nHello {{name}}!",
+			varContent:     "", // No .var file created
+			expectedError:  true,
+		},
+		{
+			name:           "load non-strict prompt with missing variable file",
+			promptName:     "missing-vars",
+			mpromptContent: "name: Test\nstrict: false\n--\n- id: name\n  question: \"What is your name?\"\n--\nHello {{name}}!",
 			varContent:     "",        // No .var file created
 			expectedResult: "Hello !", // Empty variable
 			expectedError:  false,
@@ -1248,3 +1277,48 @@ func TestVerifySHA256(t *testing.T) {
 		})
 	}
 }
+
+func TestIsFileOrURLSource(t *testing.T) {
+	tests := []struct {
+		source   string
+		expected bool
+	}{
+		{"helloworld", false},
+		{"otherrepo/otherprompt", false},
+		{"./prompts/review.mprompt", true},
+		{"prompts/review.mprompt", true},
+		{"../review", true},
+		{"/tmp/review.mprompt", true},
+		{"https://x.marvai.dev/foo.mprompt", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.source, func(t *testing.T) {
+			if result := isFileOrURLSource(tt.source); result != tt.expected {
+				t.Errorf("isFileOrURLSource(%q) = %v, expected %v", tt.source, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestInstalledName(t *testing.T) {
+	tests := []struct {
+		name            string
+		frontmatterName string
+		promptName      string
+		expected        string
+	}{
+		{"frontmatter name wins", "review", "file-name", "review"},
+		{"no frontmatter name", "", "file-name", "file-name"},
+		{"invalid frontmatter name falls back", "../evil", "file-name", "file-name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &MPromptData{Frontmatter: MPromptFrontmatter{Name: tt.frontmatterName}}
+			if result := installedName(data, tt.promptName); result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,266 @@
+package marvai
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/marvai-dev/marvai/internal"
+)
+
+// .mprompt format versions.
+//
+// Format 1 separates frontmatter, wizard and template with lines containing only --,
+// which makes -- lines in the template or YAML impossible.
+//
+// Format 2 starts every section with a marker line and declares format: 2 in the frontmatter:
+//
+//	@@@ frontmatter
+//	format: 2
+//	name: Example
+//	@@@ wizard
+//	- id: language
+//	  description: For what language
+//	@@@ partial coding-standards
+//	Shared instructions, used with {{> coding-standards}}
+//	@@@ template
+//	Everything up to the end of the file, including -- lines
+//
+// The wizard and partial sections are optional. The template section is always last and read verbatim,
+// marker lines inside it are part of the template. '@' is a reserved indicator in YAML,
+// so a marker line can't be part of the frontmatter or wizard YAML.
+const (
+	MPromptFormatV1 = 1
+	MPromptFormatV2 = 2
+)
+
+const (
+	sectionMarkerPrefix = "@@@ "
+	frontmatterSection  = "frontmatter"
+	wizardSection       = "wizard"
+	templateSection     = "template"
+	partialSection      = "partial"
+)
+
+// mpromptSection is a section of a .mprompt file
+type mpromptSection struct {
+	Lines []string
+	// StartLine is the 1-based line of the file the section starts at
+	StartLine int
+}
+
+// mpromptPartial is a partial section of a format 2 .mprompt file
+type mpromptPartial struct {
+	Name string
+	mpromptSection
+}
+
+// mpromptSections are the sections of a .mprompt file
+type mpromptSections struct {
+	Format      int
+	Frontmatter mpromptSection
+	Wizard      mpromptSection
+	Partials    []*mpromptPartial
+	Template    mpromptSection
+	// DroppedSeparators are the lines of extra -- separators format 1 drops from the template
+	DroppedSeparators []int
+}
+
+// MPromptFormatError is an error in the section structure of a .mprompt file
+type MPromptFormatError struct {
+	Line    int
+	Message string
+}
+
+func (e *MPromptFormatError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// isMPromptV2 returns true if the content starts with a format 2 frontmatter marker
+func isMPromptV2(content string) bool {
+	firstLine := strings.SplitN(content, "\n", 2)[0]
+	return strings.TrimRight(firstLine, " \t\r") == sectionMarkerPrefix+frontmatterSection
+}
+
+// splitMPromptSections splits .mprompt content into frontmatter, wizard and template sections
+func splitMPromptSections(content string) (mpromptSections, error) {
+	if isMPromptV2(content) {
+		return splitMPromptSectionsV2(content)
+	}
+	return splitMPromptSectionsV1(content), nil
+}
+
+// splitMPromptSectionsV1 splits format 1 content into sections separated by --
+func splitMPromptSectionsV1(content string) mpromptSections {
+	lines := strings.Split(content, "\n")
+	sections := mpromptSections{
+		Format:      MPromptFormatV1,
+		Frontmatter: mpromptSection{StartLine: 1},
+	}
+	current := []*mpromptSection{&sections.Frontmatter, &sections.Wizard, &sections.Template}
+
+	section := 0 // 0=frontmatter, 1=wizard, 2=template
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "--" && section < 2 {
+			section++
+			current[section].StartLine = i + 2
+			continue
+		}
+		if strings.TrimSpace(line) == "--" {
+			// More than 2 separators - the separator is dropped from the template
+			sections.DroppedSeparators = append(sections.DroppedSeparators, i+1)
+			continue
+		}
+		current[section].Lines = append(current[section].Lines, line)
+	}
+
+	return sections
+}
+
+// splitMPromptSectionsV2 splits format 2 content into sections started by @@@ marker lines
+func splitMPromptSectionsV2(content string) (mpromptSections, error) {
+	lines := strings.Split(content, "\n")
+	sections := mpromptSections{Format: MPromptFormatV2}
+
+	var current *mpromptSection
+	seen := make(map[string]bool)
+	for i, line := range lines {
+		if current == &sections.Template {
+			// The template is the last section and runs to the end of the file
+			current.Lines = append(current.Lines, line)
+			continue
+		}
+
+		if !strings.HasPrefix(line, sectionMarkerPrefix) {
+			current.Lines = append(current.Lines, line)
+			continue
+		}
+
+		name := strings.TrimSpace(strings.TrimPrefix(line, sectionMarkerPrefix))
+		if seen[name] {
+			return mpromptSections{}, &MPromptFormatError{Line: i + 1, Message: fmt.Sprintf("duplicate section %q", name)}
+		}
+		seen[name] = true
+
+		switch name {
+		case frontmatterSection:
+			current = &sections.Frontmatter
+		case wizardSection:
+			current = &sections.Wizard
+		case templateSection:
+			current = &sections.Template
+		default:
+			partialName, ok := strings.CutPrefix(name, partialSection+" ")
+			if !ok {
+				return mpromptSections{}, &MPromptFormatError{Line: i + 1, Message: fmt.Sprintf("unknown section %q, expected frontmatter, wizard, partial or template", name)}
+			}
+			partialName = strings.TrimSpace(partialName)
+			if err := internal.ValidatePartialName(partialName); err != nil {
+				return mpromptSections{}, &MPromptFormatError{Line: i + 1, Message: err.Error()}
+			}
+			for _, partial := range sections.Partials {
+				if partial.Name == partialName {
+					return mpromptSections{}, &MPromptFormatError{Line: i + 1, Message: fmt.Sprintf("duplicate partial %q", partialName)}
+				}
+			}
+			partial := &mpromptPartial{Name: partialName}
+			sections.Partials = append(sections.Partials, partial)
+			current = &partial.mpromptSection
+		}
+		current.StartLine = i + 2
+	}
+
+	if !seen[templateSection] {
+		return mpromptSections{}, &MPromptFormatError{Line: len(lines), Message: "missing @@@ template section"}
+	}
+
+	return sections, nil
+}
+
+// validateMPromptFormat checks that the format declared in the frontmatter matches the file layout
+func validateMPromptFormat(sections mpromptSections, frontmatter MPromptFrontmatter) error {
+	switch sections.Format {
+	case MPromptFormatV2:
+		if frontmatter.Format != MPromptFormatV2 {
+			return fmt.Errorf("files with @@@ section markers must declare format: %d in the frontmatter", MPromptFormatV2)
+		}
+	default:
+		if frontmatter.Format > MPromptFormatV1 {
+			return fmt.Errorf("format %d requires @@@ section markers, found -- separators", frontmatter.Format)
+		}
+	}
+	return nil
+}
+
+var formatKeyRegex = regexp.MustCompile(`^format\s*:`)
+
+// ConvertMPromptToV2 converts format 1 .mprompt content to format 2.
+// The template is the template format 1 parses, extra -- separators it dropped are not carried over
+func ConvertMPromptToV2(content []byte) ([]byte, error) {
+	sections, err := splitMPromptSections(string(content))
+	if err != nil {
+		return nil, err
+	}
+	if sections.Format == MPromptFormatV2 {
+		return nil, fmt.Errorf("content is already format %d", MPromptFormatV2)
+	}
+
+	var result []string
+	result = append(result, sectionMarkerPrefix+frontmatterSection, fmt.Sprintf("format: %d", MPromptFormatV2))
+	for _, line := range trimBlankLines(sections.Frontmatter.Lines) {
+		// The format is declared above, drop a top-level format key to avoid a duplicate key
+		if formatKeyRegex.MatchString(line) {
+			continue
+		}
+		result = append(result, line)
+	}
+
+	if wizardLines := trimBlankLines(sections.Wizard.Lines); len(wizardLines) > 0 {
+		result = append(result, sectionMarkerPrefix+wizardSection)
+		result = append(result, wizardLines...)
+	}
+
+	result = append(result, sectionMarkerPrefix+templateSection)
+	result = append(result, trimBlankLines(sections.Template.Lines)...)
+
+	converted := []byte(strings.Join(result, "\n") + "\n")
+
+	// Make sure the conversion didn't change the meaning of the prompt
+	if err := verifyConversion(content, converted); err != nil {
+		return nil, err
+	}
+
+	return converted, nil
+}
+
+// verifyConversion checks that converted content parses to the same prompt as the original
+func verifyConversion(original []byte, converted []byte) error {
+	before, err := ParseMPromptContent(original, "input")
+	if err != nil {
+		return err
+	}
+	after, err := ParseMPromptContent(converted, "converted")
+	if err != nil {
+		return fmt.Errorf("converted content is invalid: %w", err)
+	}
+
+	before.Frontmatter.Format = after.Frontmatter.Format
+	if !reflect.DeepEqual(before, after) {
+		return fmt.Errorf("converted content does not match the original prompt")
+	}
+	return nil
+}
+
+// trimBlankLines removes leading and trailing blank lines
+func trimBlankLines(lines []string) []string {
+	start := 0
+	for start < len(lines) && strings.TrimSpace(lines[start]) == "" {
+		start++
+	}
+	end := len(lines)
+	for end > start && strings.TrimSpace(lines[end-1]) == "" {
+		end--
+	}
+	return lines[start:end]
+}
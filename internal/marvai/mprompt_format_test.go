@@ -0,0 +1,189 @@
+package marvai
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseMPromptContentV2(t *testing.T) {
+	content := `@@@ frontmatter
+format: 2
+name: Markdown
+description: Uses -- in the template
+@@@ wizard
+- id: topic
+  description: Topic
+@@@ template
+# {{topic}}
+--
+@@@ wizard
+Text after a separator`
+
+	data, err := ParseMPromptContent([]byte(content), "test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if data.Frontmatter.Format != MPromptFormatV2 || data.Frontmatter.Name != "Markdown" {
+		t.Errorf("Unexpected frontmatter: %+v", data.Frontmatter)
+	}
+	if len(data.Variables) != 1 || data.Variables[0].ID != "topic" {
+		t.Errorf("Unexpected variables: %+v", data.Variables)
+	}
+	expectedTemplate := "# {{topic}}\n--\n@@@ wizard\nText after a separator"
+	if data.Template != expectedTemplate {
+		t.Errorf("Expected template %q, got %q", expectedTemplate, data.Template)
+	}
+}
+
+func TestParseMPromptContentFormatErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		content       string
+		expectedError string
+	}{
+		{
+			name:          "missing format declaration",
+			content:       "@@@ frontmatter\nname: Test\n@@@ template\nHello",
+			expectedError: "must declare format: 2",
+		},
+		{
+			name:          "format 2 with separators",
+			content:       "format: 2\nname: Test\n--\n--\nHello",
+			expectedError: "requires @@@ section markers",
+		},
+		{
+			name:          "missing template section",
+			content:       "@@@ frontmatter\nformat: 2\n@@@ wizard\n",
+			expectedError: "missing @@@ template section",
+		},
+		{
+			name:          "unknown section",
+			content:       "@@@ frontmatter\nformat: 2\n@@@ variables\n@@@ template\nHello",
+			expectedError: "line 3: unknown section",
+		},
+		{
+			name:          "duplicate section",
+			content:       "@@@ frontmatter\nformat: 2\n@@@ frontmatter\n@@@ template\nHello",
+			expectedError: "line 3: duplicate section",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseMPromptContent([]byte(tt.content), "test")
+			if err == nil {
+				t.Fatal("Expected error but got none")
+			}
+			if !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestConvertMPromptToV2(t *testing.T) {
+	content := `name: Example
+format: 1
+version: 1.0.0
+
+--
+- id: language
+  description: For what language
+--
+
+Write hello world in {{language}}.
+`
+
+	converted, err := ConvertMPromptToV2([]byte(content))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := `@@@ frontmatter
+format: 2
+name: Example
+version: 1.0.0
+@@@ wizard
+- id: language
+  description: For what language
+@@@ template
+Write hello world in {{language}}.
+`
+	if string(converted) != expected {
+		t.Errorf("Expected:\n%s\nGot:\n%s", expected, converted)
+	}
+
+	if _, err := ConvertMPromptToV2(converted); err == nil {
+		t.Error("Expected error converting format 2 content")
+	}
+
+	if _, err := ConvertMPromptToV2([]byte("name: [broken\n--\n--\nHello")); err == nil {
+		t.Error("Expected error converting invalid content")
+	}
+}
+
+func TestInjectSourceIntoMPromptV2(t *testing.T) {
+	content := "@@@ frontmatter\nformat: 2\nname: Test\n@@@ template\n--\nHello"
+
+	updated, err := injectSourceIntoMPrompt([]byte(content), "file")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := ParseMPromptContent(updated, "test")
+	if err != nil {
+		t.Fatalf("Unexpected error parsing updated content: %v", err)
+	}
+	if data.Frontmatter.Source != "file" || data.Frontmatter.Format != MPromptFormatV2 {
+		t.Errorf("Unexpected frontmatter: %+v", data.Frontmatter)
+	}
+	if data.Template != "--\nHello" {
+		t.Errorf("Expected template to be unchanged, got %q", data.Template)
+	}
+}
+
+func TestConvertMPromptFiles(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	v1 := "name: Test\n--\n--\nFirst\n--\nSecond"
+	if err := afero.WriteFile(fs, "test.mprompt", []byte(v1), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := ConvertMPromptFiles(fs, []string{"test.mprompt"}, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "test.mprompt: converted to format 2") {
+		t.Errorf("Unexpected output: %q", output.String())
+	}
+	if !strings.Contains(output.String(), "test.mprompt:5: -- line was dropped") {
+		t.Errorf("Expected warning about dropped separator, got %q", output.String())
+	}
+
+	content, err := afero.ReadFile(fs, "test.mprompt")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	data, err := ParseMPromptContent(content, "test.mprompt")
+	if err != nil {
+		t.Fatalf("Converted file does not parse: %v", err)
+	}
+	if data.Template != "First\nSecond" {
+		t.Errorf("Expected template %q, got %q", "First\nSecond", data.Template)
+	}
+	if exists, _ := afero.Exists(fs, "test.mprompt.tmp"); exists {
+		t.Error("Temporary file was not removed")
+	}
+
+	output.Reset()
+	if err := ConvertMPromptFiles(fs, []string{"test.mprompt"}, &output); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(output.String(), "already format 2") {
+		t.Errorf("Unexpected output: %q", output.String())
+	}
+}
@@ -0,0 +1,131 @@
+package marvai
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/marvai-dev/marvai/internal"
+)
+
+// sharedPartialFile returns the file of a partial published in a registry repo
+func sharedPartialFile(name string) string {
+	return "partials/" + name + ".hbs"
+}
+
+// validateSharedPartials checks the partials the frontmatter lists from the registry repo.
+// Install adds them as partial sections, so they need format 2
+func validateSharedPartials(sections mpromptSections, frontmatter MPromptFrontmatter) error {
+	if len(frontmatter.Partials) == 0 {
+		return nil
+	}
+	if sections.Format != MPromptFormatV2 {
+		return fmt.Errorf("partials need format: %d", MPromptFormatV2)
+	}
+	seen := make(map[string]bool)
+	for _, name := range frontmatter.Partials {
+		if err := internal.ValidatePartialName(name); err != nil {
+			return err
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate partial %q", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// missingSharedPartials returns the partials of the frontmatter the prompt has no partial section for
+func missingSharedPartials(data *MPromptData) []string {
+	var missing []string
+	for _, name := range data.Frontmatter.Partials {
+		if _, ok := data.Partials[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// addSharedPartials downloads the partials the prompt lists from its registry repo and adds them as partial
+// sections, so rendering never needs the registry. It returns the new content and its parsed data
+func addSharedPartials(registry Registry, repo string, content []byte, data *MPromptData) ([]byte, *MPromptData, error) {
+	missing := missingSharedPartials(data)
+	if len(missing) == 0 {
+		return content, data, nil
+	}
+
+	var sections []string
+	for _, name := range missing {
+		partial, err := registry.FetchFile(repo, sharedPartialFile(name))
+		if err != nil {
+			return nil, nil, fmt.Errorf("error downloading partial %q: %w", name, err)
+		}
+
+		// SECURITY: A marker line would end the partial section and could replace the template
+		partialLines := strings.Split(string(partial), "\n")
+		for _, line := range partialLines {
+			if strings.HasPrefix(line, sectionMarkerPrefix) {
+				return nil, nil, fmt.Errorf("partial %q contains a %q line", name, strings.TrimSpace(sectionMarkerPrefix))
+			}
+		}
+
+		sections = append(sections, sectionMarkerPrefix+partialSection+" "+name)
+		sections = append(sections, trimBlankLines(partialLines)...)
+	}
+
+	lines := strings.Split(string(content), "\n")
+	marker := -1
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t\r") == sectionMarkerPrefix+templateSection {
+			marker = i
+			break
+		}
+	}
+	if marker < 0 {
+		return nil, nil, fmt.Errorf("missing @@@ template section")
+	}
+
+	result := append(append(append([]string{}, lines[:marker]...), sections...), lines[marker:]...)
+	updatedContent := []byte(strings.Join(result, "\n"))
+
+	updatedData, err := ParseMPromptContent(updatedContent, "prompt with partials")
+	if err != nil {
+		return nil, nil, fmt.Errorf("error adding partials: %w", err)
+	}
+	return updatedContent, updatedData, nil
+}
+
+// verifyPartials compares the partials of a prompt against the SHA256 hashes of its PROMPTS entry,
+// like the template. An entry pinning the template has to pin every partial
+func verifyPartials(data *MPromptData, entry PromptEntry) error {
+	// SECURITY: Unpinned partials would bypass the verification of a pinned template
+	if entry.SHA256 != "" {
+		names := make([]string, 0, len(data.Partials))
+		for name := range data.Partials {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if _, ok := entry.Partials[name]; !ok {
+				return fmt.Errorf("partial %q has no SHA256 hash in the PROMPTS entry", name)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(entry.Partials))
+	for name := range entry.Partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		partial, ok := data.Partials[name]
+		if !ok {
+			return fmt.Errorf("partial %q of the PROMPTS entry is not part of the prompt", name)
+		}
+		if err := verifySHA256([]byte(partial), entry.Partials[name]); err != nil {
+			return fmt.Errorf("partial %q: %w", name, err)
+		}
+	}
+	return nil
+}
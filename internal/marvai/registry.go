@@ -0,0 +1,377 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRegistryURL is the public marvai registry used when no registry is configured
+const DefaultRegistryURL = "https://registry.marvai.dev/dist"
+
+// defaultRepo is the repo used when no repo is given
+const defaultRepo = "marvai"
+
+// Registry abstracts a location that serves PROMPTS indexes and .mprompt files per repo
+type Registry interface {
+	// FetchIndex loads the raw PROMPTS index of a repo
+	FetchIndex(repo string) ([]byte, error)
+
+	// FetchFile loads a raw file listed in the PROMPTS index of a repo
+	FetchFile(repo string, file string) ([]byte, error)
+
+	// String returns a human-readable location of the registry (for logging/errors)
+	String() string
+}
+
+// Registries is a list of registries in priority order
+type Registries []Registry
+
+// NewRegistry creates a registry from a registry specification.
+// Supported are https:// URLs, git+<url>#<ref> repositories, file:// URLs and directory paths
+func NewRegistry(fs afero.Fs, spec string) (Registry, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, fmt.Errorf("registry cannot be empty")
+	}
+
+	if strings.HasPrefix(spec, "git+") {
+		return NewGitRegistry(spec, OSCommandRunner{}, userCacheDir())
+	}
+
+	// Paths with a volume name (e.g. C:\prompts) would be parsed as URL scheme
+	if filepath.VolumeName(spec) != "" {
+		return NewDirRegistry(fs, spec), nil
+	}
+
+	parsed, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid registry %q: %w", spec, err)
+	}
+
+	switch parsed.Scheme {
+	case "https":
+		return NewHTTPRegistry(spec, nil), nil
+	case "http":
+		return nil, fmt.Errorf("registry %q must use HTTPS for security", spec)
+	case "file":
+		if parsed.Host != "" && parsed.Host != "localhost" {
+			return nil, fmt.Errorf("registry %q must be a local file:// URL", spec)
+		}
+		if parsed.Path == "" {
+			return nil, fmt.Errorf("registry %q has no path", spec)
+		}
+		return NewDirRegistry(fs, filepath.FromSlash(parsed.Path)), nil
+	case "":
+		return NewDirRegistry(fs, spec), nil
+	default:
+		return nil, fmt.Errorf("unsupported registry %q", spec)
+	}
+}
+
+// NewRegistries creates registries from specifications, keeping their order as priority
+func NewRegistries(fs afero.Fs, specs []string) (Registries, error) {
+	var registries Registries
+	for _, spec := range specs {
+		registry, err := NewRegistry(fs, spec)
+		if err != nil {
+			return nil, err
+		}
+		registries = append(registries, registry)
+	}
+	return registries, nil
+}
+
+// ResolveRegistries combines the registries given on the command line with the configured ones.
+// Command line registries take priority, the public registry is used if nothing is configured
+func ResolveRegistries(fs afero.Fs, config *Config, flagRegistries []string) (Registries, error) {
+	specs := append([]string{}, flagRegistries...)
+	specs = append(specs, config.Registries...)
+	if len(specs) == 0 {
+		specs = []string{DefaultRegistryURL}
+	}
+	return NewRegistries(fs, specs)
+}
+
+// DefaultRegistries returns the registries from the user configuration
+func DefaultRegistries(fs afero.Fs) (Registries, error) {
+	config, err := LoadConfig(fs, userHomeDir())
+	if err != nil {
+		return nil, err
+	}
+	return ResolveRegistries(fs, config, nil)
+}
+
+// FetchPrompts fetches the PROMPTS index of a repo from all registries.
+// Prompts from registries with a higher priority shadow prompts with the same name
+func (r Registries) FetchPrompts(repo string) ([]PromptEntry, error) {
+	if len(r) == 0 {
+		return nil, fmt.Errorf("no registries configured")
+	}
+
+	var prompts []PromptEntry
+	var errs []string
+	seen := make(map[string]bool)
+	found := false
+	for _, registry := range r {
+		entries, err := fetchRegistryPrompts(registry, repo)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		found = true
+		for _, entry := range entries {
+			key := strings.ToLower(entry.Name)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			prompts = append(prompts, entry)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	for _, errMsg := range errs {
+		fmt.Printf("Warning: %s\n", errMsg)
+	}
+
+	return prompts, nil
+}
+
+// FindPrompt finds a prompt by name in the registries in priority order
+func (r Registries) FindPrompt(repo string, name string) (Registry, PromptEntry, error) {
+	if len(r) == 0 {
+		return nil, PromptEntry{}, fmt.Errorf("no registries configured")
+	}
+
+	var errs []string
+	for _, registry := range r {
+		entries, err := fetchRegistryPrompts(registry, repo)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		if entry, err := findPromptByName(entries, name); err == nil {
+			return registry, entry, nil
+		}
+	}
+
+	if len(errs) == len(r) {
+		return nil, PromptEntry{}, fmt.Errorf("%s", strings.Join(errs, "\n"))
+	}
+	return nil, PromptEntry{}, fmt.Errorf("prompt '%s' not found in remote prompts", strings.ToLower(strings.TrimSpace(name)))
+}
+
+// fetchRegistryPrompts fetches and parses the PROMPTS index of a repo from a registry
+func fetchRegistryPrompts(registry Registry, repo string) ([]PromptEntry, error) {
+	if err := validateRepoName(repo); err != nil {
+		return nil, err
+	}
+
+	content, err := registry.FetchIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return parsePromptsIndex(content), nil
+}
+
+// fetchVerifiedPrompt downloads the .mprompt file of a PROMPTS entry with its partials and verifies their SHA256 hashes
+func fetchVerifiedPrompt(registry Registry, repo string, entry PromptEntry) ([]byte, *MPromptData, error) {
+	if err := validateRegistryFile(entry.File); err != nil {
+		return nil, nil, err
+	}
+
+	content, err := registry.FetchFile(repo, entry.File)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	data, err := ParseMPromptContent(content, fmt.Sprintf("remote-%s", entry.Name))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse downloaded .mprompt file: %w", err)
+	}
+
+	// Verify SHA256 hash of the template only (not frontmatter or variables)
+	if err := verifySHA256([]byte(data.Template), entry.SHA256); err != nil {
+		return nil, nil, fmt.Errorf("SHA256 verification failed for %s in %s: %w", entry.File, registry, err)
+	}
+
+	// Partials from the repo become part of the installed prompt and are verified like the template
+	content, data, err = addSharedPartials(registry, repo, content, data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error installing %s from %s: %w", entry.File, registry, err)
+	}
+	if err := verifyPartials(data, entry); err != nil {
+		return nil, nil, fmt.Errorf("SHA256 verification failed for %s in %s: %w", entry.File, registry, err)
+	}
+
+	return content, data, nil
+}
+
+// parsePromptsIndex parses the entries of a PROMPTS index separated by --
+func parsePromptsIndex(content []byte) []PromptEntry {
+	promptsText := string(content)
+	entryTexts := strings.Split(promptsText, "--")
+
+	// Parse each entry as YAML
+	var promptEntries []PromptEntry
+	var skippedEntries int
+	for i, entryText := range entryTexts {
+		trimmed := strings.TrimSpace(entryText)
+		if trimmed == "" {
+			continue
+		}
+
+		var entry PromptEntry
+		if err := yaml.Unmarshal([]byte(trimmed), &entry); err != nil {
+			// Log warning for invalid entries but don't fail completely
+			fmt.Printf("Warning: Failed to parse prompt entry %d: %v\n", i+1, err)
+			skippedEntries++
+			continue
+		}
+
+		// Validate required fields
+		if entry.Name != "" && entry.File != "" {
+			promptEntries = append(promptEntries, entry)
+		} else {
+			fmt.Printf("Warning: Prompt entry %d missing required fields (name: %q, file: %q)\n",
+				i+1, entry.Name, entry.File)
+			skippedEntries++
+		}
+	}
+
+	if skippedEntries > 0 {
+		fmt.Printf("Warning: Skipped %d invalid prompt entries\n", skippedEntries)
+	}
+
+	return promptEntries
+}
+
+// validateRepoName ensures a repo name can be safely used in registry paths
+func validateRepoName(repo string) error {
+	if repo == "" {
+		return nil
+	}
+	if err := ValidatePromptName(repo); err != nil {
+		return fmt.Errorf("invalid repo name: %w", err)
+	}
+	return nil
+}
+
+// validateRegistryFile ensures a file from a PROMPTS index stays within its repo
+func validateRegistryFile(file string) error {
+	if file == "" {
+		return fmt.Errorf("file name cannot be empty")
+	}
+	if strings.Contains(file, "..") || strings.Contains(file, "\\") || strings.HasPrefix(file, "/") {
+		return fmt.Errorf("unsafe file name in PROMPTS index: %q", file)
+	}
+	for _, r := range file {
+		if r < 32 || r == 127 {
+			return fmt.Errorf("file name in PROMPTS index contains control characters: %q", file)
+		}
+	}
+	return nil
+}
+
+// HTTPRegistry serves PROMPTS indexes and .mprompt files over HTTPS from <base>/<repo>/<file>
+type HTTPRegistry struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPRegistry creates a new HTTPS registry, a nil client uses a client with a 30 second timeout
+func NewHTTPRegistry(baseURL string, client *http.Client) *HTTPRegistry {
+	if client == nil {
+		client = &http.Client{
+			Timeout: 30 * time.Second,
+		}
+	}
+
+	return &HTTPRegistry{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  client,
+	}
+}
+
+// FetchIndex downloads the PROMPTS index of a repo
+func (r *HTTPRegistry) FetchIndex(repo string) ([]byte, error) {
+	repo = r.repo(repo)
+	promptsURL := fmt.Sprintf("%s/%s/PROMPTS", r.baseURL, repo)
+
+	const maxSize = 1024 * 1024 // 1MB limit for prompts list
+	content, err := r.get(promptsURL, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("repo %s can't be read from %s: %w", repo, promptsURL, err)
+	}
+
+	return content, nil
+}
+
+// FetchFile downloads a file of a repo
+func (r *HTTPRegistry) FetchFile(repo string, file string) ([]byte, error) {
+	fileURL := fmt.Sprintf("%s/%s/%s", r.baseURL, r.repo(repo), file)
+
+	const maxSize = 10 * 1024 * 1024 // 10MB limit for .mprompt files
+	content, err := r.get(fileURL, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("error downloading .mprompt file from %s: %w", fileURL, err)
+	}
+
+	return content, nil
+}
+
+// String returns the base URL of the registry
+func (r *HTTPRegistry) String() string {
+	return r.baseURL
+}
+
+// repo handles the empty repo case
+func (r *HTTPRegistry) repo(repo string) string {
+	if strings.TrimSpace(repo) == "" {
+		return defaultRepo
+	}
+	return repo
+}
+
+// get downloads a URL with a size limit
+func (r *HTTPRegistry) get(fileURL string, maxSize int) ([]byte, error) {
+	resp, err := r.client.Get(fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			fmt.Printf("Warning: failed to close response body: %v\n", err)
+		}
+	}()
+
+	// Check status code
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status code: %d", resp.StatusCode)
+	}
+
+	// Read response with size limit
+	limitReader := io.LimitReader(resp.Body, int64(maxSize)+1)
+	content, err := io.ReadAll(limitReader)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check size limit
+	if len(content) > maxSize {
+		return nil, fmt.Errorf("file too large (%d bytes), maximum allowed is %d bytes", len(content), maxSize)
+	}
+
+	return content, nil
+}
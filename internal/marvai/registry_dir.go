@@ -0,0 +1,103 @@
+package marvai
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// DirRegistry serves PROMPTS indexes and .mprompt files from a plain directory.
+// A PROMPTS index at the root of the directory serves the default repo,
+// other repos live in subdirectories <dir>/<repo>/PROMPTS
+type DirRegistry struct {
+	fs   afero.Fs
+	root string
+}
+
+// NewDirRegistry creates a new directory registry
+func NewDirRegistry(fs afero.Fs, root string) *DirRegistry {
+	return &DirRegistry{
+		fs:   fs,
+		root: filepath.Clean(root),
+	}
+}
+
+// FetchIndex reads the PROMPTS index of a repo
+func (r *DirRegistry) FetchIndex(repo string) ([]byte, error) {
+	promptsFile := filepath.Join(r.repoDir(repo), "PROMPTS")
+
+	const maxSize = 1024 * 1024 // 1MB limit for prompts list
+	content, err := r.readFile(promptsFile, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("repo %s can't be read from %s: %w", r.repoName(repo), promptsFile, err)
+	}
+
+	return content, nil
+}
+
+// FetchFile reads a file of a repo
+func (r *DirRegistry) FetchFile(repo string, file string) ([]byte, error) {
+	filePath := filepath.Join(r.repoDir(repo), filepath.FromSlash(file))
+
+	const maxSize = 10 * 1024 * 1024 // 10MB limit for .mprompt files
+	content, err := r.readFile(filePath, maxSize)
+	if err != nil {
+		return nil, fmt.Errorf("error reading .mprompt file from %s: %w", filePath, err)
+	}
+
+	return content, nil
+}
+
+// String returns the directory of the registry
+func (r *DirRegistry) String() string {
+	return r.root
+}
+
+// repoName handles the empty repo case
+func (r *DirRegistry) repoName(repo string) string {
+	if strings.TrimSpace(repo) == "" {
+		return defaultRepo
+	}
+	return repo
+}
+
+// repoDir returns the directory holding the PROMPTS index of a repo
+func (r *DirRegistry) repoDir(repo string) string {
+	repo = r.repoName(repo)
+	repoDir := filepath.Join(r.root, repo)
+	if exists, err := afero.Exists(r.fs, filepath.Join(repoDir, "PROMPTS")); err == nil && exists {
+		return repoDir
+	}
+
+	// A PROMPTS index at the root of the registry serves the default repo
+	if repo == defaultRepo {
+		return r.root
+	}
+	return repoDir
+}
+
+// readFile reads a regular file of the registry with a size limit
+func (r *DirRegistry) readFile(filePath string, maxSize int64) ([]byte, error) {
+	// SECURITY: Prevent symlink attacks by checking the file and the directories on the way to it,
+	// a symlinked directory could lead outside of the registry
+	if err := validatePathHasNoSymlinks(r.fs, r.root, filePath); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	info, err := r.fs.Stat(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", filePath)
+	}
+
+	// Check size limit
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("file too large (%d bytes), maximum allowed is %d bytes", info.Size(), maxSize)
+	}
+
+	return afero.ReadFile(r.fs, filePath)
+}
@@ -0,0 +1,168 @@
+package marvai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// GitRegistry serves PROMPTS indexes and .mprompt files from a checkout of a git repository.
+// The registry is given as git+<url>#<ref>, e.g. git+ssh://host/prompts.git#v3
+type GitRegistry struct {
+	spec     string
+	url      string
+	ref      string
+	runner   CommandRunner
+	checkout string
+	synced   bool
+	dir      *DirRegistry
+}
+
+// NewGitRegistry creates a new git registry which clones into a subdirectory of cacheDir
+func NewGitRegistry(spec string, runner CommandRunner, cacheDir string) (*GitRegistry, error) {
+	repoURL, ref, err := parseGitRegistrySpec(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	if cacheDir == "" {
+		return nil, fmt.Errorf("no cache directory for git registry %q", spec)
+	}
+
+	// One checkout per repository URL, different refs share the checkout
+	hash := sha256.Sum256([]byte(repoURL))
+	checkout := filepath.Join(cacheDir, "registries", hex.EncodeToString(hash[:])[:16])
+
+	return &GitRegistry{
+		spec:     spec,
+		url:      repoURL,
+		ref:      ref,
+		runner:   runner,
+		checkout: checkout,
+		dir:      NewDirRegistry(afero.NewOsFs(), checkout),
+	}, nil
+}
+
+// parseGitRegistrySpec splits a git+<url>#<ref> specification into URL and ref
+func parseGitRegistrySpec(spec string) (string, string, error) {
+	if !strings.HasPrefix(spec, "git+") {
+		return "", "", fmt.Errorf("git registry %q must start with git+", spec)
+	}
+
+	repoURL := strings.TrimPrefix(spec, "git+")
+	ref := "HEAD"
+	if index := strings.LastIndex(repoURL, "#"); index >= 0 {
+		ref = repoURL[index+1:]
+		repoURL = repoURL[:index]
+	}
+
+	parsed, err := url.Parse(repoURL)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid git registry %q: %w", spec, err)
+	}
+
+	// SECURITY: Only allow well-known transports, no ext:: or other remote helpers
+	switch parsed.Scheme {
+	case "ssh", "https", "file":
+	default:
+		return "", "", fmt.Errorf("git registry %q must use ssh, https or file transport", spec)
+	}
+
+	if err := validateGitRef(ref); err != nil {
+		return "", "", fmt.Errorf("invalid ref in git registry %q: %w", spec, err)
+	}
+
+	return repoURL, ref, nil
+}
+
+// validateGitRef ensures a ref can't be interpreted as a git option or contain unsafe characters
+func validateGitRef(ref string) error {
+	if ref == "" {
+		return fmt.Errorf("ref cannot be empty")
+	}
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("ref cannot start with '-'")
+	}
+	if strings.Contains(ref, "..") {
+		return fmt.Errorf("ref cannot contain '..'")
+	}
+	for _, r := range ref {
+		if r <= 32 || r == 127 || r == '\\' || r == ':' || r == '~' || r == '^' {
+			return fmt.Errorf("ref contains invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// FetchIndex reads the PROMPTS index of a repo from the checkout
+func (r *GitRegistry) FetchIndex(repo string) ([]byte, error) {
+	if err := r.sync(); err != nil {
+		return nil, err
+	}
+	return r.dir.FetchIndex(repo)
+}
+
+// FetchFile reads a file of a repo from the checkout
+func (r *GitRegistry) FetchFile(repo string, file string) ([]byte, error) {
+	if err := r.sync(); err != nil {
+		return nil, err
+	}
+	return r.dir.FetchFile(repo, file)
+}
+
+// String returns the registry specification
+func (r *GitRegistry) String() string {
+	return r.spec
+}
+
+// sync clones or fetches the repository and checks out the ref, once per registry
+func (r *GitRegistry) sync() error {
+	if r.synced {
+		return nil
+	}
+
+	if _, err := r.runner.LookPath("git"); err != nil {
+		return fmt.Errorf("git is required for git registry %s: %w", r.spec, err)
+	}
+
+	if _, err := os.Stat(filepath.Join(r.checkout, ".git")); err != nil {
+		if err := os.MkdirAll(filepath.Dir(r.checkout), 0700); err != nil {
+			return fmt.Errorf("error creating cache directory for %s: %w", r.spec, err)
+		}
+		// Remove leftovers of an interrupted clone
+		if err := os.RemoveAll(r.checkout); err != nil {
+			return fmt.Errorf("error cleaning cache directory for %s: %w", r.spec, err)
+		}
+		if err := r.git("clone", "--quiet", "--no-checkout", "--", r.url, r.checkout); err != nil {
+			return err
+		}
+	}
+
+	if err := r.git("-C", r.checkout, "fetch", "--quiet", "--force", "--", r.url, r.ref); err != nil {
+		return err
+	}
+	if err := r.git("-C", r.checkout, "checkout", "--quiet", "--force", "--detach", "FETCH_HEAD"); err != nil {
+		return err
+	}
+
+	r.synced = true
+	return nil
+}
+
+// git runs a git command without interactive prompts
+func (r *GitRegistry) git(args ...string) error {
+	// SECURITY: Disable remote helpers that can run arbitrary commands
+	args = append([]string{"-c", "protocol.ext.allow=never"}, args...)
+	cmd := r.runner.Command("git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git registry %s can't be read: %w: %s", r.spec, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
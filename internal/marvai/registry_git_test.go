@@ -0,0 +1,176 @@
+package marvai
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// runGit runs a git command in dir for test setup
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	args = append([]string{"-c", "user.name=Test", "-c", "user.email=test@example.com", "-c", "init.defaultBranch=main"}, args...)
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+}
+
+// writeRegistryFiles writes a PROMPTS index and a prompt file into dir
+func writeRegistryFiles(t *testing.T, dir string, version string, template string) {
+	t.Helper()
+	index := "name: review\nversion: " + version + "\nfile: review.mprompt\nsha256: " + templateHash(template) + "\n"
+	prompt := "name: review\nversion: " + version + "\n--\n--\n" + template
+	if err := os.WriteFile(filepath.Join(dir, "PROMPTS"), []byte(index), 0644); err != nil {
+		t.Fatalf("Failed to write PROMPTS: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "review.mprompt"), []byte(prompt), 0644); err != nil {
+		t.Fatalf("Failed to write review.mprompt: %v", err)
+	}
+}
+
+func TestGitRegistry(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// Set up a bare repository as stand-in for the remote prompt catalog
+	baseDir := t.TempDir()
+	bareDir := filepath.Join(baseDir, "prompts.git")
+	workDir := filepath.Join(baseDir, "work")
+	if err := os.MkdirAll(workDir, 0755); err != nil {
+		t.Fatalf("Failed to create work dir: %v", err)
+	}
+	runGit(t, baseDir, "init", "--quiet", "--bare", bareDir)
+	runGit(t, workDir, "init", "--quiet")
+	writeRegistryFiles(t, workDir, "1.0.0", "Review v1")
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "--quiet", "-m", "v1")
+	runGit(t, workDir, "tag", "v1")
+	writeRegistryFiles(t, workDir, "2.0.0", "Review v2")
+	runGit(t, workDir, "commit", "--quiet", "-am", "v2")
+	runGit(t, workDir, "push", "--quiet", "--tags", bareDir, "main")
+
+	cacheDir := t.TempDir()
+	tests := []struct {
+		name             string
+		ref              string
+		expectedVersion  string
+		expectedTemplate string
+	}{
+		{"tag", "#v1", "1.0.0", "Review v1"},
+		{"branch", "#main", "2.0.0", "Review v2"},
+		{"default ref", "", "2.0.0", "Review v2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := NewGitRegistry("git+file://"+filepath.ToSlash(bareDir)+tt.ref, OSCommandRunner{}, cacheDir)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			found, entry, err := Registries{registry}.FindPrompt("", "review")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if entry.Version != tt.expectedVersion {
+				t.Errorf("Expected version %q, got %q", tt.expectedVersion, entry.Version)
+			}
+
+			_, data, err := fetchVerifiedPrompt(found, "", entry)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data.Template != tt.expectedTemplate {
+				t.Errorf("Expected template %q, got %q", tt.expectedTemplate, data.Template)
+			}
+		})
+	}
+
+	missing, err := NewGitRegistry("git+file://"+filepath.ToSlash(bareDir)+"#missing", OSCommandRunner{}, cacheDir)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := missing.FetchIndex(""); err == nil {
+		t.Error("Expected error for missing ref")
+	}
+}
+
+func TestParseGitRegistrySpec(t *testing.T) {
+	tests := []struct {
+		spec        string
+		expectedURL string
+		expectedRef string
+		expectError bool
+	}{
+		{spec: "git+ssh://host/prompts.git#v3", expectedURL: "ssh://host/prompts.git", expectedRef: "v3"},
+		{spec: "git+https://host/prompts.git", expectedURL: "https://host/prompts.git", expectedRef: "HEAD"},
+		{spec: "git+file:///srv/prompts.git#release/1.0", expectedURL: "file:///srv/prompts.git", expectedRef: "release/1.0"},
+		{spec: "git+ext::sh -c touch% /tmp/pwned", expectError: true},
+		{spec: "git+http://host/prompts.git", expectError: true},
+		{spec: "git+ssh://host/prompts.git#--upload-pack=evil", expectError: true},
+		{spec: "git+ssh://host/prompts.git#", expectError: true},
+		{spec: "ssh://host/prompts.git", expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			repoURL, ref, err := parseGitRegistrySpec(tt.spec)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q but got none", tt.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if repoURL != tt.expectedURL || ref != tt.expectedRef {
+				t.Errorf("Expected %q#%q, got %q#%q", tt.expectedURL, tt.expectedRef, repoURL, ref)
+			}
+		})
+	}
+}
+
+func TestGitRegistrySymlinkedDirectory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not available")
+	}
+
+	// The remote commits a directory symlink leading outside of the checkout
+	baseDir := t.TempDir()
+	bareDir := filepath.Join(baseDir, "prompts.git")
+	workDir := filepath.Join(baseDir, "work")
+	outside := filepath.Join(baseDir, "outside")
+	for _, dir := range []string{workDir, outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(outside, "review.mprompt"), []byte("name: review\n--\n--\nOutside"), 0644); err != nil {
+		t.Fatalf("Failed to write review.mprompt: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(workDir, "PROMPTS"), []byte("name: review\nfile: nested/review.mprompt\n"), 0644); err != nil {
+		t.Fatalf("Failed to write PROMPTS: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(workDir, "nested")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	runGit(t, baseDir, "init", "--quiet", "--bare", bareDir)
+	runGit(t, workDir, "init", "--quiet")
+	runGit(t, workDir, "add", ".")
+	runGit(t, workDir, "commit", "--quiet", "-m", "symlink")
+	runGit(t, workDir, "push", "--quiet", bareDir, "main")
+
+	registry, err := NewGitRegistry("git+file://"+filepath.ToSlash(bareDir), OSCommandRunner{}, t.TempDir())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := registry.FetchFile("", "nested/review.mprompt"); err == nil || !strings.Contains(err.Error(), "symbolic link") {
+		t.Errorf("Expected symlinked directory to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,317 @@
+package marvai
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// newTestHTTPRegistry starts a TLS test server serving the given files and returns a registry for it
+func newTestHTTPRegistry(t *testing.T, files map[string]string) *HTTPRegistry {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Errorf("Failed to write response: %v", err)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return NewHTTPRegistry(server.URL+"/dist", server.Client())
+}
+
+func templateHash(template string) string {
+	sum := sha256.Sum256([]byte(template))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name        string
+		spec        string
+		expectError bool
+	}{
+		{"https registry", "https://registry.example.com/dist", false},
+		{"http registry is rejected", "http://registry.example.com/dist", true},
+		{"empty registry", "  ", true},
+		{"unknown scheme", "ftp://registry.example.com/dist", true},
+		{"file registry", "file:///srv/prompts", false},
+		{"remote file registry", "file://fileserver/srv/prompts", true},
+		{"path registry", "./prompts", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRegistry(afero.NewMemMapFs(), tt.spec)
+			if tt.expectError && err == nil {
+				t.Errorf("Expected error for %q but got none", tt.spec)
+			}
+			if !tt.expectError && err != nil {
+				t.Errorf("Unexpected error for %q: %v", tt.spec, err)
+			}
+		})
+	}
+}
+
+func TestResolveRegistries(t *testing.T) {
+	tests := []struct {
+		name          string
+		config        *Config
+		flags         []string
+		expectedOrder []string
+	}{
+		{
+			name:          "defaults to public registry",
+			config:        &Config{},
+			expectedOrder: []string{DefaultRegistryURL},
+		},
+		{
+			name:          "configured registries replace the default",
+			config:        &Config{Registries: []string{"https://internal.example.com/dist"}},
+			expectedOrder: []string{"https://internal.example.com/dist"},
+		},
+		{
+			name:          "flags take priority over configuration",
+			config:        &Config{Registries: []string{"https://internal.example.com/dist"}},
+			flags:         []string{"https://flag.example.com/dist/"},
+			expectedOrder: []string{"https://flag.example.com/dist", "https://internal.example.com/dist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registries, err := ResolveRegistries(afero.NewMemMapFs(), tt.config, tt.flags)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(registries) != len(tt.expectedOrder) {
+				t.Fatalf("Expected %d registries, got %d", len(tt.expectedOrder), len(registries))
+			}
+			for i, expected := range tt.expectedOrder {
+				if registries[i].String() != expected {
+					t.Errorf("Registry %d: expected %q, got %q", i, expected, registries[i].String())
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	fs := afero.NewMemMapFs()
+
+	// Missing configuration file results in empty configuration
+	config, err := LoadConfig(fs, "/home/test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Registries) != 0 {
+		t.Errorf("Expected no registries, got %v", config.Registries)
+	}
+
+	content := "registries:\n  - https://internal.example.com/dist\n  - https://registry.marvai.dev/dist\n"
+	if err := afero.WriteFile(fs, "/home/test/.config/marvai/config.yaml", []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+
+	config, err = LoadConfig(fs, "/home/test")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(config.Registries) != 2 || config.Registries[0] != "https://internal.example.com/dist" {
+		t.Errorf("Unexpected registries: %v", config.Registries)
+	}
+
+	if err := afero.WriteFile(fs, "/home/test/.config/marvai/config.yaml", []byte("registries: [invalid"), 0644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	if _, err := LoadConfig(fs, "/home/test"); err == nil {
+		t.Error("Expected error for invalid config file but got none")
+	}
+}
+
+func TestRegistriesFetchPrompts(t *testing.T) {
+	internalRegistry := newTestHTTPRegistry(t, map[string]string{
+		"/dist/marvai/PROMPTS": "name: review\ndescription: Internal review\nversion: 2.0.0\nfile: review.mprompt\n",
+	})
+	publicRegistry := newTestHTTPRegistry(t, map[string]string{
+		"/dist/marvai/PROMPTS": "name: review\ndescription: Public review\nversion: 1.0.0\nfile: review.mprompt\n--\nname: hello\nfile: hello.mprompt\n",
+	})
+	brokenRegistry := newTestHTTPRegistry(t, map[string]string{})
+
+	registries := Registries{brokenRegistry, internalRegistry, publicRegistry}
+	prompts, err := registries.FetchPrompts("")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(prompts) != 2 {
+		t.Fatalf("Expected 2 prompts, got %d: %v", len(prompts), prompts)
+	}
+	if prompts[0].Description != "Internal review" {
+		t.Errorf("Expected internal registry to shadow public registry, got %q", prompts[0].Description)
+	}
+
+	if _, err := (Registries{brokenRegistry}).FetchPrompts(""); err == nil {
+		t.Error("Expected error when no registry can be read")
+	}
+
+	if _, err := registries.FetchPrompts("../etc"); err == nil {
+		t.Error("Expected error for unsafe repo name")
+	}
+}
+
+func TestRegistriesFindPromptAndFetch(t *testing.T) {
+	template := "Hello {{name}}!"
+	content := "name: hello\nversion: 1.0.0\n--\n- id: name\n  description: Name\n--\n" + template
+
+	internalRegistry := newTestHTTPRegistry(t, map[string]string{
+		"/dist/company/PROMPTS": "name: other\nfile: other.mprompt\n",
+	})
+	publicRegistry := newTestHTTPRegistry(t, map[string]string{
+		"/dist/company/PROMPTS":          "name: hello\nfile: hello.mprompt\nsha256: " + templateHash(template) + "\n--\nname: tampered\nfile: tampered.mprompt\nsha256: " + templateHash("other") + "\n--\nname: escape\nfile: ../secret.mprompt\n",
+		"/dist/company/hello.mprompt":    content,
+		"/dist/company/tampered.mprompt": content,
+	})
+	registries := Registries{internalRegistry, publicRegistry}
+
+	registry, entry, err := registries.FindPrompt("company", "hello")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if registry != publicRegistry {
+		t.Errorf("Expected prompt to be found in the second registry, got %s", registry)
+	}
+
+	_, data, err := fetchVerifiedPrompt(registry, "company", entry)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if data.Template != template {
+		t.Errorf("Expected template %q, got %q", template, data.Template)
+	}
+
+	_, entry, err = registries.FindPrompt("company", "tampered")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := fetchVerifiedPrompt(publicRegistry, "company", entry); err == nil || !strings.Contains(err.Error(), "SHA256") {
+		t.Errorf("Expected SHA256 verification error, got %v", err)
+	}
+
+	_, entry, err = registries.FindPrompt("company", "escape")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := fetchVerifiedPrompt(publicRegistry, "company", entry); err == nil {
+		t.Error("Expected error for file outside of the repo")
+	}
+
+	if _, _, err := registries.FindPrompt("company", "missing"); err == nil {
+		t.Error("Expected error for missing prompt")
+	}
+}
+
+func TestListRemotePromptsFromRegistriesError(t *testing.T) {
+	registries := Registries{newTestHTTPRegistry(t, nil), newTestHTTPRegistry(t, nil)}
+
+	err := ListRemotePromptsFromRegistries(afero.NewMemMapFs(), "", registries)
+	if err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("Expected registry error, got %v", err)
+	}
+}
+
+func TestDirRegistry(t *testing.T) {
+	template := "Review {{target}}"
+	content := "name: review\nversion: 1.0.0\n--\n- id: target\n  description: Target\n--\n" + template
+
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		"/srv/prompts/PROMPTS":                    "name: review\nversion: 1.0.0\nfile: review.mprompt\nsha256: " + templateHash(template) + "\n",
+		"/srv/prompts/review.mprompt":             content,
+		"/srv/prompts/team/PROMPTS":               "name: team-review\nfile: nested/review.mprompt\nsha256: " + templateHash("tampered") + "\n",
+		"/srv/prompts/team/nested/review.mprompt": content,
+	}
+	for path, fileContent := range files {
+		if err := afero.WriteFile(fs, path, []byte(fileContent), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	for _, spec := range []string{"/srv/prompts", "file:///srv/prompts"} {
+		t.Run(spec, func(t *testing.T) {
+			registry, err := NewRegistry(fs, spec)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			registries := Registries{registry}
+
+			// Root PROMPTS index serves the default repo
+			prompts, err := registries.FetchPrompts("")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(prompts) != 1 || prompts[0].Name != "review" {
+				t.Fatalf("Unexpected prompts: %v", prompts)
+			}
+
+			_, data, err := fetchVerifiedPrompt(registry, "", prompts[0])
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if data.Template != template {
+				t.Errorf("Expected template %q, got %q", template, data.Template)
+			}
+
+			// Named repos live in subdirectories and use the same SHA256 verification
+			found, entry, err := registries.FindPrompt("team", "team-review")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if _, _, err := fetchVerifiedPrompt(found, "team", entry); err == nil || !strings.Contains(err.Error(), "SHA256") {
+				t.Errorf("Expected SHA256 verification error, got %v", err)
+			}
+
+			if _, err := registries.FetchPrompts("missing"); err == nil {
+				t.Error("Expected error for missing repo")
+			}
+		})
+	}
+}
+
+func TestDirRegistrySymlinkedDirectories(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	files := map[string]string{
+		filepath.Join(outside, "PROMPTS"):        "name: review\nfile: review.mprompt\n",
+		filepath.Join(outside, "review.mprompt"): "name: review\n--\n--\nOutside",
+		filepath.Join(root, "PROMPTS"):           "name: review\nfile: nested/review.mprompt\n",
+	}
+	for path, content := range files {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	for _, link := range []string{"team", "nested"} {
+		if err := os.Symlink(outside, filepath.Join(root, link)); err != nil {
+			t.Fatalf("Failed to create symlink: %v", err)
+		}
+	}
+
+	registry := NewDirRegistry(afero.NewOsFs(), root)
+	if _, err := registry.FetchIndex("team"); err == nil || !strings.Contains(err.Error(), "symbolic link") {
+		t.Errorf("Expected symlinked repo directory to be refused, got %v", err)
+	}
+	if _, err := registry.FetchFile("", "nested/review.mprompt"); err == nil || !strings.Contains(err.Error(), "symbolic link") {
+		t.Errorf("Expected symlinked directory to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+package marvai
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/afero"
+)
+
+// maxRepoHelperOutput limits what git returns for the repo helpers, like the output of a prompt
+const maxRepoHelperOutput = 10 * 1024 * 1024
+
+// gitRepo is the git repository of the working directory for the repo helpers of a template.
+// It asks git for the root and the files only when a template uses a repo helper
+type gitRepo struct {
+	fs     afero.Fs
+	runner CommandRunner
+	root   string
+	files  []string
+	known  map[string]bool
+	err    error
+	loaded bool
+}
+
+// newGitRepo returns the git repository of the working directory
+func newGitRepo(fs afero.Fs, runner CommandRunner) *gitRepo {
+	return &gitRepo{fs: fs, runner: runner}
+}
+
+// load finds the repository root and its files that .gitignore doesn't ignore
+func (r *gitRepo) load() error {
+	if r.loaded {
+		return r.err
+	}
+	r.loaded = true
+
+	r.root = gitOutput(r.runner, "rev-parse", "--show-toplevel")
+	if r.root == "" {
+		r.err = errors.New("not in a git repository")
+		return r.err
+	}
+
+	output, err := r.git("ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		r.err = fmt.Errorf("error listing files: %w", err)
+		return r.err
+	}
+
+	r.known = make(map[string]bool)
+	for _, name := range strings.Split(output, "\x00") {
+		if name == "" || r.known[name] {
+			continue
+		}
+		// SECURITY: Symlinks could point outside of the repository, deleted files and submodules have no content
+		if r.validateNoSymlinks(name) != nil {
+			continue
+		}
+		if info, err := r.fs.Stat(r.path(name)); err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		r.known[name] = true
+		r.files = append(r.files, name)
+	}
+	sort.Strings(r.files)
+	return nil
+}
+
+// Files returns the files of the repository that .gitignore doesn't ignore, sorted
+func (r *gitRepo) Files() ([]string, error) {
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r.files, nil
+}
+
+// ReadFile reads a file of the repository, paths outside of it, symlinks and ignored files are refused
+func (r *gitRepo) ReadFile(name string) ([]byte, error) {
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+
+	// SECURITY: Jail the helpers to the repository root
+	cleanName := path.Clean(name)
+	if path.IsAbs(cleanName) || cleanName == ".." || strings.HasPrefix(cleanName, "../") || strings.Contains(name, "\\") {
+		return nil, fmt.Errorf("file %q is outside of the repository", name)
+	}
+
+	if err := r.validateNoSymlinks(cleanName); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	if !r.known[cleanName] {
+		return nil, fmt.Errorf("file %q is not a file of the repository or ignored by .gitignore", name)
+	}
+
+	// SECURITY: Limit the file size
+	info, err := r.fs.Stat(r.path(cleanName))
+	if err != nil {
+		return nil, err
+	}
+	if info.Size() > maxRepoHelperOutput {
+		return nil, fmt.Errorf("file %q is too large (max %d bytes)", name, maxRepoHelperOutput)
+	}
+
+	return afero.ReadFile(r.fs, r.path(cleanName))
+}
+
+// Diff returns the diff of the working tree against a git ref
+func (r *gitRepo) Diff(ref string) (string, error) {
+	if err := r.load(); err != nil {
+		return "", err
+	}
+	if err := validateDiffRef(ref); err != nil {
+		return "", err
+	}
+
+	// The -- ends the revisions, so the ref can't be taken as a path
+	return r.git("diff", "--no-color", "--no-ext-diff", ref, "--")
+}
+
+// git runs a git command in the repository root and returns its output
+func (r *gitRepo) git(arg ...string) (string, error) {
+	var stdout limitedBuffer
+	var stderr bytes.Buffer
+	stdout.limit = maxRepoHelperOutput
+
+	cmd := r.runner.Command("git", append([]string{"-C", r.root}, arg...)...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if stdout.exceeded {
+			return "", fmt.Errorf("git output is too large (max %d bytes)", maxRepoHelperOutput)
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s failed: %s", arg[0], message)
+		}
+		return "", fmt.Errorf("git %s failed: %w", arg[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// path returns the path of a repository file on the filesystem
+func (r *gitRepo) path(name string) string {
+	return filepath.Join(r.root, filepath.FromSlash(name))
+}
+
+// validateNoSymlinks checks a repository file and every directory on the way to it,
+// a symlinked directory could leave the repository
+func (r *gitRepo) validateNoSymlinks(name string) error {
+	return validatePathHasNoSymlinks(r.fs, r.root, r.path(name))
+}
+
+// validateDiffRef checks a ref for {{git_diff}}. Unlike registry refs it allows revisions like HEAD~3 and
+// ranges like main...HEAD
+func validateDiffRef(ref string) error {
+	if ref == "" {
+		return errors.New("git ref cannot be empty")
+	}
+	// SECURITY: A ref starting with - would be taken as an option of git diff
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid git ref %q", ref)
+	}
+	for _, r := range ref {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return fmt.Errorf("invalid git ref %q", ref)
+		}
+	}
+	return nil
+}
+
+// limitedBuffer is a buffer that fails writes beyond its limit
+type limitedBuffer struct {
+	bytes.Buffer
+	limit    int
+	exceeded bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		b.exceeded = true
+		return 0, fmt.Errorf("output exceeds %d bytes", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
@@ -0,0 +1,167 @@
+package marvai
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// repoCommandRunner answers git commands with fixed outputs, NUL bytes included, unknown commands fail like git
+type repoCommandRunner struct {
+	outputs map[string]string
+}
+
+func (r repoCommandRunner) Command(name string, arg ...string) *exec.Cmd {
+	if output, ok := r.outputs[strings.Join(arg, " ")]; ok {
+		format := strings.ReplaceAll(strings.ReplaceAll(output, "%", "%%"), "\x00", `\0`)
+		return exec.Command("printf", format)
+	}
+	return exec.Command("sh", "-c", "echo 'fatal: bad revision' >&2; exit 128")
+}
+
+func (r repoCommandRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func newRepoCommandRunner(root string, files ...string) repoCommandRunner {
+	return repoCommandRunner{outputs: map[string]string{
+		"rev-parse --show-toplevel":                                        root + "\n",
+		"-C " + root + " ls-files -z --cached --others --exclude-standard": strings.Join(files, "\x00") + "\x00",
+		"-C " + root + " diff --no-color --no-ext-diff main --":            "diff --git a/go.mod b/go.mod\n",
+	}}
+}
+
+func TestGitRepo(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	files := map[string]string{
+		filepath.Join(root, "go.mod"):          "module example.com/app\n",
+		filepath.Join(root, "cmd", "main.go"):  "package main\n",
+		filepath.Join(root, "secret.env"):      "TOKEN=abc\n",
+		filepath.Join(outside, "passwd"):       "root:x:0:0\n",
+		filepath.Join(outside, "docs", "a.md"): "# Outside\n",
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	if err := os.Symlink(filepath.Join(outside, "passwd"), filepath.Join(root, "link.txt")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "docs"), filepath.Join(root, "docs")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	// secret.env is ignored by .gitignore, deleted.go is deleted but still in the index
+	runner := newRepoCommandRunner(root, "go.mod", "cmd/main.go", "link.txt", "docs/a.md", "deleted.go", "go.mod")
+	repo := newGitRepo(afero.NewOsFs(), runner)
+
+	names, err := repo.Files()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(names, ",") != "cmd/main.go,go.mod" {
+		t.Errorf("Expected cmd/main.go and go.mod, got %v", names)
+	}
+
+	readTests := []struct {
+		name        string
+		path        string
+		expected    string
+		expectError string
+	}{
+		{name: "file", path: "go.mod", expected: "module example.com/app\n"},
+		{name: "file in a directory", path: "cmd/../cmd/main.go", expected: "package main\n"},
+		{name: "parent directory", path: "../passwd", expectError: "outside of the repository"},
+		{name: "absolute path", path: filepath.Join(outside, "passwd"), expectError: "outside of the repository"},
+		{name: "ignored file", path: "secret.env", expectError: "not a file of the repository or ignored by .gitignore"},
+		{name: "symlink", path: "link.txt", expectError: "is a symbolic link"},
+		{name: "symlinked directory", path: "docs/a.md", expectError: "is a symbolic link"},
+	}
+	for _, tt := range readTests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := repo.ReadFile(tt.path)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+
+	diffTests := []struct {
+		name        string
+		ref         string
+		expected    string
+		expectError string
+	}{
+		{name: "diff", ref: "main", expected: "diff --git a/go.mod b/go.mod\n"},
+		{name: "option as ref", ref: "--output=/tmp/diff", expectError: `invalid git ref "--output=/tmp/diff"`},
+		{name: "ref with whitespace", ref: "main extra", expectError: `invalid git ref "main extra"`},
+		{name: "unknown ref", ref: "HEAD~3", expectError: "git diff failed: fatal: bad revision"},
+	}
+	for _, tt := range diffTests {
+		t.Run(tt.name, func(t *testing.T) {
+			diff, err := repo.Diff(tt.ref)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if diff != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, diff)
+			}
+		})
+	}
+}
+
+func TestGitRepoOutsideOfRepository(t *testing.T) {
+	repo := newGitRepo(afero.NewMemMapFs(), repoCommandRunner{})
+	if _, err := repo.Files(); err == nil || !strings.Contains(err.Error(), "not in a git repository") {
+		t.Errorf("Expected not in a git repository error, got %v", err)
+	}
+}
+
+func TestLoadPromptRepoHelpers(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		".marvai/review.mprompt": "name: Review\n--\n--\nReview the module:\n{{file \"go.mod\"}}\n{{tree}}",
+		"/src/app/go.mod":        "module example.com/app\n",
+		"/src/app/main.go":       "package main\n",
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	runner := newRepoCommandRunner("/src/app", "main.go", "go.mod")
+	content, err := LoadPromptWithOptions(fs, "review", PromptOptions{Runner: runner})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "Review the module:\nmodule example.com/app\n\n.\n├── go.mod\n└── main.go"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+}
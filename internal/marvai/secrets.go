@@ -0,0 +1,379 @@
+package marvai
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+// secretRefPrefix marks a .var value that references a value in the secret store, e.g. secret:4f1c...
+const secretRefPrefix = "secret:"
+
+// secretRefRegex matches references to the secret store
+var secretRefRegex = regexp.MustCompile(`^secret:[0-9a-f]{32}$`)
+
+// secretStoreHeader is the first line of the encrypted secret store
+const secretStoreHeader = "marvai-secrets-v1"
+
+// secretKeyEnv is the environment variable with the hex key of the secret store, which is then never written to disk
+const secretKeyEnv = "MARVAI_SECRET_KEY"
+
+// isSecret reports if values of the variable are kept in the secret store instead of the .var file
+func (v WizardVariable) isSecret() bool {
+	return v.Secret || v.variableType() == VarTypeSecret
+}
+
+// hidesInput reports if input for the variable is read without echo
+func (v WizardVariable) hidesInput() bool {
+	return v.isSecret() && (v.variableType() == VarTypeString || v.variableType() == VarTypeSecret)
+}
+
+// isSecretRef reports if a value references the secret store
+func isSecretRef(value interface{}) bool {
+	text, ok := value.(string)
+	return ok && secretRefRegex.MatchString(text)
+}
+
+// SecretStore keeps secret variable values encrypted in the user's configuration directory, outside of repositories.
+// By default the key lives next to the store with user-only permissions, which only protects copies of the store
+// file alone. Anyone who can read the configuration directory, e.g. from a backup, can decrypt the store unless
+// the key comes from MARVAI_SECRET_KEY
+type SecretStore struct {
+	fs      afero.Fs
+	dir     string
+	storage string
+	keyFile string
+	envKey  string
+}
+
+// NewSecretStore returns the secret store in ~/.config/marvai of homeDir
+func NewSecretStore(fs afero.Fs, homeDir string) *SecretStore {
+	dir := userConfigDir(homeDir)
+	return &SecretStore{
+		fs:      fs,
+		dir:     dir,
+		storage: filepath.Join(dir, "secrets.enc"),
+		keyFile: filepath.Join(dir, "secrets.key"),
+		envKey:  os.Getenv(secretKeyEnv),
+	}
+}
+
+// homeDir returns the home directory of the user the options are for
+func (opts InstallOptions) homeDir() string {
+	if opts.HomeDir != "" {
+		return opts.HomeDir
+	}
+	return userHomeDir()
+}
+
+// secretStore returns the secret store of the user the options are for
+func (opts InstallOptions) secretStore(fs afero.Fs) (*SecretStore, error) {
+	homeDir := opts.homeDir()
+	if homeDir == "" {
+		return nil, fmt.Errorf("secret variables need a home directory for the secret store")
+	}
+	return NewSecretStore(fs, homeDir), nil
+}
+
+// Get returns the value of a secret reference
+func (s *SecretStore) Get(ref string) (interface{}, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+	value, ok := secrets[strings.TrimPrefix(ref, secretRefPrefix)]
+	if !ok {
+		return nil, fmt.Errorf("secret %s not found in %s", ref, s.storage)
+	}
+	return value, nil
+}
+
+// Put stores values under their references, empty references get a new one. It returns the references
+func (s *SecretStore) Put(values map[string]interface{}, refs map[string]string) (map[string]string, error) {
+	secrets, err := s.load()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		ref := refs[key]
+		if !secretRefRegex.MatchString(ref) {
+			id := make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				return nil, fmt.Errorf("error creating secret reference: %w", err)
+			}
+			ref = secretRefPrefix + hex.EncodeToString(id)
+		}
+		secrets[strings.TrimPrefix(ref, secretRefPrefix)] = value
+		result[key] = ref
+	}
+
+	if err := s.save(secrets); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// load decrypts the secret store, a missing store is empty
+func (s *SecretStore) load() (map[string]interface{}, error) {
+	secrets := make(map[string]interface{})
+
+	// SECURITY: Never read secrets through a symlink
+	if err := validateFileIsNotSymlink(s.fs, s.storage); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	content, err := afero.ReadFile(s.fs, s.storage)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return secrets, nil
+		}
+		return nil, fmt.Errorf("error reading secret store: %w", err)
+	}
+
+	// SECURITY: Limit store size to prevent memory exhaustion
+	if len(content) > 1024*1024 { // 1MB limit
+		return nil, fmt.Errorf("secret store too large (%d bytes), maximum allowed is 1MB", len(content))
+	}
+
+	header, encoded, found := strings.Cut(string(content), "\n")
+	if !found || header != secretStoreHeader {
+		return nil, fmt.Errorf("secret store %s has an unknown format", s.storage)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding secret store: %w", err)
+	}
+
+	key, err := s.key(false)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("secret store %s is corrupted", s.storage)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(secretStoreHeader))
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting secret store %s: %w", s.storage, err)
+	}
+
+	if err := yaml.Unmarshal(plain, &secrets); err != nil {
+		return nil, fmt.Errorf("error parsing secret store: %w", err)
+	}
+	if secrets == nil {
+		secrets = make(map[string]interface{})
+	}
+	return secrets, nil
+}
+
+// save encrypts the secrets and replaces the store atomically
+func (s *SecretStore) save(secrets map[string]interface{}) error {
+	plain, err := yaml.Marshal(secrets)
+	if err != nil {
+		return fmt.Errorf("error marshaling secrets: %w", err)
+	}
+
+	key, err := s.key(true)
+	if err != nil {
+		return err
+	}
+	gcm, err := newSecretCipher(key)
+	if err != nil {
+		return err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("error creating nonce: %w", err)
+	}
+	sealed := gcm.Seal(nonce, nonce, plain, []byte(secretStoreHeader))
+
+	// SECURITY: Never write secrets through a symlink
+	if err := validateFileIsNotSymlink(s.fs, s.storage); err != nil {
+		return fmt.Errorf("security error: %w", err)
+	}
+
+	content := secretStoreHeader + "\n" + base64.StdEncoding.EncodeToString(sealed) + "\n"
+	return writeFileAtomic(s.fs, s.storage, []byte(content), 0600)
+}
+
+// key returns the encryption key of the store, with create a missing key is created
+func (s *SecretStore) key(create bool) ([]byte, error) {
+	// SECURITY: A key from the environment, e.g. from a password manager, isn't stored next to the store
+	if s.envKey != "" {
+		key, err := hex.DecodeString(strings.TrimSpace(s.envKey))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("%s must be a key of 64 hex characters", secretKeyEnv)
+		}
+		return key, nil
+	}
+
+	// SECURITY: Never read the key through a symlink
+	if err := validateFileIsNotSymlink(s.fs, s.keyFile); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	content, err := afero.ReadFile(s.fs, s.keyFile)
+	if err == nil {
+		key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("secret key %s is invalid", s.keyFile)
+		}
+		return key, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("error reading secret key: %w", err)
+	}
+	if !create {
+		return nil, fmt.Errorf("secret key %s is missing", s.keyFile)
+	}
+
+	// SECURITY: The key and the store are only readable by the user
+	if err := s.fs.MkdirAll(s.dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating %s: %w", s.dir, err)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("error creating secret key: %w", err)
+	}
+	if err := afero.WriteFile(s.fs, s.keyFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("error writing secret key: %w", err)
+	}
+	return key, nil
+}
+
+// newSecretCipher returns AES-256-GCM with the key
+func newSecretCipher(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// storeSecrets moves the values of secret variables into the store and returns the values with references.
+// References in existing are reused, so reconfiguring a prompt updates its secrets in place
+func storeSecrets(fs afero.Fs, opts InstallOptions, variables []WizardVariable, values, existing map[string]interface{}) (map[string]interface{}, error) {
+	secrets := make(map[string]interface{})
+	refs := make(map[string]string)
+	for _, variable := range variables {
+		value, ok := values[variable.ID]
+		if !variable.isSecret() || !ok || isEmptyVarValue(value) || isSecretRef(value) {
+			continue
+		}
+		secrets[variable.ID] = value
+		if ref, ok := existing[variable.ID].(string); ok && isSecretRef(ref) {
+			refs[variable.ID] = ref
+		}
+	}
+	if len(secrets) == 0 {
+		return values, nil
+	}
+
+	store, err := opts.secretStore(fs)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := store.Put(secrets, refs)
+	if err != nil {
+		return nil, fmt.Errorf("error storing secret variables: %w", err)
+	}
+
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		result[key] = value
+	}
+	for key, ref := range stored {
+		result[key] = ref
+	}
+	return result, nil
+}
+
+// resolveSecrets replaces references to the secret store with the secret values.
+// Only secret variables are resolved, their values are the ones redacted from output
+func resolveSecrets(fs afero.Fs, homeDir string, variables []WizardVariable, values map[string]interface{}) (map[string]interface{}, error) {
+	secret := make(map[string]bool, len(variables))
+	for _, variable := range variables {
+		secret[variable.ID] = variable.isSecret()
+	}
+
+	var store *SecretStore
+	result := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		// SECURITY: A reference in a variable that isn't secret would reveal the secret unredacted
+		if !secret[key] || !isSecretRef(value) {
+			result[key] = value
+			continue
+		}
+		if store == nil {
+			if homeDir == "" {
+				return nil, fmt.Errorf("variable '%s' references the secret store, which needs a home directory", key)
+			}
+			store = NewSecretStore(fs, homeDir)
+		}
+		secret, err := store.Get(value.(string))
+		if err != nil {
+			return nil, fmt.Errorf("error resolving secret variable '%s': %w", key, err)
+		}
+		result[key] = secret
+	}
+	return result, nil
+}
+
+// prefillWithSecrets resolves the secret references of stored values for prefilling the wizard.
+// References that can't be resolved are kept, so pressing Enter keeps them
+func prefillWithSecrets(fs afero.Fs, opts InstallOptions, variables []WizardVariable, values map[string]interface{}) map[string]interface{} {
+	resolved, err := resolveSecrets(fs, opts.homeDir(), variables, values)
+	if err != nil {
+		fmt.Printf("Warning: %v\n", err)
+		return values
+	}
+	return resolved
+}
+
+// redactSecrets replaces the values of secret variables in text, e.g. in error messages.
+// Every non-empty value is redacted, items of lists one by one, longer values first
+func redactSecrets(text string, variables []WizardVariable, values map[string]interface{}) string {
+	var secrets []string
+	for _, variable := range variables {
+		if !variable.isSecret() {
+			continue
+		}
+		switch value := values[variable.ID].(type) {
+		case []string:
+			secrets = append(secrets, value...)
+		case []interface{}:
+			for _, item := range value {
+				secrets = append(secrets, formatVarValue(item))
+			}
+		default:
+			secrets = append(secrets, formatVarValue(value))
+		}
+	}
+
+	// SECURITY: A shorter secret inside a longer one must not leave the rest of the longer one
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+	for _, secret := range secrets {
+		if secret != "" {
+			text = strings.ReplaceAll(text, secret, "********")
+		}
+	}
+	return text
+}
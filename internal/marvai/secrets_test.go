@@ -0,0 +1,241 @@
+package marvai
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestSecretStore(t *testing.T) {
+	t.Setenv(secretKeyEnv, "")
+	fs := afero.NewMemMapFs()
+	store := NewSecretStore(fs, "/home/user")
+
+	refs, err := store.Put(map[string]interface{}{"token": "abc123", "port": 8080}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !isSecretRef(refs["token"]) || !isSecretRef(refs["port"]) || refs["token"] == refs["port"] {
+		t.Fatalf("Expected two distinct references, got %v", refs)
+	}
+
+	content, err := afero.ReadFile(fs, "/home/user/.config/marvai/secrets.enc")
+	if err != nil {
+		t.Fatalf("Failed to read secret store: %v", err)
+	}
+	if strings.Contains(string(content), "abc123") {
+		t.Error("Secret store must be encrypted")
+	}
+	info, err := fs.Stat("/home/user/.config/marvai/secrets.key")
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected key file with mode 0600, got %v (%v)", info, err)
+	}
+
+	// Updating a secret keeps its reference
+	updated, err := store.Put(map[string]interface{}{"token": "def456"}, map[string]string{"token": refs["token"]})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if updated["token"] != refs["token"] {
+		t.Errorf("Expected reference %s to be reused, got %s", refs["token"], updated["token"])
+	}
+
+	tests := []struct {
+		ref         string
+		expected    interface{}
+		expectError bool
+	}{
+		{ref: refs["token"], expected: "def456"},
+		{ref: refs["port"], expected: 8080},
+		{ref: "secret:00000000000000000000000000000000", expectError: true},
+	}
+	for _, tt := range tests {
+		value, err := store.Get(tt.ref)
+		if tt.expectError {
+			if err == nil {
+				t.Errorf("Expected error for %s", tt.ref)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %s: %v", tt.ref, err)
+		} else if value != tt.expected {
+			t.Errorf("Expected %v for %s, got %v", tt.expected, tt.ref, value)
+		}
+	}
+
+	// A different key can't decrypt the store
+	if err := afero.WriteFile(fs, "/home/user/.config/marvai/secrets.key", []byte(strings.Repeat("ab", 32)), 0600); err != nil {
+		t.Fatalf("Failed to write key: %v", err)
+	}
+	if _, err := store.Get(refs["token"]); err == nil {
+		t.Error("Expected error decrypting with a different key")
+	}
+}
+
+func TestSecretStoreKeyFromEnvironment(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	t.Setenv(secretKeyEnv, strings.Repeat("4f", 32))
+	refs, err := NewSecretStore(fs, "/home/user").Put(map[string]interface{}{"token": "abc123"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if exists, _ := afero.Exists(fs, "/home/user/.config/marvai/secrets.key"); exists {
+		t.Error("Expected no key file next to the store")
+	}
+	if value, err := NewSecretStore(fs, "/home/user").Get(refs["token"]); err != nil || value != "abc123" {
+		t.Errorf("Expected abc123, got %v (%v)", value, err)
+	}
+
+	// Without the key the store can't be read
+	t.Setenv(secretKeyEnv, "")
+	if _, err := NewSecretStore(fs, "/home/user").Get(refs["token"]); err == nil || !strings.Contains(err.Error(), "secret key") {
+		t.Errorf("Expected missing key error, got %v", err)
+	}
+	t.Setenv(secretKeyEnv, "short")
+	if _, err := NewSecretStore(fs, "/home/user").Get(refs["token"]); err == nil || !strings.Contains(err.Error(), secretKeyEnv) {
+		t.Errorf("Expected invalid key error, got %v", err)
+	}
+}
+
+func TestSecretVariablesRoundTrip(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	mprompt := `name: Deploy
+--
+- id: url
+  description: Internal URL
+  secret: true
+- id: token
+  description: Token
+  type: secret
+- id: env
+  description: Environment
+--
+{{env}} {{url}} {{token}}`
+	if err := afero.WriteFile(fs, ".marvai/deploy.mprompt", []byte(mprompt), 0644); err != nil {
+		t.Fatalf("Failed to write .mprompt file: %v", err)
+	}
+	data, err := ParseMPromptContent([]byte(mprompt), "deploy.mprompt")
+	if err != nil {
+		t.Fatalf("Failed to parse prompt: %v", err)
+	}
+
+	opts := InstallOptions{HomeDir: "/home/user"}
+	values := map[string]interface{}{"url": "https://internal.example.com", "token": "s3cret", "env": "prod"}
+	stored, err := storeSecrets(fs, opts, data.Variables, values, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if stored["env"] != "prod" || !isSecretRef(stored["url"]) || !isSecretRef(stored["token"]) {
+		t.Fatalf("Expected secrets replaced by references, got %v", stored)
+	}
+	if err := saveVarValues(fs, ".marvai/deploy.var", stored); err != nil {
+		t.Fatalf("Failed to save .var file: %v", err)
+	}
+
+	content, err := LoadPromptWithOptions(fs, "deploy", PromptOptions{HomeDir: "/home/user"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(content) != "prod https://internal.example.com s3cret" {
+		t.Errorf("Expected secrets to be resolved, got %q", content)
+	}
+
+	// References in variables that aren't secret are not resolved, they would be shown unredacted
+	stored["env"] = stored["token"]
+	if err := saveVarValues(fs, ".marvai/deploy.var", stored); err != nil {
+		t.Fatalf("Failed to save .var file: %v", err)
+	}
+	content, err = LoadPromptWithOptions(fs, "deploy", PromptOptions{HomeDir: "/home/user"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if expected := fmt.Sprintf("%s https://internal.example.com s3cret", stored["token"]); string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, content)
+	}
+
+	// Without the secret store the references can't be resolved
+	if _, err := LoadPromptWithOptions(fs, "deploy", PromptOptions{HomeDir: "/home/other"}); err == nil || !strings.Contains(err.Error(), "secret variable") {
+		t.Errorf("Expected error resolving secrets, got %v", err)
+	}
+
+	if redacted := redactSecrets("failed with s3cret", data.Variables, values); redacted != "failed with ********" {
+		t.Errorf("Expected secret to be redacted, got %q", redacted)
+	}
+}
+
+// stdinCommandRunner returns commands that print the prompt they read from stdin
+type stdinCommandRunner struct{}
+
+func (r stdinCommandRunner) Command(name string, arg ...string) *exec.Cmd {
+	return exec.Command("cat")
+}
+
+func (r stdinCommandRunner) LookPath(file string) (string, error) {
+	return "/usr/bin/" + file, nil
+}
+
+func TestRunWithPromptSecretsForCodex(t *testing.T) {
+	t.Setenv(secretKeyEnv, "")
+	fs := afero.NewMemMapFs()
+	mprompt := "name: Deploy\n--\n- id: token\n  description: Token\n  type: secret\n--\nDeploy with {{token}}"
+	if err := afero.WriteFile(fs, ".marvai/deploy.mprompt", []byte(mprompt), 0644); err != nil {
+		t.Fatalf("Failed to write .mprompt file: %v", err)
+	}
+	refs, err := NewSecretStore(fs, "/home/user").Put(map[string]interface{}{"token": "s3cret"}, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := saveVarValues(fs, ".marvai/deploy.var", map[string]interface{}{"token": refs["token"]}); err != nil {
+		t.Fatalf("Failed to save .var file: %v", err)
+	}
+
+	// codex gets the prompt as an argument, which other processes can see
+	var stdout, stderr bytes.Buffer
+	err = RunWithPromptOptions(fs, "deploy", "codex", PromptOptions{HomeDir: "/home/user"}, outputCommandRunner{}, &stdout, &stderr)
+	if err == nil || !strings.Contains(err.Error(), "contains values of secret variables") {
+		t.Errorf("Expected codex to be refused, got %v", err)
+	}
+
+	// Other CLI tools read the prompt from stdin
+	if err := RunWithPromptOptions(fs, "deploy", "gemini", PromptOptions{HomeDir: "/home/user"}, stdinCommandRunner{}, &stdout, &stderr); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(stdout.String(), "Deploy with s3cret") {
+		t.Errorf("Expected the prompt on stdin, got %q", stdout.String())
+	}
+}
+
+func TestRedactSecrets(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "pin", Type: "secret"},
+		{ID: "token", Type: "secret"},
+		{ID: "hosts", Type: "list", Secret: true},
+		{ID: "empty", Type: "secret"},
+		{ID: "env", Type: "string"},
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		values   map[string]interface{}
+		expected string
+	}{
+		{name: "short secret", text: "PIN 42", values: map[string]interface{}{"pin": "42"}, expected: "PIN ********"},
+		{name: "secret inside a longer one", text: "abc abcdef", values: map[string]interface{}{"pin": "abc", "token": "abcdef"}, expected: "******** ********"},
+		{name: "list items", text: "db1, db2", values: map[string]interface{}{"hosts": []interface{}{"db1", "db2"}}, expected: "********, ********"},
+		{name: "empty secret and other variables", text: "prod", values: map[string]interface{}{"empty": "", "env": "prod"}, expected: "prod"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if redacted := redactSecrets(tt.text, variables, tt.values); redacted != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, redacted)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package marvai
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/marvai-dev/marvai/internal"
+)
+
+// isStrict reports if rendering fails on template variables without a value, prompts opt out with strict: false
+func (f MPromptFrontmatter) isStrict() bool {
+	return f.Strict == nil || *f.Strict
+}
+
+// checkMissingVariables returns an error listing the template variables without a value and how to set them.
+// Variables the wizard skips because of their when condition are not missing
+func checkMissingVariables(promptName string, data *MPromptData, values map[string]interface{}) error {
+	missing, err := internal.MissingReferences(data.Template, data.Partials, values)
+	if err != nil {
+		// Parse errors are reported when rendering
+		return nil
+	}
+
+	wizard := make(map[string]WizardVariable)
+	for _, variable := range data.Variables {
+		wizard[variable.ID] = variable
+	}
+
+	var lines []string
+	for _, reference := range missing {
+		variable, defined := wizard[reference.Name]
+		if !defined {
+			lines = append(lines, fmt.Sprintf("  %s (template line %d) is not a wizard variable, set it in .marvai/%s.var",
+				reference.Name, reference.Line, promptName))
+			continue
+		}
+		if active, err := evaluateWhen(variable, values); err == nil && !active {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("  %s (template line %d): run 'marvai configure %s' or pass --set %s=<value>",
+			reference.Name, reference.Line, promptName, reference.Name))
+	}
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("prompt %q references variables without a value:\n%s\nSet strict: false in the frontmatter to render them empty",
+		promptName, strings.Join(lines, "\n"))
+}
@@ -0,0 +1,86 @@
+package marvai
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestLoadPromptStrict(t *testing.T) {
+	mprompt := `name: Hello
+--
+- id: language
+  description: Language
+- id: audience
+  description: Audience
+- id: docs
+  description: Docs
+  type: bool
+- id: docs_path
+  description: Docs path
+  when: docs
+--
+Write hello world in {{language}}{{#if audience}} for {{audience}}{{/if}}.
+{{#if docs}}Docs go to {{docs_path}}.{{/if}}{{team}}`
+
+	tests := []struct {
+		name        string
+		varContent  string
+		expected    string
+		expectError []string
+	}{
+		{
+			name:       "all values",
+			varContent: "language: Go\naudience: juniors\ndocs: true\ndocs_path: docs/\nteam: core\n",
+			expected:   "Write hello world in Go for juniors.\nDocs go to docs/.core",
+		},
+		{
+			name:       "empty answers and skipped questions are not missing",
+			varContent: "language: Go\naudience: \"\"\ndocs: false\nteam: \"\"\n",
+			expected:   "Write hello world in Go.\n",
+		},
+		{
+			name:       "missing values",
+			varContent: "docs: true\n",
+			expectError: []string{
+				`prompt "hello" references variables without a value`,
+				"language (template line 1): run 'marvai configure hello' or pass --set language=<value>",
+				"docs_path (template line 2): run 'marvai configure hello' or pass --set docs_path=<value>",
+				"team (template line 2) is not a wizard variable, set it in .marvai/hello.var",
+				"strict: false",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fs := afero.NewMemMapFs()
+			if err := afero.WriteFile(fs, ".marvai/hello.mprompt", []byte(mprompt), 0644); err != nil {
+				t.Fatalf("Failed to write .mprompt file: %v", err)
+			}
+			if err := afero.WriteFile(fs, ".marvai/hello.var", []byte(tt.varContent), 0644); err != nil {
+				t.Fatalf("Failed to write .var file: %v", err)
+			}
+
+			content, err := LoadPromptWithOptions(fs, "hello", PromptOptions{})
+			if len(tt.expectError) > 0 {
+				if err == nil {
+					t.Fatalf("Expected error, got %q", content)
+				}
+				for _, expected := range tt.expectError {
+					if !strings.Contains(err.Error(), expected) {
+						t.Errorf("Expected error containing %q, got:\n%v", expected, err)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+package marvai
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/afero"
+	"golang.org/x/term"
+)
+
+// errWizardCancelled is returned when the user cancels the wizard with Ctrl+C
+var errWizardCancelled = errors.New("wizard cancelled")
+
+// ANSI escape sequences used by the terminal wizard
+const (
+	ansiClearScreen     = "\x1b[H\x1b[2J"
+	ansiAlternateScreen = "\x1b[?1049h"
+	ansiMainScreen      = "\x1b[?1049l"
+	ansiBold            = "\x1b[1m"
+	ansiDim             = "\x1b[2m"
+	ansiRed             = "\x1b[31m"
+	ansiReset           = "\x1b[0m"
+)
+
+// useTerminalUI reports if the wizard can run as terminal UI, it needs a terminal on stdin and stdout
+func useTerminalUI() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return term.IsTerminal(int(os.Stdin.Fd())) && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// askOnTerminal collects the values for variables on the terminal, with the terminal UI if
+// possible and line by line otherwise. Answers are used without asking
+func askOnTerminal(fs afero.Fs, variables []WizardVariable, prefill map[string]interface{}, answers map[string]interface{}) (map[string]interface{}, error) {
+	if !useTerminalUI() {
+		w := newTerminalWizard(fs)
+		w.answers = answers
+		return w.run(variables, prefill)
+	}
+
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, fmt.Errorf("error preparing terminal: %w", err)
+	}
+	fmt.Fprint(os.Stdout, ansiAlternateScreen)
+	defer func() {
+		fmt.Fprint(os.Stdout, ansiMainScreen)
+		if err := term.Restore(fd, state); err != nil {
+			fmt.Printf("Warning: failed to restore terminal: %v\n", err)
+		}
+	}()
+
+	t := newTUIWizard(fs, os.Stdin, os.Stdout)
+	t.answers = answers
+	return t.run(variables, prefill)
+}
+
+// tuiKeyKind is the kind of a key press
+type tuiKeyKind int
+
+const (
+	keyRune tuiKeyKind = iota
+	keyEnter
+	keyBackspace
+	keyUp
+	keyDown
+	keyEsc
+	keyCtrlC
+	keyCtrlD
+	keyOther
+)
+
+// tuiKey is a key press read from the terminal in raw mode
+type tuiKey struct {
+	kind tuiKeyKind
+	r    rune
+}
+
+// readKey reads a key press, arrow keys arrive as escape sequences
+func readKey(reader *bufio.Reader) (tuiKey, error) {
+	r, _, err := reader.ReadRune()
+	if err != nil {
+		return tuiKey{}, err
+	}
+
+	switch r {
+	case '\r', '\n':
+		return tuiKey{kind: keyEnter}, nil
+	case 127, '\b':
+		return tuiKey{kind: keyBackspace}, nil
+	case 3:
+		return tuiKey{kind: keyCtrlC}, nil
+	case 4:
+		return tuiKey{kind: keyCtrlD}, nil
+	case 0x1b:
+		// A lone escape is the Esc key, escape [ or escape O starts a sequence like an arrow key
+		if reader.Buffered() == 0 {
+			return tuiKey{kind: keyEsc}, nil
+		}
+		next, err := reader.Peek(1)
+		if err != nil || (next[0] != '[' && next[0] != 'O') {
+			return tuiKey{kind: keyEsc}, nil
+		}
+		if _, err := reader.ReadByte(); err != nil {
+			return tuiKey{}, err
+		}
+		for {
+			b, err := reader.ReadByte()
+			if err != nil {
+				return tuiKey{}, err
+			}
+			switch {
+			case b == 'A':
+				return tuiKey{kind: keyUp}, nil
+			case b == 'B':
+				return tuiKey{kind: keyDown}, nil
+			case b == '~' || (b >= 'A' && b <= 'Z') || (b >= 'a' && b <= 'z'):
+				return tuiKey{kind: keyOther}, nil
+			}
+		}
+	}
+
+	if unicode.IsControl(r) {
+		return tuiKey{kind: keyOther}, nil
+	}
+	return tuiKey{kind: keyRune, r: r}, nil
+}
+
+// tuiWizard asks for variable values one screen at a time. Choices are selected with the arrow keys,
+// Esc goes back to the previous question and a review screen lists all answers at the end
+type tuiWizard struct {
+	fs     afero.Fs
+	reader *bufio.Reader
+	out    io.Writer
+	// answers are used without asking, e.g. from --set
+	answers map[string]interface{}
+}
+
+func newTUIWizard(fs afero.Fs, reader io.Reader, out io.Writer) *tuiWizard {
+	return &tuiWizard{
+		fs:     fs,
+		reader: bufio.NewReader(reader),
+		out:    out,
+	}
+}
+
+// line writes a line, the terminal is in raw mode and needs a carriage return
+func (t *tuiWizard) line(format string, args ...interface{}) {
+	fmt.Fprintf(t.out, format+"\r\n", args...)
+}
+
+// run asks for the variables and shows the review screen before returning the values
+func (t *tuiWizard) run(variables []WizardVariable, prefill map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+	// history holds the indexes of the asked questions for going back
+	var history []int
+
+	for i := 0; ; {
+		if i >= len(variables) {
+			if len(history) == 0 {
+				return values, nil
+			}
+			confirmed, err := t.review(variables, values)
+			if err != nil {
+				return nil, err
+			}
+			if confirmed {
+				fmt.Fprint(t.out, ansiClearScreen)
+				return values, nil
+			}
+			i, history = history[len(history)-1], history[:len(history)-1]
+			continue
+		}
+
+		variable := variables[i]
+		asked, err := evaluateWhen(variable, values)
+		if err != nil {
+			return nil, err
+		}
+		if !asked {
+			delete(values, variable.ID)
+			i++
+			continue
+		}
+		if answer, ok := t.answers[variable.ID]; ok {
+			values[variable.ID] = answer
+			i++
+			continue
+		}
+
+		// Answers given before going back are offered again, otherwise the prefilled value
+		existing, hasExisting := values[variable.ID]
+		if !hasExisting {
+			existing, hasExisting = prefill[variable.ID]
+		}
+		if hasExisting {
+			parsed, err := parseVarValue(t.fs, variable, existing)
+			existing, hasExisting = parsed, err == nil && !isEmptyVarValue(parsed)
+		}
+
+		value, back, err := t.ask(variable, i, len(variables), existing, hasExisting, len(history) > 0)
+		if err != nil {
+			return nil, err
+		}
+		if back {
+			i, history = history[len(history)-1], history[:len(history)-1]
+			continue
+		}
+
+		if value != nil {
+			values[variable.ID] = value
+		} else {
+			delete(values, variable.ID)
+		}
+		history = append(history, i)
+		i++
+	}
+}
+
+// tuiOption is a selectable option of a choice or bool question
+type tuiOption struct {
+	label string
+	value interface{}
+}
+
+// selectOptions returns the options of choice and bool questions, nil for text input
+func selectOptions(variable WizardVariable) []tuiOption {
+	switch variable.variableType() {
+	case VarTypeChoice:
+		options := make([]tuiOption, 0, len(variable.Options)+1)
+		for _, option := range variable.Options {
+			options = append(options, tuiOption{label: option, value: option})
+		}
+		if !variable.Required {
+			options = append(options, tuiOption{label: "(none)", value: emptyVarValue(variable)})
+		}
+		return options
+	case VarTypeBool:
+		return []tuiOption{{label: "yes", value: true}, {label: "no", value: false}}
+	}
+	return nil
+}
+
+// ask shows a question until a valid value is entered, back is true if the user goes back
+func (t *tuiWizard) ask(variable WizardVariable, index, total int, existing interface{}, hasExisting, canGoBack bool) (interface{}, bool, error) {
+	options := selectOptions(variable)
+	variableType := variable.variableType()
+	multiline := variableType == VarTypeList || variableType == VarTypeMultiline
+
+	// Selection starts at the current value, text input starts with it except for secrets
+	selected := len(options) - 1
+	var input []rune
+	if hasExisting {
+		for i, option := range options {
+			if option.value == existing {
+				selected = i
+			}
+		}
+		if options == nil && !keepsExistingValue(variable, existing) {
+			text := formatVarValue(existing)
+			if items, ok := existing.([]string); ok {
+				text = strings.Join(items, "\n")
+			}
+			input = []rune(text)
+		}
+	}
+	if variableType == VarTypeChoice && !hasExisting {
+		selected = 0
+	}
+
+	message := ""
+	for {
+		t.render(variable, index, total, options, selected, input, existing, hasExisting, canGoBack, message)
+
+		key, err := readKey(t.reader)
+		if err != nil {
+			if err == io.EOF {
+				return nil, false, errWizardCancelled
+			}
+			return nil, false, fmt.Errorf("error reading input for variable '%s': %w", variable.ID, err)
+		}
+
+		submit := false
+		switch key.kind {
+		case keyCtrlC:
+			return nil, false, errWizardCancelled
+		case keyEsc:
+			if canGoBack {
+				return nil, true, nil
+			}
+		case keyUp:
+			if options != nil {
+				selected = (selected + len(options) - 1) % len(options)
+			}
+		case keyDown:
+			if options != nil {
+				selected = (selected + 1) % len(options)
+			}
+		case keyBackspace:
+			if len(input) > 0 {
+				input = input[:len(input)-1]
+			}
+		case keyRune:
+			if options == nil {
+				input = append(input, key.r)
+			}
+		case keyEnter:
+			if options != nil || !multiline {
+				submit = true
+			} else {
+				input = append(input, '\n')
+			}
+		case keyCtrlD:
+			submit = multiline
+		}
+		if !submit {
+			continue
+		}
+
+		if options != nil {
+			return options[selected].value, false, nil
+		}
+
+		text := strings.TrimRight(string(input), "\n")
+		if strings.TrimSpace(text) == "" {
+			if hasExisting && keepsExistingValue(variable, existing) {
+				return existing, false, nil
+			}
+			if variable.Required {
+				message = "A value is required."
+				continue
+			}
+			return emptyVarValue(variable), false, nil
+		}
+
+		value, err := parseVarInput(t.fs, variable, text)
+		if err != nil {
+			message = fmt.Sprintf("Invalid value: %v", err)
+			continue
+		}
+		return value, false, nil
+	}
+}
+
+// keepsExistingValue reports if the current value isn't shown for editing and empty input keeps it,
+// for secrets and for lists of maps or lists from .var files, which can't be edited as lines
+func keepsExistingValue(variable WizardVariable, existing interface{}) bool {
+	if variable.hidesInput() {
+		return true
+	}
+	_, structured := existing.([]interface{})
+	return variable.variableType() == VarTypeList && structured
+}
+
+// render draws the screen of a question
+func (t *tuiWizard) render(variable WizardVariable, index, total int, options []tuiOption, selected int, input []rune, existing interface{}, hasExisting, canGoBack bool, message string) {
+	fmt.Fprint(t.out, ansiClearScreen)
+	t.line("%sQuestion %d of %d%s", ansiDim, index+1, total, ansiReset)
+	t.line("")
+
+	title := variable.Description
+	if title == "" {
+		title = variable.ID
+	}
+	if variable.Required {
+		title += " *"
+	}
+	t.line("%s%s%s", ansiBold, title, ansiReset)
+	if variable.Help != "" {
+		for _, helpLine := range strings.Split(variable.Help, "\n") {
+			t.line("%s%s%s", ansiDim, helpLine, ansiReset)
+		}
+	}
+	if hint := tuiInputHint(variable); hint != "" {
+		t.line("%s(%s)%s", ansiDim, hint, ansiReset)
+	}
+	t.line("")
+
+	if options != nil {
+		for i, option := range options {
+			if i == selected {
+				t.line("%s> %s%s", ansiBold, option.label, ansiReset)
+			} else {
+				t.line("  %s", option.label)
+			}
+		}
+	} else {
+		text := string(input)
+		if variable.hidesInput() {
+			text = strings.Repeat("*", len(input))
+		}
+		if len(input) == 0 && hasExisting && keepsExistingValue(variable, existing) {
+			text = ansiDim + displayVarValue(variable, existing) + " (Enter keeps the current value)" + ansiReset
+		}
+		for _, inputLine := range strings.Split(text, "\n") {
+			t.line("> %s", inputLine)
+		}
+	}
+
+	t.line("")
+	if message != "" {
+		t.line("%s%s%s", ansiRed, message, ansiReset)
+	}
+
+	keys := []string{"Enter: confirm"}
+	switch {
+	case options != nil:
+		keys = []string{"Up/Down: select", "Enter: confirm"}
+	case variable.variableType() == VarTypeList || variable.variableType() == VarTypeMultiline:
+		keys = []string{"Enter: new line", "Ctrl+D: confirm"}
+	}
+	if canGoBack {
+		keys = append(keys, "Esc: back")
+	}
+	keys = append(keys, "Ctrl+C: cancel")
+	t.line("%s%s%s", ansiDim, strings.Join(keys, "  "), ansiReset)
+}
+
+// tuiInputHint describes the expected input, choices and lists are self-explaining on screen
+func tuiInputHint(variable WizardVariable) string {
+	switch variable.variableType() {
+	case VarTypeChoice, VarTypeBool:
+		return ""
+	case VarTypeList:
+		return "one item per line"
+	case VarTypeMultiline:
+		return "text over several lines"
+	}
+	return inputHint(variable)
+}
+
+// review lists all answers, confirmed is false if the user goes back to change an answer
+func (t *tuiWizard) review(variables []WizardVariable, values map[string]interface{}) (bool, error) {
+	for {
+		fmt.Fprint(t.out, ansiClearScreen)
+		t.line("%sReview your answers%s", ansiBold, ansiReset)
+		t.line("")
+		for _, variable := range variables {
+			value, ok := values[variable.ID]
+			if !ok {
+				continue
+			}
+			label := variable.Description
+			if label == "" {
+				label = variable.ID
+			}
+			t.line("  %s: %s", label, displayVarValue(variable, value))
+		}
+		t.line("")
+		t.line("%sEnter: save  Esc: back  Ctrl+C: cancel%s", ansiDim, ansiReset)
+
+		key, err := readKey(t.reader)
+		if err != nil {
+			if err == io.EOF {
+				return false, errWizardCancelled
+			}
+			return false, fmt.Errorf("error reading input: %w", err)
+		}
+		switch key.kind {
+		case keyEnter:
+			return true, nil
+		case keyEsc:
+			return false, nil
+		case keyCtrlC:
+			return false, errWizardCancelled
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package marvai
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+// Key sequences as sent by a terminal in raw mode
+const (
+	testKeyUp    = "\x1b[A"
+	testKeyDown  = "\x1b[B"
+	testKeyEnter = "\r"
+	testKeyCtrlD = "\x04"
+	testKeyCtrlC = "\x03"
+	testKeyBack  = "\x7f"
+)
+
+func TestReadKey(t *testing.T) {
+	input := testKeyUp + testKeyDown + "\x1bOA" + testKeyEnter + "\n" + testKeyBack + "ä" + testKeyCtrlC + testKeyCtrlD + "\x1b[3~" + "\x1b"
+	expected := []tuiKey{
+		{kind: keyUp}, {kind: keyDown}, {kind: keyUp}, {kind: keyEnter}, {kind: keyEnter},
+		{kind: keyBackspace}, {kind: keyRune, r: 'ä'}, {kind: keyCtrlC}, {kind: keyCtrlD},
+		{kind: keyOther}, {kind: keyEsc},
+	}
+
+	reader := bufio.NewReader(strings.NewReader(input))
+	for i, want := range expected {
+		key, err := readKey(reader)
+		if err != nil {
+			t.Fatalf("Key %d: unexpected error: %v", i, err)
+		}
+		if key != want {
+			t.Errorf("Key %d: expected %+v, got %+v", i, want, key)
+		}
+	}
+}
+
+func TestTUIWizard(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "language", Description: "Language", Type: "choice", Options: []string{"go", "python", "rust"}, Required: true},
+		{ID: "framework", Description: "Test framework", Help: "Used for generated tests", When: `language == "go"`},
+		{ID: "tests", Description: "Write tests", Type: "bool"},
+		{ID: "modules", Description: "Modules", Type: "list"},
+		{ID: "token", Description: "Token", Type: "secret", MinLength: intPtr(3)},
+	}
+
+	tests := []struct {
+		name           string
+		keys           string
+		prefill        map[string]interface{}
+		answers        map[string]interface{}
+		expected       map[string]interface{}
+		expectedError  string
+		expectedOutput []string
+	}{
+		{
+			name: "arrow keys, list, secret and review",
+			keys: testKeyEnter + "testify" + testKeyEnter + testKeyUp + testKeyEnter +
+				"api" + testKeyEnter + "web" + testKeyCtrlD + "ab" + testKeyEnter + "c" + testKeyEnter + testKeyEnter,
+			expected: map[string]interface{}{
+				"language": "go", "framework": "testify", "tests": true,
+				"modules": []string{"api", "web"}, "token": "abc",
+			},
+			expectedOutput: []string{"Used for generated tests", "Invalid value: must be at least 3 characters long", "Review your answers", "Token: ********"},
+		},
+		{
+			name: "skipped question and going back",
+			keys: testKeyDown + testKeyEnter + testKeyEnter + "\x1b" + "\x1b" + testKeyUp + testKeyEnter +
+				"testify" + testKeyEnter + testKeyEnter + testKeyCtrlD + testKeyEnter + testKeyEnter,
+			expected: map[string]interface{}{
+				"language": "go", "framework": "testify", "tests": false, "modules": []string{}, "token": "",
+			},
+		},
+		{
+			name: "changed answer skips later question",
+			keys: testKeyEnter + "testify" + testKeyEnter + "\x1b" + "\x1b" + testKeyDown + testKeyEnter +
+				testKeyEnter + testKeyCtrlD + testKeyEnter + testKeyEnter,
+			expected: map[string]interface{}{
+				"language": "python", "tests": false, "modules": []string{}, "token": "",
+			},
+		},
+		{
+			name:    "prefilled values and answers",
+			prefill: map[string]interface{}{"language": "rust", "tests": true, "modules": []string{"api"}, "token": "secret"},
+			answers: map[string]interface{}{"modules": []string{"cli"}},
+			keys:    testKeyEnter + testKeyEnter + testKeyEnter + testKeyEnter,
+			expected: map[string]interface{}{
+				"language": "rust", "tests": true, "modules": []string{"cli"}, "token": "secret",
+			},
+		},
+		{
+			name:    "prefilled list of maps is kept",
+			prefill: map[string]interface{}{"language": "rust", "tests": true, "modules": []interface{}{map[string]interface{}{"name": "api"}}},
+			keys:    testKeyEnter + testKeyEnter + testKeyCtrlD + testKeyEnter + testKeyEnter,
+			expected: map[string]interface{}{
+				"language": "rust", "tests": true, "modules": []interface{}{map[string]interface{}{"name": "api"}}, "token": "",
+			},
+			expectedOutput: []string{"Enter keeps the current value"},
+		},
+		{
+			name:          "cancel",
+			keys:          testKeyEnter + testKeyCtrlC,
+			expectedError: "wizard cancelled",
+		},
+		{
+			name:          "input ends",
+			keys:          testKeyEnter,
+			expectedError: "wizard cancelled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			w := newTUIWizard(afero.NewMemMapFs(), strings.NewReader(tt.keys), &output)
+			w.answers = tt.answers
+
+			values, err := w.run(variables, tt.prefill)
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected %#v, got %#v", tt.expected, values)
+			}
+			for _, expected := range tt.expectedOutput {
+				if !strings.Contains(output.String(), expected) {
+					t.Errorf("Expected output containing %q", expected)
+				}
+			}
+			if strings.Contains(output.String(), "abc") {
+				t.Error("Secret must not be shown")
+			}
+		})
+	}
+}
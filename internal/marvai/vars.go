@@ -0,0 +1,254 @@
+package marvai
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/spf13/afero"
+)
+
+// projectVarFile holds variable values shared by all prompts of the project, it is meant to be committed
+var projectVarFile = filepath.Join(".marvai", "project.var")
+
+// localVarSuffix is the suffix of personal variable files that are not committed, e.g. .marvai/review.local.var
+const localVarSuffix = ".local.var"
+
+// globalVarName is the file name of the user-global values for all prompts in ~/.config/marvai/vars/
+const globalVarName = "global.var"
+
+// overrideSource is the source of variable values given on the command line
+const overrideSource = "--set"
+
+// PromptOptions are the options for loading an installed prompt
+type PromptOptions struct {
+	// HomeDir is the home directory with the user-global variables, empty skips them
+	HomeDir string
+	// Overrides are variable values from the command line, they take precedence over all .var files
+	Overrides map[string]string
+	// Agent is the CLI tool the prompt is rendered for, available as {{marvai.agent}}
+	Agent string
+	// Version is the marvai version, available as {{marvai.version}}
+	Version string
+	// Runner runs git for the runtime context and the repo helpers and the commands of {{exec}}, nil uses the OS
+	Runner CommandRunner
+}
+
+// ResolvedVar is the value of a variable and the layer it came from
+type ResolvedVar struct {
+	Value  interface{}
+	Source string
+	// Overridden lists the lower layers that also set the variable, highest first
+	Overridden []string
+}
+
+// varLayer is a file with variable values, path is the file on disk and source its display name
+type varLayer struct {
+	path   string
+	source string
+	// base is the directory the path is checked for symlinks below, the home directory or the repository
+	base string
+}
+
+// varLayers returns the variable files of a prompt, lowest precedence first:
+// user-global values for all prompts and for the prompt, the project, the prompt's .var and its .local.var
+func varLayers(promptName, homeDir string) []varLayer {
+	var layers []varLayer
+	if homeDir != "" {
+		varsDir := filepath.Join(userConfigDir(homeDir), "vars")
+		for _, name := range []string{globalVarName, promptName + ".var"} {
+			path := filepath.Join(varsDir, name)
+			layers = append(layers, varLayer{path: path, source: filepath.Join("~", strings.TrimPrefix(path, homeDir)), base: homeDir})
+		}
+	}
+	for _, path := range []string{
+		projectVarFile,
+		filepath.Join(".marvai", promptName+".var"),
+		filepath.Join(".marvai", promptName+localVarSuffix),
+	} {
+		layers = append(layers, varLayer{path: path, source: path})
+	}
+	return layers
+}
+
+// ResolveVars merges the variable layers of a prompt and the overrides, later layers win.
+// Empty values don't override, so an optional variable left empty in the wizard keeps a user-global value.
+// They are kept if no other layer sets the variable, so strict rendering knows it was answered
+func ResolveVars(fs afero.Fs, promptName string, opts PromptOptions) (map[string]ResolvedVar, error) {
+	resolved := make(map[string]ResolvedVar)
+	isEmpty := func(value interface{}) bool {
+		return value == nil || value == ""
+	}
+	set := func(key string, value interface{}, source string) {
+		previous, ok := resolved[key]
+		if isEmpty(value) {
+			if !ok {
+				resolved[key] = ResolvedVar{Value: value, Source: source}
+			}
+			return
+		}
+		var overridden []string
+		if ok && !isEmpty(previous.Value) {
+			overridden = append([]string{previous.Source}, previous.Overridden...)
+		}
+		resolved[key] = ResolvedVar{Value: value, Source: source, Overridden: overridden}
+	}
+
+	for _, layer := range varLayers(promptName, opts.HomeDir) {
+		values, err := loadVarLayer(fs, layer)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			set(key, value, layer.source)
+		}
+	}
+
+	for key, value := range opts.Overrides {
+		set(key, value, overrideSource)
+	}
+
+	return resolved, nil
+}
+
+// loadVarLayer loads a variable file, a missing file has no values
+func loadVarLayer(fs afero.Fs, layer varLayer) (map[string]interface{}, error) {
+	path := layer.path
+
+	// SECURITY: Prevent symlink attacks, also through a symlinked .marvai or vars directory
+	if err := validatePathHasNoSymlinks(fs, layer.base, path); err != nil {
+		return nil, fmt.Errorf("security error: %w", err)
+	}
+
+	info, err := fs.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+
+	// SECURITY: Limit YAML size to prevent billion laughs attack
+	if info.Size() > 1024*1024 { // 1MB limit
+		return nil, fmt.Errorf("var file %s too large (%d bytes), maximum allowed is 1MB", path, info.Size())
+	}
+
+	values, err := loadVarValues(fs, path)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return values, nil
+}
+
+// resolvedValues returns the plain values of resolved variables
+func resolvedValues(resolved map[string]ResolvedVar) map[string]interface{} {
+	values := make(map[string]interface{}, len(resolved))
+	for key, variable := range resolved {
+		values[key] = variable.Value
+	}
+	return values
+}
+
+// validateOverrides checks that overrides only set variables the prompt defines
+func validateOverrides(variables []WizardVariable, overrides map[string]string) error {
+	defined := make(map[string]bool)
+	for _, variable := range variables {
+		defined[variable.ID] = true
+	}
+	for key := range overrides {
+		if !defined[key] {
+			return fmt.Errorf("--set %s: the prompt has no variable %q", key, key)
+		}
+	}
+	return nil
+}
+
+// ShowVars prints the resolved variables of an installed prompt to w, with explain the layer each value came from
+func ShowVars(fs afero.Fs, promptName string, opts PromptOptions, explain bool, w io.Writer) error {
+	data, _, err := loadInstalledPrompt(fs, promptName)
+	if err != nil {
+		return err
+	}
+	if err := validateOverrides(data.Variables, opts.Overrides); err != nil {
+		return err
+	}
+
+	resolved, err := ResolveVars(fs, promptName, opts)
+	if err != nil {
+		return err
+	}
+
+	// Variables of the wizard in order, then values the wizard doesn't define
+	variables := append([]WizardVariable{}, data.Variables...)
+	defined := make(map[string]bool)
+	for _, variable := range data.Variables {
+		defined[variable.ID] = true
+	}
+	var extra []string
+	for key := range resolved {
+		if !defined[key] {
+			extra = append(extra, key)
+		}
+	}
+	sort.Strings(extra)
+	for _, key := range extra {
+		variables = append(variables, WizardVariable{ID: key})
+	}
+
+	if explain {
+		fmt.Fprintln(w, "Layers, lowest precedence first:")
+		for _, layer := range varLayers(promptName, opts.HomeDir) {
+			fmt.Fprintf(w, "  %s\n", layer.source)
+		}
+		fmt.Fprintf(w, "  %s\n\n", overrideSource)
+	}
+
+	for _, variable := range variables {
+		value, ok := resolved[variable.ID]
+		if !ok {
+			if explain {
+				fmt.Fprintf(w, "%s: (not set)\n", variable.ID)
+			}
+			continue
+		}
+
+		display := displayVarValue(variable, value.Value)
+		if parsed, err := parseVarValue(fs, variable, value.Value); err == nil {
+			display = displayVarValue(variable, parsed)
+		}
+		if !explain {
+			fmt.Fprintf(w, "%s: %s\n", variable.ID, display)
+			continue
+		}
+
+		line := fmt.Sprintf("%s: %s (from %s", variable.ID, display, value.Source)
+		if len(value.Overridden) > 0 {
+			line += ", overrides " + strings.Join(value.Overridden, ", ")
+		}
+		fmt.Fprintln(w, line+")")
+	}
+
+	return nil
+}
+
+// newPromptOptions returns the options for loading a prompt with the --set overrides
+func newPromptOptions(fs afero.Fs, setFlags []string, version string) (PromptOptions, error) {
+	answers, err := NewWizardAnswers(fs, setFlags, "", nil)
+	if err != nil {
+		return PromptOptions{}, err
+	}
+	return PromptOptions{HomeDir: userHomeDir(), Overrides: answers.Set, Version: version}, nil
+}
+
+// ensureLocalVarsIgnored creates .marvai/.gitignore so personal .local.var files are not committed
+func ensureLocalVarsIgnored(fs afero.Fs) error {
+	gitignore := filepath.Join(".marvai", ".gitignore")
+	exists, err := afero.Exists(fs, gitignore)
+	if err != nil || exists {
+		return err
+	}
+	return afero.WriteFile(fs, gitignore, []byte("*"+localVarSuffix+"\n"), 0644)
+}
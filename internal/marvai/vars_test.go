@@ -0,0 +1,260 @@
+package marvai
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+const varsTestMPrompt = `name: Review
+--
+- id: language
+  description: Language
+- id: author
+  description: Author
+- id: token
+  description: Token
+  type: secret
+- id: strict
+  description: Strict
+  type: bool
+--
+{{language}} by {{author}}{{#if strict}} strictly{{/if}}`
+
+// setupVarLayers installs the review prompt with values in every layer
+func setupVarLayers(t *testing.T, homeDir string) afero.Fs {
+	t.Helper()
+	fs := afero.NewMemMapFs()
+	varsDir := filepath.Join(homeDir, ".config", "marvai", "vars")
+	files := map[string]string{
+		".marvai/review.mprompt":             varsTestMPrompt,
+		filepath.Join(varsDir, "global.var"): "author: Global Author\nlanguage: Java\n",
+		filepath.Join(varsDir, "review.var"): "token: secret-token\n",
+		".marvai/project.var":                "language: Go\nstrict: true\n",
+		".marvai/review.var":                 "language: Rust\nauthor: \"\"\nstrict: false\n",
+		".marvai/review.local.var":           "author: Jane\n",
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+	return fs
+}
+
+func TestResolveVars(t *testing.T) {
+	homeDir := "/home/user"
+	fs := setupVarLayers(t, homeDir)
+
+	resolved, err := ResolveVars(fs, "review", PromptOptions{HomeDir: homeDir, Overrides: map[string]string{"strict": "yes"}})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := map[string]ResolvedVar{
+		"language": {Value: "Rust", Source: ".marvai/review.var", Overridden: []string{".marvai/project.var", "~/.config/marvai/vars/global.var"}},
+		"author":   {Value: "Jane", Source: ".marvai/review.local.var", Overridden: []string{"~/.config/marvai/vars/global.var"}},
+		"token":    {Value: "secret-token", Source: "~/.config/marvai/vars/review.var"},
+		"strict":   {Value: "yes", Source: "--set", Overridden: []string{".marvai/review.var", ".marvai/project.var"}},
+	}
+	if !reflect.DeepEqual(resolved, expected) {
+		t.Errorf("Expected %#v, got %#v", expected, resolved)
+	}
+}
+
+func TestLoadPromptWithOptionsLayers(t *testing.T) {
+	homeDir := "/home/user"
+	fs := setupVarLayers(t, homeDir)
+
+	tests := []struct {
+		name        string
+		opts        PromptOptions
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "layers",
+			opts:     PromptOptions{HomeDir: homeDir},
+			expected: "Rust by Jane",
+		},
+		{
+			name:     "overrides",
+			opts:     PromptOptions{HomeDir: homeDir, Overrides: map[string]string{"language": "Go", "strict": "yes"}},
+			expected: "Go by Jane strictly",
+		},
+		{
+			name:        "override of unknown variable",
+			opts:        PromptOptions{HomeDir: homeDir, Overrides: map[string]string{"framework": "gin"}},
+			expectError: `the prompt has no variable "framework"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, err := LoadPromptWithOptions(fs, "review", tt.opts)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, string(content))
+			}
+		})
+	}
+}
+
+func TestShowVarsExplain(t *testing.T) {
+	homeDir := "/home/user"
+	fs := setupVarLayers(t, homeDir)
+	if err := afero.WriteFile(fs, ".marvai/project.var", []byte("language: Go\nteam: core\n"), 0644); err != nil {
+		t.Fatalf("Failed to write project.var: %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := ShowVars(fs, "review", PromptOptions{HomeDir: homeDir}, true, &out); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"  ~/.config/marvai/vars/global.var\n",
+		"  .marvai/review.local.var\n",
+		"language: Rust (from .marvai/review.var, overrides .marvai/project.var, ~/.config/marvai/vars/global.var)\n",
+		"author: Jane (from .marvai/review.local.var, overrides ~/.config/marvai/vars/global.var)\n",
+		"token: ******** (from ~/.config/marvai/vars/review.var)\n",
+		"strict: no (from .marvai/review.var)\n",
+		"team: core (from .marvai/project.var)\n",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Expected output containing %q, got:\n%s", line, out.String())
+		}
+	}
+	if strings.Contains(out.String(), "secret-token") {
+		t.Error("Secret must not be shown")
+	}
+}
+
+func TestValidatePromptNameReservedVarFiles(t *testing.T) {
+	for _, name := range []string{"project", "review.local"} {
+		if err := ValidatePromptName(name); err == nil {
+			t.Errorf("Expected error for prompt name %q", name)
+		}
+	}
+}
+
+func TestEnsureLocalVarsIgnored(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := ensureLocalVarsIgnored(fs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	content, err := afero.ReadFile(fs, ".marvai/.gitignore")
+	if err != nil || string(content) != "*.local.var\n" {
+		t.Errorf("Expected .gitignore with *.local.var, got %q (%v)", content, err)
+	}
+
+	// An existing .gitignore is left alone
+	if err := afero.WriteFile(fs, ".marvai/.gitignore", []byte("custom\n"), 0644); err != nil {
+		t.Fatalf("Failed to write .gitignore: %v", err)
+	}
+	if err := ensureLocalVarsIgnored(fs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if content, _ := afero.ReadFile(fs, ".marvai/.gitignore"); string(content) != "custom\n" {
+		t.Errorf("Expected .gitignore to be kept, got %q", content)
+	}
+}
+
+func TestResolveVarsSymlinkedDirectories(t *testing.T) {
+	tests := []struct {
+		name string
+		link string
+		// home reads the user-global layers, otherwise the project layers are read from the repo
+		home bool
+	}{
+		{name: "symlinked .marvai directory", link: "repo/.marvai"},
+		{name: "symlinked vars directory", link: "home/.config/marvai/vars", home: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			outside := filepath.Join(dir, "outside")
+			if err := os.MkdirAll(outside, 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			for _, name := range []string{"review.var", "global.var"} {
+				if err := os.WriteFile(filepath.Join(outside, name), []byte("language: Go\n"), 0644); err != nil {
+					t.Fatalf("Failed to write %s: %v", name, err)
+				}
+			}
+			if err := os.MkdirAll(filepath.Join(dir, "repo"), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			link := filepath.Join(dir, filepath.FromSlash(tt.link))
+			if err := os.MkdirAll(filepath.Dir(link), 0755); err != nil {
+				t.Fatalf("Failed to create directory: %v", err)
+			}
+			if err := os.Symlink(outside, link); err != nil {
+				t.Fatalf("Failed to create symlink: %v", err)
+			}
+
+			fs := afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(dir, "repo"))
+			homeDir := ""
+			if tt.home {
+				fs = afero.NewOsFs()
+				homeDir = filepath.Join(dir, "home")
+			}
+
+			_, err := ResolveVars(fs, "review", PromptOptions{HomeDir: homeDir})
+			if err == nil || !strings.Contains(err.Error(), "is a symbolic link") {
+				t.Errorf("Expected symbolic link error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadPromptStructuredValues(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	files := map[string]string{
+		".marvai/owners.mprompt": `name: Owners
+--
+- id: services
+  description: Services
+  type: list
+--
+{{#each services}}{{name}} ({{#each owners}}{{this}}{{#unless @last}}, {{/unless}}{{/each}})
+{{/each}}{{team.lead}}`,
+		".marvai/owners.var": `services:
+  - name: api
+    owners: [jane, joe]
+  - name: web
+    owners: [ann]
+team:
+  lead: Jane
+`,
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	content, err := LoadPromptWithOptions(fs, "owners", PromptOptions{})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := "api (jane, joe)\nweb (ann)\nJane"
+	if string(content) != expected {
+		t.Errorf("Expected %q, got %q", expected, string(content))
+	}
+}
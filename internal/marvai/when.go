@@ -0,0 +1,327 @@
+package marvai
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Conditions decide with the answers given so far if a wizard question is asked, e.g.
+//
+//	when: language == "go" && !legacy
+//
+// Operands are variable IDs, "quoted strings", numbers, true and false. Supported are
+// ==, !=, &&, ||, ! and parentheses. A variable on its own is true if it has a non-empty,
+// non-false value. Variables that were skipped have no value
+
+// whenCondition is a parsed when expression
+type whenCondition interface {
+	eval(values map[string]interface{}) bool
+}
+
+// whenOperand is a variable reference or a literal in a when expression
+type whenOperand struct {
+	variable string
+	literal  string
+}
+
+// value returns the operand as text to compare, skipped variables are empty
+func (o whenOperand) value(values map[string]interface{}) string {
+	if o.variable == "" {
+		return o.literal
+	}
+	value, ok := values[o.variable]
+	if !ok || value == nil {
+		return ""
+	}
+	return formatVarValue(value)
+}
+
+func (o whenOperand) eval(values map[string]interface{}) bool {
+	if o.variable == "" {
+		return o.literal != "" && o.literal != "false"
+	}
+	value, ok := values[o.variable]
+	if !ok || isEmptyVarValue(value) {
+		return false
+	}
+	if b, isBool := value.(bool); isBool {
+		return b
+	}
+	return true
+}
+
+type whenCompare struct {
+	left, right whenOperand
+	equal       bool
+}
+
+func (c whenCompare) eval(values map[string]interface{}) bool {
+	return (c.left.value(values) == c.right.value(values)) == c.equal
+}
+
+type whenNot struct {
+	operand whenCondition
+}
+
+func (n whenNot) eval(values map[string]interface{}) bool {
+	return !n.operand.eval(values)
+}
+
+type whenLogical struct {
+	left, right whenCondition
+	and         bool
+}
+
+func (l whenLogical) eval(values map[string]interface{}) bool {
+	if l.and {
+		return l.left.eval(values) && l.right.eval(values)
+	}
+	return l.left.eval(values) || l.right.eval(values)
+}
+
+// Limits for when expressions
+const (
+	maxWhenLength = 1000
+	maxWhenDepth  = 32
+)
+
+// parseWhen parses a when expression and returns the variables it references
+func parseWhen(expression string) (whenCondition, []string, error) {
+	// SECURITY: Limit expression size and nesting
+	if len(expression) > maxWhenLength {
+		return nil, nil, fmt.Errorf("condition too long: %d characters", len(expression))
+	}
+
+	tokens, err := tokenizeWhen(expression)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, nil, fmt.Errorf("condition is empty")
+	}
+
+	p := &whenParser{tokens: tokens}
+	condition, err := p.parseOr(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, nil, fmt.Errorf("unexpected %q in condition", p.tokens[p.pos].text)
+	}
+	return condition, p.references, nil
+}
+
+// evaluateWhen reports if a variable is asked given the values so far, variables without a condition are always asked
+func evaluateWhen(variable WizardVariable, values map[string]interface{}) (bool, error) {
+	if strings.TrimSpace(variable.When) == "" {
+		return true, nil
+	}
+	condition, _, err := parseWhen(variable.When)
+	if err != nil {
+		return false, fmt.Errorf("invalid when condition of variable '%s': %w", variable.ID, err)
+	}
+	return condition.eval(values), nil
+}
+
+// validateWhenReferences checks that the condition of the variable at index i only references earlier variables
+func validateWhenReferences(i int, variable WizardVariable, earlier map[string]bool) error {
+	if strings.TrimSpace(variable.When) == "" {
+		return nil
+	}
+	_, references, err := parseWhen(variable.When)
+	if err != nil {
+		return fmt.Errorf("variable %d has invalid when: %w", i, err)
+	}
+	for _, reference := range references {
+		if !earlier[reference] {
+			return fmt.Errorf("variable %d when condition references %q, which is not an earlier variable", i, reference)
+		}
+	}
+	return nil
+}
+
+type whenTokenKind int
+
+const (
+	whenIdent whenTokenKind = iota
+	whenString
+	whenNumber
+	whenOperator
+)
+
+type whenToken struct {
+	kind whenTokenKind
+	text string
+}
+
+// tokenizeWhen splits a when expression into identifiers, literals and operators
+func tokenizeWhen(expression string) ([]whenToken, error) {
+	var tokens []whenToken
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '"' || r == '\'':
+			end := i + 1
+			var text strings.Builder
+			for end < len(runes) && runes[end] != r {
+				if runes[end] == '\\' && end+1 < len(runes) {
+					end++
+				}
+				text.WriteRune(runes[end])
+				end++
+			}
+			if end >= len(runes) {
+				return nil, fmt.Errorf("unterminated string in condition")
+			}
+			tokens = append(tokens, whenToken{kind: whenString, text: text.String()})
+			i = end + 1
+		case r == '-' || unicode.IsDigit(r):
+			end := i + 1
+			for end < len(runes) && unicode.IsDigit(runes[end]) {
+				end++
+			}
+			number := string(runes[i:end])
+			if _, err := strconv.Atoi(number); err != nil {
+				return nil, fmt.Errorf("invalid number %q in condition", number)
+			}
+			tokens = append(tokens, whenToken{kind: whenNumber, text: number})
+			i = end
+		case unicode.IsLetter(r) || r == '_':
+			end := i + 1
+			for end < len(runes) && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_' || runes[end] == '-') {
+				end++
+			}
+			tokens = append(tokens, whenToken{kind: whenIdent, text: string(runes[i:end])})
+			i = end
+		default:
+			operator := ""
+			for _, candidate := range []string{"==", "!=", "&&", "||", "!", "(", ")"} {
+				if strings.HasPrefix(string(runes[i:]), candidate) {
+					operator = candidate
+					break
+				}
+			}
+			if operator == "" {
+				return nil, fmt.Errorf("unexpected character %q in condition", r)
+			}
+			tokens = append(tokens, whenToken{kind: whenOperator, text: operator})
+			i += len(operator)
+		}
+	}
+
+	return tokens, nil
+}
+
+// whenParser is a recursive descent parser for when expressions
+type whenParser struct {
+	tokens     []whenToken
+	pos        int
+	references []string
+}
+
+func (p *whenParser) peekOperator(operator string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == whenOperator && p.tokens[p.pos].text == operator
+}
+
+func (p *whenParser) parseOr(depth int) (whenCondition, error) {
+	left, err := p.parseAnd(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("||") {
+		p.pos++
+		right, err := p.parseAnd(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = whenLogical{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseAnd(depth int) (whenCondition, error) {
+	left, err := p.parseUnary(depth)
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOperator("&&") {
+		p.pos++
+		right, err := p.parseUnary(depth)
+		if err != nil {
+			return nil, err
+		}
+		left = whenLogical{left: left, right: right, and: true}
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseUnary(depth int) (whenCondition, error) {
+	if depth > maxWhenDepth {
+		return nil, fmt.Errorf("condition nested too deeply")
+	}
+	if p.peekOperator("!") {
+		p.pos++
+		operand, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return whenNot{operand: operand}, nil
+	}
+	if p.peekOperator("(") {
+		p.pos++
+		condition, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.peekOperator(")") {
+			return nil, fmt.Errorf("missing ) in condition")
+		}
+		p.pos++
+		return condition, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	if p.peekOperator("==") || p.peekOperator("!=") {
+		equal := p.tokens[p.pos].text == "=="
+		p.pos++
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return whenCompare{left: left, right: right, equal: equal}, nil
+	}
+	return left, nil
+}
+
+func (p *whenParser) parseOperand() (whenOperand, error) {
+	if p.pos >= len(p.tokens) {
+		return whenOperand{}, fmt.Errorf("unexpected end of condition")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+
+	switch token.kind {
+	case whenString, whenNumber:
+		return whenOperand{literal: token.text}, nil
+	case whenIdent:
+		if token.text == "true" || token.text == "false" {
+			return whenOperand{literal: token.text}, nil
+		}
+		if !isValidVariableNameLocal(token.text) {
+			return whenOperand{}, fmt.Errorf("invalid variable %q in condition", token.text)
+		}
+		p.references = append(p.references, token.text)
+		return whenOperand{variable: token.text}, nil
+	default:
+		return whenOperand{}, fmt.Errorf("unexpected %q in condition", token.text)
+	}
+}
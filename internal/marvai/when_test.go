@@ -0,0 +1,213 @@
+package marvai
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseWhen(t *testing.T) {
+	values := map[string]interface{}{
+		"language": "go",
+		"tests":    true,
+		"legacy":   false,
+		"count":    3,
+		"name":     "",
+		"modules":  []string{"api"},
+	}
+
+	tests := []struct {
+		expression         string
+		expected           bool
+		expectedReferences []string
+		expectError        bool
+	}{
+		{expression: `language == "go"`, expected: true, expectedReferences: []string{"language"}},
+		{expression: `language != 'go'`, expected: false, expectedReferences: []string{"language"}},
+		{expression: `tests`, expected: true, expectedReferences: []string{"tests"}},
+		{expression: `legacy`, expected: false, expectedReferences: []string{"legacy"}},
+		{expression: `!legacy && tests`, expected: true, expectedReferences: []string{"legacy", "tests"}},
+		{expression: `name || modules`, expected: true, expectedReferences: []string{"name", "modules"}},
+		{expression: `count == 3`, expected: true, expectedReferences: []string{"count"}},
+		{expression: `tests == true`, expected: true, expectedReferences: []string{"tests"}},
+		{expression: `skipped == ""`, expected: true, expectedReferences: []string{"skipped"}},
+		{expression: `skipped`, expected: false, expectedReferences: []string{"skipped"}},
+		{expression: `language == "rust" || (tests && !(count == 4))`, expected: true, expectedReferences: []string{"language", "tests", "count"}},
+		{expression: ``, expectError: true},
+		{expression: `language = "go"`, expectError: true},
+		{expression: `language == `, expectError: true},
+		{expression: `(tests`, expectError: true},
+		{expression: `language == "go`, expectError: true},
+		{expression: `tests tests`, expectError: true},
+		{expression: `__proto__`, expectError: true},
+		{expression: strings.Repeat("!", maxWhenDepth+2) + "tests", expectError: true},
+		{expression: strings.Repeat("a", maxWhenLength+1), expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			condition, references, err := parseWhen(tt.expression)
+			if tt.expectError {
+				if err == nil {
+					t.Errorf("Expected error for %q", tt.expression)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if actual := condition.eval(values); actual != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, actual)
+			}
+			if !reflect.DeepEqual(references, tt.expectedReferences) {
+				t.Errorf("Expected references %v, got %v", tt.expectedReferences, references)
+			}
+		})
+	}
+}
+
+func TestValidateWizardVariablesWhen(t *testing.T) {
+	tests := []struct {
+		name        string
+		variables   []WizardVariable
+		expectError string
+	}{
+		{
+			name: "references earlier variable",
+			variables: []WizardVariable{
+				{ID: "language"},
+				{ID: "test_framework", When: `language == "go"`},
+			},
+		},
+		{
+			name: "references later variable",
+			variables: []WizardVariable{
+				{ID: "test_framework", When: `language == "go"`},
+				{ID: "language"},
+			},
+			expectError: `references "language", which is not an earlier variable`,
+		},
+		{
+			name: "references itself",
+			variables: []WizardVariable{
+				{ID: "tests", When: `tests`},
+			},
+			expectError: "not an earlier variable",
+		},
+		{
+			name: "invalid syntax",
+			variables: []WizardVariable{
+				{ID: "language"},
+				{ID: "test_framework", When: `language ==`},
+			},
+			expectError: "invalid when",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWizardVariables(tt.variables)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestExecuteWizardValuesWhen(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "language", Description: "Language", Type: "choice", Options: []string{"go", "python"}, Required: true},
+		{ID: "test_framework", Description: "Test framework", Required: true, When: `language == "go"`},
+		{ID: "venv", Description: "Use a virtualenv", Type: "bool", When: `language == "python"`},
+	}
+
+	tests := []struct {
+		name      string
+		userInput string
+		prefill   map[string]interface{}
+		expected  map[string]interface{}
+	}{
+		{
+			name:      "condition matches",
+			userInput: "go\ntestify\n",
+			expected:  map[string]interface{}{"language": "go", "test_framework": "testify"},
+		},
+		{
+			name:      "required variable skipped",
+			userInput: "python\nyes\n",
+			expected:  map[string]interface{}{"language": "python", "venv": true},
+		},
+		{
+			name:      "prefill of skipped variable is dropped",
+			userInput: "python\n\n",
+			prefill:   map[string]interface{}{"language": "go", "test_framework": "testify"},
+			expected:  map[string]interface{}{"language": "python", "venv": false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			values, err := ExecuteWizardValuesWithReader(afero.NewMemMapFs(), variables, tt.prefill, strings.NewReader(tt.userInput), &out)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, values)
+			}
+		})
+	}
+}
+
+func TestRunWizardWhenNonInteractive(t *testing.T) {
+	variables := []WizardVariable{
+		{ID: "language", Required: true},
+		{ID: "test_framework", Required: true, When: `language == "go"`},
+	}
+
+	tests := []struct {
+		name        string
+		set         map[string]string
+		expected    map[string]interface{}
+		expectError string
+	}{
+		{
+			name:     "skipped required variable is not missing",
+			set:      map[string]string{"language": "python", "test_framework": "pytest"},
+			expected: map[string]interface{}{"language": "python"},
+		},
+		{
+			name:        "asked required variable is missing",
+			set:         map[string]string{"language": "go"},
+			expectError: "test_framework",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := InstallOptions{Yes: true, Answers: WizardAnswers{Set: tt.set}}
+			values, err := runWizard(afero.NewMemMapFs(), variables, nil, opts)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(values, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, values)
+			}
+		})
+	}
+}
@@ -0,0 +1,668 @@
+package marvai
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/spf13/afero"
+	"golang.org/x/term"
+)
+
+// Wizard variable types
+const (
+	VarTypeString    = "string"
+	VarTypeChoice    = "choice"
+	VarTypeBool      = "bool"
+	VarTypeInt       = "int"
+	VarTypeList      = "list"
+	VarTypePath      = "path"
+	VarTypeMultiline = "multiline"
+	VarTypeSecret    = "secret"
+)
+
+// wizardVariableTypes are the supported wizard variable types
+var wizardVariableTypes = []string{
+	VarTypeString, VarTypeChoice, VarTypeBool, VarTypeInt,
+	VarTypeList, VarTypePath, VarTypeMultiline, VarTypeSecret,
+}
+
+// multilineTerminator is the line that ends multiline input
+const multilineTerminator = "."
+
+// maxWizardAttempts is how often the wizard asks for a variable before giving up on invalid input
+const maxWizardAttempts = 5
+
+// isWizardVariableType checks if a type is a supported wizard variable type, empty means string
+func isWizardVariableType(variableType string) bool {
+	if variableType == "" {
+		return true
+	}
+	for _, supported := range wizardVariableTypes {
+		if variableType == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// variableType returns the type of the variable, string if no type is given
+func (v WizardVariable) variableType() string {
+	if v.Type == "" {
+		return VarTypeString
+	}
+	return v.Type
+}
+
+// ExecuteWizard prompts the user for variable values
+func ExecuteWizard(variables []WizardVariable) (map[string]string, error) {
+	return ExecuteWizardWithReader(variables, os.Stdin)
+}
+
+// ExecuteWizardWithReader prompts the user for variable values using the provided reader
+func ExecuteWizardWithReader(variables []WizardVariable, reader io.Reader) (map[string]string, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("reader cannot be nil")
+	}
+
+	values, err := ExecuteWizardValuesWithReader(afero.NewOsFs(), variables, nil, reader, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	return formatVarValues(values), nil
+}
+
+// ExecuteWizardWithPrefills prompts the user for variable values with prefilled defaults
+func ExecuteWizardWithPrefills(variables []WizardVariable, prefillValues map[string]string) (map[string]string, error) {
+	return ExecuteWizardWithPrefilledReader(variables, prefillValues, os.Stdin)
+}
+
+// ExecuteWizardWithPrefilledReader prompts the user for variable values with prefilled defaults using a custom reader
+func ExecuteWizardWithPrefilledReader(variables []WizardVariable, prefillValues map[string]string, reader io.Reader) (map[string]string, error) {
+	prefill := make(map[string]interface{}, len(prefillValues))
+	for key, value := range prefillValues {
+		prefill[key] = value
+	}
+
+	values, err := ExecuteWizardValuesWithReader(afero.NewOsFs(), variables, prefill, reader, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	return formatVarValues(values), nil
+}
+
+// ExecuteWizardValues prompts the user on the terminal for typed variable values, with the terminal UI
+// if stdin and stdout are a terminal. Prefilled values are kept when the user presses Enter
+func ExecuteWizardValues(fs afero.Fs, variables []WizardVariable, prefill map[string]interface{}) (map[string]interface{}, error) {
+	return askOnTerminal(fs, variables, prefill, nil)
+}
+
+// newTerminalWizard returns a line by line wizard on stdin and stdout that reads secrets without echo on a terminal
+func newTerminalWizard(fs afero.Fs) *wizard {
+	w := newWizard(fs, os.Stdin, os.Stdout)
+
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		w.readSecret = func() (string, error) {
+			secret, err := term.ReadPassword(fd)
+			fmt.Fprintln(w.out)
+			return string(secret), err
+		}
+	}
+
+	return w
+}
+
+// ExecuteWizardValuesWithReader prompts for typed variable values reading answers from reader and writing prompts to out
+func ExecuteWizardValuesWithReader(fs afero.Fs, variables []WizardVariable, prefill map[string]interface{}, reader io.Reader, out io.Writer) (map[string]interface{}, error) {
+	if reader == nil {
+		return nil, fmt.Errorf("reader cannot be nil")
+	}
+	return newWizard(fs, reader, out).run(variables, prefill)
+}
+
+// wizard asks for variable values one by one and re-prompts on invalid input
+type wizard struct {
+	fs      afero.Fs
+	scanner *bufio.Scanner
+	out     io.Writer
+	// readSecret reads a secret without echo, secrets are read as a line from scanner if nil
+	readSecret func() (string, error)
+	// answers are used without asking, e.g. from --set
+	answers map[string]interface{}
+}
+
+func newWizard(fs afero.Fs, reader io.Reader, out io.Writer) *wizard {
+	return &wizard{
+		fs:      fs,
+		scanner: bufio.NewScanner(reader),
+		out:     out,
+	}
+}
+
+// run asks for all variables, values for optional variables left empty are set to the empty value of their type.
+// Variables whose when condition doesn't match the earlier values are skipped and have no value
+func (w *wizard) run(variables []WizardVariable, prefill map[string]interface{}) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	for _, variable := range variables {
+		asked, err := evaluateWhen(variable, values)
+		if err != nil {
+			return nil, err
+		}
+		if !asked {
+			continue
+		}
+
+		if answer, ok := w.answers[variable.ID]; ok {
+			values[variable.ID] = answer
+			continue
+		}
+
+		// Prefilled values that don't fit the variable (e.g. after a type change) are not offered
+		existing, hasExisting := prefill[variable.ID]
+		if hasExisting {
+			parsed, err := parseVarValue(w.fs, variable, existing)
+			existing, hasExisting = parsed, err == nil && !isEmptyVarValue(parsed)
+		}
+
+		value, err := w.ask(variable, existing, hasExisting)
+		if err != nil {
+			return nil, err
+		}
+		if value != nil {
+			values[variable.ID] = value
+		}
+	}
+
+	return values, nil
+}
+
+// ask prompts for a single variable until a valid value is entered or the input ends
+func (w *wizard) ask(variable WizardVariable, existing interface{}, hasExisting bool) (interface{}, error) {
+	var lastErr error
+
+	if variable.Help != "" {
+		fmt.Fprintf(w.out, "%s\n", variable.Help)
+	}
+
+	for attempt := 1; ; attempt++ {
+		w.printPrompt(variable, existing, hasExisting)
+
+		input, eof, err := w.read(variable)
+		if err != nil {
+			return nil, fmt.Errorf("error reading input for variable '%s': %w", variable.ID, err)
+		}
+
+		if input == "" {
+			if eof && lastErr != nil {
+				return nil, fmt.Errorf("invalid value for variable '%s': %w", variable.ID, lastErr)
+			}
+			if hasExisting {
+				return existing, nil
+			}
+			if variable.Required {
+				if eof {
+					return nil, fmt.Errorf("variable '%s' is required but EOF encountered", variable.ID)
+				}
+				if attempt >= maxWizardAttempts {
+					return nil, fmt.Errorf("variable '%s' is required but no value was entered after %d attempts", variable.ID, attempt)
+				}
+				fmt.Fprintf(w.out, "A value is required.\n")
+				continue
+			}
+			return emptyVarValue(variable), nil
+		}
+
+		value, err := parseVarInput(w.fs, variable, input)
+		if err == nil {
+			return value, nil
+		}
+		if eof {
+			return nil, fmt.Errorf("invalid value for variable '%s': %w", variable.ID, err)
+		}
+		if attempt >= maxWizardAttempts {
+			return nil, fmt.Errorf("invalid value for variable '%s' after %d attempts: %w", variable.ID, attempt, err)
+		}
+		fmt.Fprintf(w.out, "Invalid value: %v\n", err)
+		lastErr = err
+	}
+}
+
+// printPrompt shows the description, a hint for the expected input and the prefilled value
+func (w *wizard) printPrompt(variable WizardVariable, existing interface{}, hasExisting bool) {
+	prompt := variable.Description
+	if hint := inputHint(variable); hint != "" {
+		prompt += " (" + hint + ")"
+	}
+	if hasExisting {
+		prompt += " [" + displayVarValue(variable, existing) + "]"
+	}
+	fmt.Fprintf(w.out, "%s: ", prompt)
+}
+
+// read reads the raw input for a variable, eof is true if the input ended
+func (w *wizard) read(variable WizardVariable) (string, bool, error) {
+	if variable.hidesInput() {
+		if w.readSecret != nil {
+			secret, err := w.readSecret()
+			if err == io.EOF {
+				return strings.TrimSpace(secret), true, nil
+			}
+			return strings.TrimSpace(secret), false, err
+		}
+		return w.readLine()
+	}
+
+	switch variable.variableType() {
+	case VarTypeList:
+		// One or more lines with comma-separated items, ended by an empty line
+		return w.readLines(func(line string) bool { return line == "" })
+	case VarTypeMultiline:
+		// Lines ended by a terminator line, an empty first line keeps the prefilled value
+		return w.readLines(func(line string) bool { return line == multilineTerminator })
+	default:
+		return w.readLine()
+	}
+}
+
+// readLine reads a single trimmed line
+func (w *wizard) readLine() (string, bool, error) {
+	if w.scanner.Scan() {
+		return strings.TrimSpace(w.scanner.Text()), false, nil
+	}
+	return "", true, w.scanner.Err()
+}
+
+// readLines reads lines until isEnd returns true for a line or the input ends.
+// An empty first line ends the input immediately
+func (w *wizard) readLines(isEnd func(line string) bool) (string, bool, error) {
+	var lines []string
+	for {
+		if !w.scanner.Scan() {
+			return strings.TrimSpace(strings.Join(lines, "\n")), true, w.scanner.Err()
+		}
+		line := strings.TrimRight(w.scanner.Text(), "\r")
+		if isEnd(strings.TrimSpace(line)) || (len(lines) == 0 && strings.TrimSpace(line) == "") {
+			return strings.TrimSpace(strings.Join(lines, "\n")), false, nil
+		}
+		lines = append(lines, line)
+
+		// SECURITY: Limit the size of multi-line input
+		if len(lines) > 10000 {
+			return "", false, fmt.Errorf("input too long, maximum allowed is 10000 lines")
+		}
+	}
+}
+
+// inputHint describes the expected input for a variable type
+func inputHint(variable WizardVariable) string {
+	switch variable.variableType() {
+	case VarTypeChoice:
+		return strings.Join(variable.Options, "/")
+	case VarTypeBool:
+		return "yes/no"
+	case VarTypeInt:
+		switch {
+		case variable.Min != nil && variable.Max != nil:
+			return fmt.Sprintf("number %d-%d", *variable.Min, *variable.Max)
+		case variable.Min != nil:
+			return fmt.Sprintf("number >= %d", *variable.Min)
+		case variable.Max != nil:
+			return fmt.Sprintf("number <= %d", *variable.Max)
+		}
+		return "number"
+	case VarTypeList:
+		return "comma-separated or one per line, empty line to finish"
+	case VarTypePath:
+		return "path in the repository"
+	case VarTypeMultiline:
+		return fmt.Sprintf("end with a line containing only %s", multilineTerminator)
+	}
+	return ""
+}
+
+// displayVarValue formats a value for display in a prompt, secrets are never shown
+func displayVarValue(variable WizardVariable, value interface{}) string {
+	if variable.isSecret() || isSecretRef(value) {
+		return "********"
+	}
+	switch variable.variableType() {
+	case VarTypeBool:
+		if value == true {
+			return "yes"
+		}
+		return "no"
+	case VarTypeMultiline:
+		text := formatVarValue(value)
+		if firstLine, _, found := strings.Cut(text, "\n"); found {
+			return firstLine + " ..."
+		}
+		return text
+	}
+	return formatVarValue(value)
+}
+
+// emptyVarValue is the value of an optional variable left empty, nil means the variable is not set
+func emptyVarValue(variable WizardVariable) interface{} {
+	switch variable.variableType() {
+	case VarTypeBool:
+		return false
+	case VarTypeInt:
+		return nil
+	case VarTypeList:
+		return []string{}
+	}
+	return ""
+}
+
+// isEmptyVarValue checks if a value is empty
+func isEmptyVarValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []string:
+		return len(v) == 0
+	}
+	return false
+}
+
+// parseVarInput parses and validates user input for a variable into a value of its type
+func parseVarInput(fs afero.Fs, variable WizardVariable, input string) (interface{}, error) {
+	switch variable.variableType() {
+	case VarTypeChoice:
+		return parseChoice(variable, input)
+	case VarTypeBool:
+		return parseBool(input)
+	case VarTypeInt:
+		value, err := strconv.Atoi(strings.TrimSpace(input))
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a whole number", input)
+		}
+		return checkIntRange(variable, value)
+	case VarTypeList:
+		return parseList(input), nil
+	case VarTypePath:
+		path, err := validateVarPath(fs, input)
+		if err != nil {
+			return nil, err
+		}
+		return checkTextRules(variable, path)
+	}
+	return checkTextRules(variable, input)
+}
+
+// parseVarValue converts a stored or prefilled value into a valid value of the variable's type.
+// Strings are parsed like user input, so values from older .var files keep working
+func parseVarValue(fs afero.Fs, variable WizardVariable, value interface{}) (interface{}, error) {
+	if text, ok := value.(string); ok {
+		if text == "" {
+			return emptyVarValue(variable), nil
+		}
+		return parseVarInput(fs, variable, text)
+	}
+
+	switch variable.variableType() {
+	case VarTypeBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case VarTypeInt:
+		switch n := value.(type) {
+		case int:
+			return checkIntRange(variable, n)
+		case int64:
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return checkIntRange(variable, int(n))
+			}
+		case float64:
+			if n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+				return checkIntRange(variable, int(n))
+			}
+		}
+	case VarTypeList:
+		switch items := value.(type) {
+		case []string:
+			return items, nil
+		case []interface{}:
+			result := make([]string, 0, len(items))
+			for _, item := range items {
+				switch item.(type) {
+				case string, bool, int, int64, float64:
+					result = append(result, fmt.Sprint(item))
+				default:
+					// Lists of maps or lists from .var files are passed to the template as they are
+					return items, nil
+				}
+			}
+			return result, nil
+		}
+	case VarTypeString, VarTypeMultiline, VarTypeSecret:
+		switch value.(type) {
+		case bool, int, int64, float64:
+			return checkTextRules(variable, fmt.Sprint(value))
+		}
+	case VarTypeChoice:
+		switch value.(type) {
+		case bool, int, int64, float64:
+			return parseChoice(variable, fmt.Sprint(value))
+		}
+	}
+
+	return nil, fmt.Errorf("expected a %s value, got %T", variable.variableType(), value)
+}
+
+// normalizeVarValues converts values of defined variables to their types, values that don't fit are kept as they are
+func normalizeVarValues(fs afero.Fs, variables []WizardVariable, values map[string]interface{}) map[string]interface{} {
+	normalized := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		normalized[key] = value
+	}
+	for _, variable := range variables {
+		value, ok := values[variable.ID]
+		if !ok {
+			continue
+		}
+		if parsed, err := parseVarValue(fs, variable, value); err == nil && parsed != nil {
+			normalized[variable.ID] = parsed
+		}
+	}
+	return normalized
+}
+
+// parseChoice accepts an option, case-insensitively, or its 1-based number
+func parseChoice(variable WizardVariable, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	for _, option := range variable.Options {
+		if input == option {
+			return option, nil
+		}
+	}
+	for _, option := range variable.Options {
+		if strings.EqualFold(input, option) {
+			return option, nil
+		}
+	}
+	if index, err := strconv.Atoi(input); err == nil && index >= 1 && index <= len(variable.Options) {
+		return variable.Options[index-1], nil
+	}
+	return "", fmt.Errorf("%q is not one of: %s", input, strings.Join(variable.Options, ", "))
+}
+
+// parseBool accepts yes/no style answers
+func parseBool(input string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(input)) {
+	case "y", "yes", "true", "1":
+		return true, nil
+	case "n", "no", "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not yes or no", input)
+}
+
+// checkIntRange checks an int against the variable's min and max
+func checkIntRange(variable WizardVariable, value int) (int, error) {
+	if variable.Min != nil && value < *variable.Min {
+		return 0, fmt.Errorf("%d is less than the minimum %d", value, *variable.Min)
+	}
+	if variable.Max != nil && value > *variable.Max {
+		return 0, fmt.Errorf("%d is greater than the maximum %d", value, *variable.Max)
+	}
+	return value, nil
+}
+
+// textRuleTypes are the variable types that support pattern, min_length and max_length
+var textRuleTypes = []string{VarTypeString, VarTypeMultiline, VarTypeSecret, VarTypePath}
+
+// hasTextRules reports if the variable declares pattern, min_length or max_length
+func (v WizardVariable) hasTextRules() bool {
+	return v.Pattern != "" || v.MinLength != nil || v.MaxLength != nil
+}
+
+// validateTextRules validates the pattern, min_length, max_length and error_message of the variable at index i
+func validateTextRules(i int, variable WizardVariable) error {
+	if len(variable.ErrorMessage) > 1000 {
+		return fmt.Errorf("variable %d error_message too long: %d characters", i, len(variable.ErrorMessage))
+	}
+	if !variable.hasTextRules() {
+		return nil
+	}
+
+	supported := false
+	for _, variableType := range textRuleTypes {
+		supported = supported || variable.variableType() == variableType
+	}
+	if !supported {
+		return fmt.Errorf("variable %d has pattern, min_length or max_length but is of type %s", i, variable.variableType())
+	}
+
+	// SECURITY: Go regular expressions run in linear time, the length limit bounds compilation
+	if len(variable.Pattern) > 1000 {
+		return fmt.Errorf("variable %d pattern too long: %d characters", i, len(variable.Pattern))
+	}
+	if _, err := compileVarPattern(variable.Pattern); err != nil {
+		return fmt.Errorf("variable %d has invalid pattern: %w", i, err)
+	}
+
+	if (variable.MinLength != nil && *variable.MinLength < 0) || (variable.MaxLength != nil && *variable.MaxLength < 0) {
+		return fmt.Errorf("variable %d has a negative min_length or max_length", i)
+	}
+	if variable.MinLength != nil && variable.MaxLength != nil && *variable.MinLength > *variable.MaxLength {
+		return fmt.Errorf("variable %d has min_length %d greater than max_length %d", i, *variable.MinLength, *variable.MaxLength)
+	}
+	return nil
+}
+
+// compileVarPattern compiles a pattern that has to match the whole value, nil if there is no pattern
+func compileVarPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(`^(?:` + pattern + `)$`)
+}
+
+// checkTextRules checks a text value against the variable's pattern, min_length and max_length.
+// The variable's error_message replaces the detailed message
+func checkTextRules(variable WizardVariable, value string) (string, error) {
+	if err := textRuleError(variable, value); err != nil {
+		if variable.ErrorMessage != "" {
+			return "", errors.New(variable.ErrorMessage)
+		}
+		return "", err
+	}
+	return value, nil
+}
+
+func textRuleError(variable WizardVariable, value string) error {
+	length := utf8.RuneCountInString(value)
+	if variable.MinLength != nil && length < *variable.MinLength {
+		return fmt.Errorf("must be at least %d characters long", *variable.MinLength)
+	}
+	if variable.MaxLength != nil && length > *variable.MaxLength {
+		return fmt.Errorf("must be at most %d characters long", *variable.MaxLength)
+	}
+	pattern, err := compileVarPattern(variable.Pattern)
+	if err != nil {
+		return err
+	}
+	if pattern != nil && !pattern.MatchString(value) {
+		return fmt.Errorf("does not match the pattern %s", variable.Pattern)
+	}
+	return nil
+}
+
+// parseList splits input on commas and newlines into trimmed, non-empty items
+func parseList(input string) []string {
+	items := []string{}
+	for _, line := range strings.Split(input, "\n") {
+		for _, item := range strings.Split(line, ",") {
+			if trimmed := strings.TrimSpace(item); trimmed != "" {
+				items = append(items, trimmed)
+			}
+		}
+	}
+	return items
+}
+
+// validateVarPath checks that a path is relative, stays inside the repository and exists.
+// Prompts are installed at the repository root, so paths are relative to the current directory
+func validateVarPath(fs afero.Fs, input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if filepath.IsAbs(input) {
+		return "", fmt.Errorf("%q must be relative to the repository root", input)
+	}
+
+	// SECURITY: Prevent paths outside of the repository
+	cleaned := filepath.Clean(input)
+	if cleaned == ".." || strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%q is outside of the repository", input)
+	}
+
+	// SECURITY: Symlinks could point outside of the repository, also for a directory on the way
+	if err := validatePathHasNoSymlinks(fs, "", cleaned); err != nil {
+		return "", err
+	}
+
+	if _, err := fs.Stat(cleaned); err != nil {
+		return "", fmt.Errorf("%q does not exist", input)
+	}
+
+	return filepath.ToSlash(cleaned), nil
+}
+
+// formatVarValues formats typed values as strings
+func formatVarValues(values map[string]interface{}) map[string]string {
+	result := make(map[string]string, len(values))
+	for key, value := range values {
+		result[key] = formatVarValue(value)
+	}
+	return result
+}
+
+// formatVarValue formats a typed value as string, list items are joined with commas
+func formatVarValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []string:
+		return strings.Join(v, ", ")
+	case []interface{}:
+		items := make([]string, len(v))
+		for i, item := range v {
+			items[i] = fmt.Sprint(item)
+		}
+		return strings.Join(items, ", ")
+	}
+	return fmt.Sprint(value)
+}
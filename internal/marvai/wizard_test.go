@@ -0,0 +1,323 @@
+package marvai
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v3"
+)
+
+func intPtr(value int) *int {
+	return &value
+}
+
+func TestExecuteWizardValuesTypes(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if err := afero.WriteFile(fs, "src/main.go", []byte("package main"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	tests := []struct {
+		name           string
+		variable       WizardVariable
+		prefill        map[string]interface{}
+		userInput      string
+		expectedValue  interface{}
+		expectedError  string
+		expectedOutput string
+	}{
+		{
+			name:          "choice by name",
+			variable:      WizardVariable{ID: "framework", Description: "Framework", Type: "choice", Options: []string{"gin", "echo"}},
+			userInput:     "Echo\n",
+			expectedValue: "echo",
+		},
+		{
+			name:           "choice by number after invalid input",
+			variable:       WizardVariable{ID: "framework", Description: "Framework", Type: "choice", Options: []string{"gin", "echo"}},
+			userInput:      "chi\n1\n",
+			expectedValue:  "gin",
+			expectedOutput: `"chi" is not one of: gin, echo`,
+		},
+		{
+			name:          "bool",
+			variable:      WizardVariable{ID: "tests", Description: "Write tests", Type: "bool"},
+			userInput:     "maybe\ny\n",
+			expectedValue: true,
+		},
+		{
+			name:          "optional bool left empty",
+			variable:      WizardVariable{ID: "tests", Description: "Write tests", Type: "bool"},
+			userInput:     "\n",
+			expectedValue: false,
+		},
+		{
+			name:           "int with range",
+			variable:       WizardVariable{ID: "count", Description: "Count", Type: "int", Min: intPtr(1), Max: intPtr(10)},
+			userInput:      "ten\n11\n7\n",
+			expectedValue:  7,
+			expectedOutput: "11 is greater than the maximum 10",
+		},
+		{
+			name:          "invalid int at end of input",
+			variable:      WizardVariable{ID: "count", Description: "Count", Type: "int"},
+			userInput:     "ten",
+			expectedError: "invalid value for variable 'count'",
+		},
+		{
+			name:          "comma-separated list",
+			variable:      WizardVariable{ID: "modules", Description: "Modules", Type: "list"},
+			userInput:     "api, web,\n\n",
+			expectedValue: []string{"api", "web"},
+		},
+		{
+			name:          "line-separated list",
+			variable:      WizardVariable{ID: "modules", Description: "Modules", Type: "list"},
+			userInput:     "api\nweb, cli\n\n",
+			expectedValue: []string{"api", "web", "cli"},
+		},
+		{
+			name:          "path inside repository",
+			variable:      WizardVariable{ID: "entry", Description: "Entry point", Type: "path"},
+			userInput:     "./src/../src/main.go\n",
+			expectedValue: "src/main.go",
+		},
+		{
+			name:           "path outside repository is rejected",
+			variable:       WizardVariable{ID: "entry", Description: "Entry point", Type: "path"},
+			userInput:      "../secret\n/etc/passwd\nmissing.go\nsrc\n",
+			expectedValue:  "src",
+			expectedOutput: "outside of the repository",
+		},
+		{
+			name:          "multiline",
+			variable:      WizardVariable{ID: "notes", Description: "Notes", Type: "multiline"},
+			userInput:     "first line\n\n--\nlast line\n.\n",
+			expectedValue: "first line\n\n--\nlast line",
+		},
+		{
+			name:          "secret read from reader",
+			variable:      WizardVariable{ID: "token", Description: "Token", Type: "secret"},
+			userInput:     "s3cret\n",
+			expectedValue: "s3cret",
+		},
+		{
+			name:           "secret prefill is not shown",
+			variable:       WizardVariable{ID: "token", Description: "Token", Type: "secret"},
+			prefill:        map[string]interface{}{"token": "s3cret"},
+			userInput:      "\n",
+			expectedValue:  "s3cret",
+			expectedOutput: "Token [********]: ",
+		},
+		{
+			name:          "prefilled list from .var file",
+			variable:      WizardVariable{ID: "modules", Description: "Modules", Type: "list"},
+			prefill:       map[string]interface{}{"modules": []interface{}{"api", "web"}},
+			userInput:     "\n",
+			expectedValue: []string{"api", "web"},
+		},
+		{
+			name:          "prefill of the wrong type is not offered",
+			variable:      WizardVariable{ID: "count", Description: "Count", Type: "int", Required: true},
+			prefill:       map[string]interface{}{"count": "many"},
+			userInput:     "\n3\n",
+			expectedValue: 3,
+		},
+		{
+			name:           "pattern re-prompts with error message",
+			variable:       WizardVariable{ID: "ticket", Description: "Ticket", Pattern: `[A-Z]+-[0-9]+`, ErrorMessage: "Use a ticket key like ABC-123"},
+			userInput:      "abc-123\nABC-123\n",
+			expectedValue:  "ABC-123",
+			expectedOutput: "Invalid value: Use a ticket key like ABC-123",
+		},
+		{
+			name:           "pattern matches the whole value",
+			variable:       WizardVariable{ID: "ticket", Description: "Ticket", Pattern: `[0-9]+`},
+			userInput:      "v12\n12\n",
+			expectedValue:  "12",
+			expectedOutput: "does not match the pattern [0-9]+",
+		},
+		{
+			name:           "length limits",
+			variable:       WizardVariable{ID: "name", Description: "Name", MinLength: intPtr(2), MaxLength: intPtr(4)},
+			userInput:      "a\nabcde\nabc\n",
+			expectedValue:  "abc",
+			expectedOutput: "must be at most 4 characters long",
+		},
+		{
+			name:          "optional value left empty skips rules",
+			variable:      WizardVariable{ID: "name", Description: "Name", MinLength: intPtr(2)},
+			userInput:     "\n",
+			expectedValue: "",
+		},
+		{
+			name:          "retry limit",
+			variable:      WizardVariable{ID: "count", Description: "Count", Type: "int"},
+			userInput:     strings.Repeat("x\n", maxWizardAttempts+1),
+			expectedError: "invalid value for variable 'count' after 5 attempts",
+		},
+		{
+			name:          "required retry limit",
+			variable:      WizardVariable{ID: "name", Description: "Name", Required: true},
+			userInput:     strings.Repeat("\n", maxWizardAttempts+1),
+			expectedError: "no value was entered after 5 attempts",
+		},
+		{
+			name:          "required value at end of input",
+			variable:      WizardVariable{ID: "framework", Description: "Framework", Type: "choice", Options: []string{"gin"}, Required: true},
+			userInput:     "",
+			expectedError: "variable 'framework' is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+			values, err := ExecuteWizardValuesWithReader(fs, []WizardVariable{tt.variable}, tt.prefill, strings.NewReader(tt.userInput), &output)
+
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(values[tt.variable.ID], tt.expectedValue) {
+				t.Errorf("Expected %#v, got %#v", tt.expectedValue, values[tt.variable.ID])
+			}
+			if tt.expectedOutput != "" && !strings.Contains(output.String(), tt.expectedOutput) {
+				t.Errorf("Expected output containing %q, got %q", tt.expectedOutput, output.String())
+			}
+		})
+	}
+}
+
+func TestValidateWizardVariableTypes(t *testing.T) {
+	tests := []struct {
+		name          string
+		variable      WizardVariable
+		expectedError string
+	}{
+		{name: "choice", variable: WizardVariable{ID: "a", Type: "choice", Options: []string{"x", "y"}}},
+		{name: "int range", variable: WizardVariable{ID: "a", Type: "int", Min: intPtr(0), Max: intPtr(5)}},
+		{name: "choice without options", variable: WizardVariable{ID: "a", Type: "choice"}, expectedError: "needs options"},
+		{name: "duplicate options", variable: WizardVariable{ID: "a", Type: "choice", Options: []string{"x", "x"}}, expectedError: "duplicate option"},
+		{name: "options on string", variable: WizardVariable{ID: "a", Options: []string{"x"}}, expectedError: "not of type choice"},
+		{name: "min greater than max", variable: WizardVariable{ID: "a", Type: "int", Min: intPtr(5), Max: intPtr(1)}, expectedError: "greater than max"},
+		{name: "min on string", variable: WizardVariable{ID: "a", Min: intPtr(1)}, expectedError: "not of type int"},
+		{name: "unknown type", variable: WizardVariable{ID: "a", Type: "float"}, expectedError: "unsupported type"},
+		{name: "text rules", variable: WizardVariable{ID: "a", Pattern: `[a-z]+`, MinLength: intPtr(1), MaxLength: intPtr(8), ErrorMessage: "lower case"}},
+		{name: "invalid pattern", variable: WizardVariable{ID: "a", Pattern: `[a-z`}, expectedError: "invalid pattern"},
+		{name: "pattern on int", variable: WizardVariable{ID: "a", Type: "int", Pattern: `[0-9]`}, expectedError: "is of type int"},
+		{name: "min_length greater than max_length", variable: WizardVariable{ID: "a", MinLength: intPtr(5), MaxLength: intPtr(1)}, expectedError: "greater than max_length"},
+		{name: "negative max_length", variable: WizardVariable{ID: "a", MaxLength: intPtr(-1)}, expectedError: "negative"},
+		{name: "default not matching pattern", variable: WizardVariable{ID: "a", Pattern: `[a-z]+`, Default: "ABC"}, expectedError: "invalid default"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateWizardVariable(0, tt.variable)
+			if tt.expectedError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestSaveVarValuesKeepsTypes(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	values := map[string]interface{}{
+		"tests":   true,
+		"count":   3,
+		"modules": []string{"api", "web"},
+		"version": "25",
+	}
+
+	if err := saveVarValues(fs, "test.var", values); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	content, err := afero.ReadFile(fs, "test.var")
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(content, &raw); err != nil {
+		t.Fatalf("Invalid YAML: %v", err)
+	}
+	if raw["tests"] != true || raw["count"] != 3 || raw["version"] != "25" {
+		t.Errorf("Values did not keep their YAML types: %s", content)
+	}
+	if modules, ok := raw["modules"].([]interface{}); !ok || len(modules) != 2 {
+		t.Errorf("Expected modules to be a YAML list: %s", content)
+	}
+}
+
+func TestLoadPromptTypedValues(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	mprompt := `name: Typed
+--
+- id: tests
+  description: Write tests
+  type: bool
+- id: modules
+  description: Modules
+  type: list
+--
+{{#if tests}}with tests{{else}}without tests{{/if}}:{{#each modules}} {{this}}{{/each}}`
+
+	files := map[string]string{
+		".marvai/typed.mprompt": mprompt,
+		// Values written by older versions are strings
+		".marvai/typed.var": "tests: \"false\"\nmodules: api, web\n",
+	}
+	for path, content := range files {
+		if err := afero.WriteFile(fs, path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", path, err)
+		}
+	}
+
+	result, err := LoadPrompt(fs, "typed")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(result) != "without tests: api web" {
+		t.Errorf("Unexpected result: %q", result)
+	}
+}
+
+func TestValidateVarPathSymlinkedDirectory(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "outside"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "outside", "secret.txt"), []byte("secret"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "repo"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.Symlink(filepath.Join(dir, "outside"), filepath.Join(dir, "repo", "docs")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	fs := afero.NewBasePathFs(afero.NewOsFs(), filepath.Join(dir, "repo"))
+	if _, err := validateVarPath(fs, "docs/secret.txt"); err == nil || !strings.Contains(err.Error(), "is a symbolic link") {
+		t.Errorf("Expected symbolic link error, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// maxPartials is the maximum number of partials of a template
+const maxPartials = 50
+
+var partialNameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]{0,63}$`)
+
+// ValidatePartialName checks that a partial name is a plain name like coding-standards
+func ValidatePartialName(name string) error {
+	if !partialNameRegex.MatchString(name) || dangerousNames[name] {
+		return fmt.Errorf("invalid partial name %q, expected up to 64 letters, digits, - and _ starting with a letter", name)
+	}
+	return nil
+}
+
+// validatePartials checks the partials of a template like the template itself.
+// Partials can't use partials, so rendering a partial can't recurse
+func validatePartials(partials map[string]string) error {
+	if len(partials) > maxPartials {
+		return fmt.Errorf("too many partials (%d), maximum allowed is %d", len(partials), maxPartials)
+	}
+
+	names := make([]string, 0, len(partials))
+	for name := range partials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if err := ValidatePartialName(name); err != nil {
+			return err
+		}
+		if _, err := parseTemplate(partials[name]); err != nil {
+			return fmt.Errorf("partial %q: %w", name, err)
+		}
+		inspection, err := checkTemplate(partials[name])
+		if err != nil {
+			return fmt.Errorf("partial %q: %w", name, err)
+		}
+		if len(inspection.partials) > 0 {
+			return fmt.Errorf("partial %q uses partial %q, partials can't use partials", name, inspection.partials[0].Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package internal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRenderTemplatePartials(t *testing.T) {
+	values := map[string]interface{}{
+		"language": "Go",
+		"path":     "it's",
+		"owner":    map[string]interface{}{"name": "Jane"},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		partials    map[string]string
+		escape      string
+		expected    string
+		expectError string
+	}{
+		{
+			name:     "partial in the template context",
+			template: "Review:\n{{> coding-standards}}",
+			partials: map[string]string{"coding-standards": "Write idiomatic {{language}}."},
+			expected: "Review:\nWrite idiomatic Go.",
+		},
+		{
+			name:     "partial with a context",
+			template: "{{> signature owner}}",
+			partials: map[string]string{"signature": "-- {{name}}"},
+			expected: "-- Jane",
+		},
+		{
+			name:     "escape mode applies to partials",
+			template: "{{> cat}}",
+			partials: map[string]string{"cat": "cat {{path}}"},
+			escape:   EscapeShell,
+			expected: `cat 'it'\''s'`,
+		},
+		{
+			name:        "unknown partial",
+			template:    "{{> missing}}",
+			partials:    map[string]string{"other": "x"},
+			expectError: `template uses partial "missing", which is not part of the prompt`,
+		},
+		{
+			name:        "partials can't use partials",
+			template:    "{{> outer}}",
+			partials:    map[string]string{"outer": "{{> outer}}"},
+			expectError: `partial "outer" uses partial "outer"`,
+		},
+		{
+			name:        "dangerous pattern in a partial",
+			template:    "{{> unsafe}}",
+			partials:    map[string]string{"unsafe": "{{constructor}}"},
+			expectError: `partial "unsafe": template contains dangerous pattern: "constructor"`,
+		},
+		{
+			name:        "partial that doesn't parse",
+			template:    "text",
+			partials:    map[string]string{"broken": "{{#if x}}"},
+			expectError: `partial "broken"`,
+		},
+		{
+			name:        "invalid partial name",
+			template:    "text",
+			partials:    map[string]string{"../x": "x"},
+			expectError: `invalid partial name "../x"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateWithOptions(tt.template, values, RenderOptions{Escape: tt.escape, Partials: tt.partials})
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestMissingReferencesWithPartials(t *testing.T) {
+	partials := map[string]string{
+		"standards": "Use {{language}} and {{linter}}.",
+		"signature": "-- {{name}} {{@root.team}}",
+	}
+	template := "line one\n{{> standards}}\n{{#if linter}}{{> standards}}{{/if}}\n{{> signature owner}}"
+
+	missing, err := MissingReferences(template, partials, map[string]interface{}{"language": "Go"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var names []string
+	for _, reference := range missing {
+		names = append(names, reference.Name)
+	}
+	if strings.Join(names, ",") != "linter,owner,team" {
+		t.Fatalf("Expected missing linter, owner and team, got %v", missing)
+	}
+	// References in a partial are at the line using it
+	if missing[0].Line != 2 || missing[2].Line != 4 {
+		t.Errorf("Expected references at lines 2 and 4, got %v", missing)
+	}
+}
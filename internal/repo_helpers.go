@@ -0,0 +1,286 @@
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aymerick/raymond"
+)
+
+// Repo gives the repo helpers read access to a git repository.
+// Paths are relative to the repository root with / separators
+type Repo interface {
+	// Files returns the files of the repository that .gitignore doesn't ignore, sorted
+	Files() ([]string, error)
+	// ReadFile reads a file returned by Files
+	ReadFile(path string) ([]byte, error)
+	// Diff returns the diff of the working tree against a git ref
+	Diff(ref string) (string, error)
+}
+
+// repoHelperNames are the helpers reading the repository of the prompt, e.g. {{file "go.mod"}}
+var repoHelperNames = []string{"file", "files", "git_diff", "tree"}
+
+// defaultTreeDepth is the depth of {{tree}} without depth=
+const defaultTreeDepth = 3
+
+// maxGlobStars limits the ** segments of a files pattern, each one multiplies the matching work
+const maxGlobStars = 4
+
+// binaryCheckBytes is the length of the start of a file checked for NUL bytes, like git does
+const binaryCheckBytes = 8000
+
+// repoHelper implements the repo helpers for a template, without a repo they fail
+type repoHelper struct {
+	repo Repo
+}
+
+// repoHelpers returns the repo helpers reading repo
+func repoHelpers(repo Repo) map[string]interface{} {
+	helper := &repoHelper{repo: repo}
+	return map[string]interface{}{
+		"file":     helper.file,
+		"files":    helper.files,
+		"git_diff": helper.gitDiff,
+		"tree":     helper.tree,
+	}
+}
+
+// need returns the repo or aborts rendering if there is none
+func (h *repoHelper) need(helper string) Repo {
+	if h.repo == nil {
+		panic(fmt.Errorf("%s needs a git repository", helper))
+	}
+	return h.repo
+}
+
+// file outputs a file of the repository, e.g. {{file "go.mod"}} or {{file "README.md" max_bytes=2000}}
+func (h *repoHelper) file(name string, options *raymond.Options) string {
+	repo := h.need("file")
+	limit := maxBytesOption("file", options)
+
+	content, err := repo.ReadFile(name)
+	if err != nil {
+		panic(fmt.Errorf("file: %w", err))
+	}
+	if isBinary(content) {
+		panic(fmt.Errorf("file: %q is a binary file", name))
+	}
+
+	if len(content) > limit {
+		return truncateUTF8(content, limit) + fmt.Sprintf("\n[truncated to %d bytes]", limit)
+	}
+
+	// SECURITY: Limit the size of the file in the prompt
+	checkHelperOutput("file", len(content))
+
+	return string(content)
+}
+
+// files outputs the files matching a pattern with a header each, e.g. {{files "internal/**/*.go" max_bytes=20000}}.
+// Files that don't fit into max_bytes are left out and counted, binary files are skipped
+func (h *repoHelper) files(pattern string, options *raymond.Options) string {
+	repo := h.need("files")
+	limit := maxBytesOption("files", options)
+
+	if strings.Count(pattern, "**") > maxGlobStars {
+		panic(fmt.Errorf("files: pattern %q has more than %d **", pattern, maxGlobStars))
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		panic(fmt.Errorf("files: invalid pattern %q: %w", pattern, err))
+	}
+
+	names, err := repo.Files()
+	if err != nil {
+		panic(fmt.Errorf("files: %w", err))
+	}
+
+	var result strings.Builder
+	size, omitted := 0, 0
+	patternParts := strings.Split(pattern, "/")
+	for _, name := range names {
+		if !matchGlob(patternParts, strings.Split(name, "/")) {
+			continue
+		}
+		if omitted > 0 {
+			omitted++
+			continue
+		}
+
+		content, err := repo.ReadFile(name)
+		if errors.Is(err, fs.ErrNotExist) {
+			// Deleted files are still listed until the deletion is committed
+			continue
+		}
+		if err != nil {
+			panic(fmt.Errorf("files: %w", err))
+		}
+		if isBinary(content) {
+			continue
+		}
+
+		// SECURITY: Limit the size of the files in the prompt
+		if size+len(content) > limit {
+			omitted++
+			continue
+		}
+		size += len(content)
+
+		fmt.Fprintf(&result, "==> %s <==\n%s", name, content)
+		if len(content) > 0 && !bytes.HasSuffix(content, []byte("\n")) {
+			result.WriteString("\n")
+		}
+		result.WriteString("\n")
+	}
+	if omitted > 0 {
+		fmt.Fprintf(&result, "==> %d more files left out, max_bytes %d reached <==\n", omitted, limit)
+	}
+
+	checkHelperOutput("files", result.Len())
+	return strings.TrimSuffix(result.String(), "\n")
+}
+
+// gitDiff outputs the changes of the working tree against a git ref, e.g. {{git_diff "main"}}
+func (h *repoHelper) gitDiff(ref string) string {
+	repo := h.need("git_diff")
+
+	diff, err := repo.Diff(ref)
+	if err != nil {
+		panic(fmt.Errorf("git_diff: %w", err))
+	}
+
+	// SECURITY: Limit the size of the diff in the prompt
+	checkHelperOutput("git_diff", len(diff))
+
+	return diff
+}
+
+// treeNode is a directory of the tree, files have no children
+type treeNode struct {
+	children map[string]*treeNode
+}
+
+// tree outputs the directories and files of the repository, e.g. {{tree depth=2}}
+func (h *repoHelper) tree(options *raymond.Options) string {
+	repo := h.need("tree")
+
+	depth := defaultTreeDepth
+	if value := options.HashProp("depth"); value != nil {
+		parsed, err := helperInt(value)
+		if err != nil || parsed < 1 {
+			panic(fmt.Errorf("tree needs a depth of at least 1, got %v", value))
+		}
+		depth = parsed
+	}
+
+	names, err := repo.Files()
+	if err != nil {
+		panic(fmt.Errorf("tree: %w", err))
+	}
+
+	root := &treeNode{children: make(map[string]*treeNode)}
+	for _, name := range names {
+		node := root
+		parts := strings.Split(name, "/")
+		for i, part := range parts {
+			if node.children == nil {
+				break
+			}
+			child, ok := node.children[part]
+			if !ok {
+				child = &treeNode{}
+				if i < len(parts)-1 {
+					child.children = make(map[string]*treeNode)
+				}
+				node.children[part] = child
+			}
+			node = child
+		}
+	}
+
+	var result strings.Builder
+	result.WriteString(".")
+	writeTree(&result, root, "", depth)
+	return result.String()
+}
+
+// writeTree writes the children of a directory, directories below depth are not expanded
+func writeTree(result *strings.Builder, node *treeNode, indent string, depth int) {
+	names := make([]string, 0, len(node.children))
+	for name := range node.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for i, name := range names {
+		child := node.children[name]
+		branch, childIndent := "├── ", "│   "
+		if i == len(names)-1 {
+			branch, childIndent = "└── ", "    "
+		}
+		if child.children != nil {
+			name += "/"
+		}
+		result.WriteString("\n" + indent + branch + name)
+
+		// SECURITY: Check the result size while building it
+		checkHelperOutput("tree", result.Len())
+
+		if child.children != nil && depth > 1 {
+			writeTree(result, child, indent+childIndent, depth-1)
+		}
+	}
+}
+
+// maxBytesOption returns the max_bytes= option of a helper, the output limit by default
+func maxBytesOption(helper string, options *raymond.Options) int {
+	value := options.HashProp("max_bytes")
+	if value == nil {
+		return maxOutputSize
+	}
+	limit, err := helperInt(value)
+	if err != nil || limit < 0 || limit > maxOutputSize {
+		panic(fmt.Errorf("%s needs max_bytes between 0 and %d, got %v", helper, maxOutputSize, value))
+	}
+	return limit
+}
+
+// matchGlob matches path segments against pattern segments, ** matches any number of segments
+func matchGlob(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	matched, err := path.Match(pattern[0], name[0])
+	return err == nil && matched && matchGlob(pattern[1:], name[1:])
+}
+
+// isBinary reports if content looks like a binary file
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), binaryCheckBytes)], 0) >= 0
+}
+
+// truncateUTF8 returns the first limit bytes of longer content without splitting a character
+func truncateUTF8(content []byte, limit int) string {
+	cut := limit
+	for cut > 0 && cut > limit-utf8.UTFMax && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	return string(content[:cut])
+}
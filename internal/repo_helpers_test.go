@@ -0,0 +1,165 @@
+package internal
+
+import (
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// fakeRepo is a repository with fixed files and diffs
+type fakeRepo struct {
+	files map[string]string
+	diffs map[string]string
+}
+
+func (r fakeRepo) Files() ([]string, error) {
+	var names []string
+	for name := range r.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (r fakeRepo) ReadFile(name string) ([]byte, error) {
+	content, ok := r.files[name]
+	if !ok {
+		return nil, fmt.Errorf("file %q: %w", name, fs.ErrNotExist)
+	}
+	return []byte(content), nil
+}
+
+func (r fakeRepo) Diff(ref string) (string, error) {
+	diff, ok := r.diffs[ref]
+	if !ok {
+		return "", fmt.Errorf("unknown revision %q", ref)
+	}
+	return diff, nil
+}
+
+func TestRepoHelpers(t *testing.T) {
+	repo := fakeRepo{
+		files: map[string]string{
+			"go.mod":                    "module example.com/app\n",
+			"README.md":                 "# App",
+			"cmd/app/main.go":           "package main\n",
+			"internal/api/api.go":       "package api\n",
+			"internal/api/api_test.go":  "package api\n",
+			"internal/store/store.go":   "package store\n",
+			"internal/store/logo.png":   "\x89PNG\x00\x00",
+			"internal/store/schema.sql": "CREATE TABLE users;\n",
+		},
+		diffs: map[string]string{"main": "diff --git a/go.mod b/go.mod\n"},
+	}
+
+	tests := []struct {
+		name        string
+		template    string
+		expected    string
+		expectError string
+	}{
+		{name: "file", template: `{{file "go.mod"}}`, expected: "module example.com/app\n"},
+		{name: "file truncated", template: `{{file "go.mod" max_bytes=6}}`, expected: "module\n[truncated to 6 bytes]"},
+		{name: "file binary", template: `{{file "internal/store/logo.png"}}`, expectError: `"internal/store/logo.png" is a binary file`},
+		{name: "file missing", template: `{{file "missing.go"}}`, expectError: "file: file \"missing.go\""},
+		{
+			name:     "files glob",
+			template: `{{files "internal/**/*.go"}}`,
+			expected: "==> internal/api/api.go <==\npackage api\n\n" +
+				"==> internal/api/api_test.go <==\npackage api\n\n" +
+				"==> internal/store/store.go <==\npackage store\n",
+		},
+		{
+			name:     "files without trailing newline",
+			template: `{{files "*.md"}}`,
+			expected: "==> README.md <==\n# App\n",
+		},
+		{
+			name:     "files max_bytes",
+			template: `{{files "internal/**" max_bytes=30}}`,
+			expected: "==> internal/api/api.go <==\npackage api\n\n" +
+				"==> internal/api/api_test.go <==\npackage api\n\n" +
+				"==> 2 more files left out, max_bytes 30 reached <==",
+		},
+		{name: "files no match", template: `[{{files "*.rs"}}]`, expected: "[]"},
+		{name: "files invalid pattern", template: `{{files "[a"}}`, expectError: `invalid pattern "[a"`},
+		{name: "files invalid max_bytes", template: `{{files "*" max_bytes=-1}}`, expectError: "files needs max_bytes between 0 and"},
+		{name: "git_diff", template: `{{git_diff "main"}}`, expected: "diff --git a/go.mod b/go.mod\n"},
+		{name: "git_diff unknown ref", template: `{{git_diff "nope"}}`, expectError: `git_diff: unknown revision "nope"`},
+		{
+			name:     "tree",
+			template: `{{tree depth=2}}`,
+			expected: ".\n├── README.md\n├── cmd/\n│   └── app/\n├── go.mod\n└── internal/\n    ├── api/\n    └── store/",
+		},
+		{
+			name:     "tree default depth",
+			template: `{{tree}}`,
+			expected: ".\n├── README.md\n├── cmd/\n│   └── app/\n│       └── main.go\n├── go.mod\n└── internal/\n" +
+				"    ├── api/\n    │   ├── api.go\n    │   └── api_test.go\n" +
+				"    └── store/\n        ├── logo.png\n        ├── schema.sql\n        └── store.go",
+		},
+		{name: "tree invalid depth", template: `{{tree depth=0}}`, expectError: "tree needs a depth of at least 1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateWithOptions(tt.template, nil, RenderOptions{Repo: repo})
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRepoHelpersWithoutRepo(t *testing.T) {
+	for _, template := range []string{`{{file "go.mod"}}`, `{{files "*.go"}}`, `{{git_diff "main"}}`, `{{tree}}`} {
+		_, err := RenderTemplateWithOptions(template, nil, RenderOptions{})
+		if err == nil || !strings.Contains(err.Error(), "needs a git repository") {
+			t.Errorf("Expected %s to need a git repository, got %v", template, err)
+		}
+	}
+}
+
+func TestRepoHelpersAreNotVariables(t *testing.T) {
+	references, err := TemplateReferences(`{{tree}} {{file path}}`)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(references) != 1 || references[0].Name != "path" {
+		t.Errorf("Expected only the path variable, got %v", references)
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/app/main.go", true},
+		{"internal/**", "internal/api/api.go", true},
+		{"internal/**/*_test.go", "internal/api/api.go", false},
+		{"internal/**/api/*.go", "internal/api/api.go", true},
+		{"docs/*.md", "internal/docs/a.md", false},
+	}
+
+	for _, tt := range tests {
+		if result := matchGlob(strings.Split(tt.pattern, "/"), strings.Split(tt.name, "/")); result != tt.expected {
+			t.Errorf("matchGlob(%q, %q) = %v, expected %v", tt.pattern, tt.name, result, tt.expected)
+		}
+	}
+}
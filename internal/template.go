@@ -2,6 +2,7 @@ package internal
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -23,115 +24,258 @@ func RegisterHelpers() {
 	}
 
 	// Register helpful custom helpers
-	raymond.RegisterHelper("split", func(str string, separator string) []string {
-		if str == "" {
-			return []string{}
-		}
-		parts := strings.Split(str, separator)
-		var result []string
-		for _, part := range parts {
-			if trimmed := strings.TrimSpace(part); trimmed != "" {
-				result = append(result, trimmed)
-			}
-		}
-		return result
-	})
+	raymond.RegisterHelpers(customHelpers)
 
 	helpersRegistered = true
 }
 
 // RenderTemplate renders a Handlebars template with the given variables with security controls
 func RenderTemplate(template string, values map[string]string) (string, error) {
+	data := make(map[string]interface{}, len(values))
+	for key, value := range values {
+		data[key] = value
+	}
+	return RenderTemplateData(template, data)
+}
+
+// RenderOptions are the options for rendering a template
+type RenderOptions struct {
+	// Escape is the escape mode for the output of {{value}}, empty is none
+	Escape string
+	// Partials are the partials the template can use with {{> name}}, they are registered for this template only
+	Partials map[string]string
+	// Repo is the repository the repo helpers like {{file "go.mod"}} read, without one they fail
+	Repo Repo
+	// Exec runs the commands of {{exec "go list ./..."}}, without it exec fails
+	Exec Exec
+}
+
+// RenderTemplateData renders a Handlebars template with typed values: strings, bools, numbers and nested lists and maps
+func RenderTemplateData(template string, values map[string]interface{}) (string, error) {
+	return RenderTemplateWithOptions(template, values, RenderOptions{})
+}
+
+// RenderTemplateWithOptions renders a Handlebars template with typed values and the given options
+func RenderTemplateWithOptions(template string, values map[string]interface{}, opts RenderOptions) (string, error) {
 	// SECURITY: Validate template before rendering
-	if err := validateTemplate(template); err != nil {
+	if err := validateTemplate(template, opts.Partials); err != nil {
 		return "", fmt.Errorf("template security validation failed: %w", err)
 	}
+	if err := ValidateEscapeMode(opts.Escape); err != nil {
+		return "", err
+	}
 
 	// SECURITY: Sanitize template values
 	sanitizedValues := sanitizeTemplateValues(values)
 
 	RegisterHelpers()
 
-	result, err := raymond.Render(template, sanitizedValues)
+	tpl, err := raymond.Parse(applyEscapeMode(template, opts.Escape))
+	if err != nil {
+		return "", fmt.Errorf("error rendering template: %w", err)
+	}
+	for name, partial := range opts.Partials {
+		tpl.RegisterPartial(name, applyEscapeMode(partial, opts.Escape))
+	}
+	tpl.RegisterHelpers(repoHelpers(opts.Repo))
+	tpl.RegisterHelper(execHelperName, execHelper(opts.Exec))
+
+	result, err := tpl.Exec(sanitizedValues)
 	if err != nil {
 		return "", fmt.Errorf("error rendering template: %w", err)
 	}
 
 	// SECURITY: Validate output size to prevent memory exhaustion
-	if len(result) > 10*1024*1024 { // 10MB limit
+	if len(result) > maxOutputSize {
 		return "", fmt.Errorf("template output too large (%d bytes), possible DoS attempt", len(result))
 	}
 
 	return result, nil
 }
 
-// validateTemplate performs security validation on template content
-func validateTemplate(template string) error {
+// maxTemplateNesting is the maximum nesting of blocks and subexpressions in a template
+const maxTemplateNesting = 50
+
+// validateTemplate performs security validation on template content and its partials
+func validateTemplate(template string, partials map[string]string) error {
+	inspection, err := checkTemplate(template)
+	if err != nil || inspection == nil {
+		return err
+	}
+
+	// SECURITY: Only partials shipped with the template can be used
+	for _, partial := range inspection.partials {
+		if _, ok := partials[partial.Name]; !ok {
+			return fmt.Errorf("template uses partial %q, which is not part of the prompt", partial.Name)
+		}
+	}
+
+	return validatePartials(partials)
+}
+
+// checkTemplate checks the size, nesting and dangerous patterns of a template and returns its inspection,
+// nil for templates that don't parse
+func checkTemplate(template string) (*templateInspection, error) {
 	// SECURITY: Check template size to prevent memory exhaustion
 	if len(template) > 1024*1024 { // 1MB limit
-		return fmt.Errorf("template too large (%d bytes), maximum allowed is 1MB", len(template))
+		return nil, fmt.Errorf("template too large (%d bytes), maximum allowed is 1MB", len(template))
 	}
 
-	// SECURITY: Check for deeply nested constructs that could cause DoS
-	nestedLevel := 0
-	maxNested := 50 // Reasonable limit
-
-	for i := 0; i < len(template); i++ {
-		// Ensure we have enough characters left for the pattern
-		if i+2 < len(template) && template[i:i+3] == "{{#" {
-			nestedLevel++
-			if nestedLevel > maxNested {
-				return fmt.Errorf("template has too many nested constructs (%d), maximum allowed is %d",
-					nestedLevel, maxNested)
-			}
-		} else if i+2 < len(template) && template[i:i+3] == "{{/" {
-			// Prevent negative nesting levels
-			if nestedLevel > 0 {
-				nestedLevel--
-			}
-		}
+	program, err := parseTemplate(template)
+	if err != nil {
+		// Parse errors are reported by rendering
+		return nil, nil
 	}
+	inspection := inspectTemplate(template, program)
 
-	// SECURITY: Block dangerous helpers and patterns
-	dangerousPatterns := []string{
-		"{{>",         // Block partials
-		"constructor", // Block constructor access
-		"__proto__",   // Block prototype access
-		"prototype",   // Block prototype access
-		"toString",    // Block toString access (potential info leak)
+	// SECURITY: Check for deeply nested constructs that could cause DoS
+	if inspection.nesting > maxTemplateNesting {
+		return nil, fmt.Errorf("template has too many nested constructs (%d), maximum allowed is %d",
+			inspection.nesting, maxTemplateNesting)
 	}
 
-	for _, pattern := range dangerousPatterns {
-		if strings.Contains(template, pattern) {
-			return fmt.Errorf("template contains dangerous pattern: %q", pattern)
-		}
+	// SECURITY: Block dangerous helpers and patterns
+	if len(inspection.issues) > 0 {
+		return nil, fmt.Errorf("template contains dangerous pattern: %q", inspection.issues[0].Pattern)
 	}
 
-	return nil
+	return inspection, nil
 }
 
+// Limits for structured template values
+const (
+	maxValueDepth = 10               // nesting of lists and maps
+	maxValueItems = 1000             // items per list or map
+	maxValueNodes = 10000            // values in total
+	maxValueBytes = 10 * 1024 * 1024 // string bytes in total
+)
+
 // sanitizeTemplateValues sanitizes user input values to prevent injection
-func sanitizeTemplateValues(values map[string]string) map[string]string {
-	sanitized := make(map[string]string)
+func sanitizeTemplateValues(values map[string]interface{}) map[string]interface{} {
+	sanitizer := &valueSanitizer{}
+	sanitized := make(map[string]interface{})
 
-	for key, value := range values {
+	for _, key := range sortedKeys(values) {
 		// SECURITY: Validate variable names
 		if !isValidVariableName(key) {
 			continue // Skip dangerous variable names
 		}
 
-		// SECURITY: Limit value size
-		if len(value) > 100*1024 { // 100KB per value
-			value = value[:100*1024] + "...[truncated]"
+		if sanitizedValue, ok := sanitizer.sanitize(values[key], 0); ok {
+			sanitized[key] = sanitizedValue
 		}
+	}
 
-		// SECURITY: Remove or escape potentially dangerous characters
-		value = sanitizeValue(value)
+	return sanitized
+}
+
+// valueSanitizer sanitizes values recursively and keeps track of the total size
+type valueSanitizer struct {
+	nodes int
+	bytes int
+}
 
-		sanitized[key] = value
+// sanitize sanitizes scalars, lists and maps, unsupported types and values beyond the limits are dropped
+func (s *valueSanitizer) sanitize(value interface{}, depth int) (interface{}, bool) {
+	// SECURITY: Limit the total size and nesting of values
+	if s.nodes >= maxValueNodes || depth > maxValueDepth {
+		return nil, false
 	}
+	s.nodes++
 
-	return sanitized
+	switch v := value.(type) {
+	case string:
+		sanitized := sanitizeString(v)
+		if s.bytes+len(sanitized) > maxValueBytes {
+			return nil, false
+		}
+		s.bytes += len(sanitized)
+		return sanitized, true
+	case bool, int, int64, uint64, float64:
+		return v, true
+	case []string:
+		items := make([]interface{}, len(v))
+		for i, item := range v {
+			items[i] = item
+		}
+		return s.sanitizeList(items, depth), true
+	case []interface{}:
+		return s.sanitizeList(v, depth), true
+	case map[string]string:
+		items := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			items[key] = item
+		}
+		return s.sanitizeMap(items, depth), true
+	case map[string]interface{}:
+		return s.sanitizeMap(v, depth), true
+	case map[interface{}]interface{}:
+		items := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			if name, ok := key.(string); ok {
+				items[name] = item
+			}
+		}
+		return s.sanitizeMap(items, depth), true
+	default:
+		return nil, false
+	}
+}
+
+// sanitizeList sanitizes the items of a list
+func (s *valueSanitizer) sanitizeList(items []interface{}, depth int) []interface{} {
+	// SECURITY: Limit list length
+	if len(items) > maxValueItems {
+		items = items[:maxValueItems]
+	}
+
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if sanitized, ok := s.sanitize(item, depth+1); ok {
+			result = append(result, sanitized)
+		}
+	}
+	return result
+}
+
+// sanitizeMap sanitizes the values of a map, keys must be valid variable names
+func (s *valueSanitizer) sanitizeMap(items map[string]interface{}, depth int) map[string]interface{} {
+	result := make(map[string]interface{})
+	for _, key := range sortedKeys(items) {
+		// SECURITY: Limit map size
+		if len(result) >= maxValueItems {
+			break
+		}
+		// SECURITY: Keys become template paths like {{owner.name}}
+		if !isValidVariableName(key) {
+			continue
+		}
+		if sanitized, ok := s.sanitize(items[key], depth+1); ok {
+			result[key] = sanitized
+		}
+	}
+	return result
+}
+
+// sortedKeys returns the keys of a map in order, so limits drop the same values every time
+func sortedKeys(values map[string]interface{}) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sanitizeString limits the size of a string value and removes dangerous characters
+func sanitizeString(value string) string {
+	// SECURITY: Limit value size
+	if len(value) > 100*1024 { // 100KB per value
+		value = value[:100*1024] + "...[truncated]"
+	}
+
+	// SECURITY: Remove or escape potentially dangerous characters
+	return sanitizeValue(value)
 }
 
 // isValidVariableName checks if a variable name is safe
@@ -141,14 +285,8 @@ func isValidVariableName(name string) bool {
 	}
 
 	// SECURITY: Block dangerous variable names
-	dangerousNames := []string{
-		"__proto__", "constructor", "prototype", "toString", "valueOf",
-	}
-
-	for _, dangerous := range dangerousNames {
-		if name == dangerous {
-			return false
-		}
+	if dangerousNames[name] {
+		return false
 	}
 
 	// SECURITY: Only allow alphanumeric, underscore, and hyphen
@@ -0,0 +1,502 @@
+package internal
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aymerick/raymond/ast"
+	"github.com/aymerick/raymond/parser"
+)
+
+// builtinHelpers are the helpers raymond registers by default
+var builtinHelpers = []string{"if", "unless", "with", "each", "log", "lookup", "equal"}
+
+// Position is a 1-based line and column in a template
+type Position struct {
+	Line   int
+	Column int
+}
+
+// TemplateReference is a root variable referenced by a template
+type TemplateReference struct {
+	Name string
+	// Guarded references don't render a missing value, e.g. conditions, {{default name "x"}}
+	// or {{name}} inside {{#if name}}
+	Guarded bool
+	Position
+}
+
+// conditionHelpers only test their parameters, a missing value is false
+var conditionHelpers = map[string]bool{
+	"if": true, "unless": true, "and": true, "or": true, "not": true, "eq": true, "ne": true,
+}
+
+// fallbackHelpers handle a missing first parameter, with renders its inverse and default its fallback
+var fallbackHelpers = map[string]bool{"with": true, "default": true}
+
+// TemplateError is a template parse error with the position it occurred at
+type TemplateError struct {
+	Message string
+	Position
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+var parseErrorLineRegex = regexp.MustCompile(`^Parse error on line (\d+):\n`)
+
+// parseTemplate parses a template into its AST, parse errors are returned as *TemplateError
+func parseTemplate(template string) (*ast.Program, error) {
+	program, err := parser.Parse(template)
+	if err != nil {
+		message := err.Error()
+		line := 1
+		if matches := parseErrorLineRegex.FindStringSubmatch(message); matches != nil {
+			line, _ = strconv.Atoi(matches[1])
+			message = message[len(matches[0]):]
+		}
+		// Only keep the first line, the following lines contain token debug output
+		message = strings.SplitN(message, "\n", 2)[0]
+		return nil, &TemplateError{Message: message, Position: Position{Line: line, Column: 1}}
+	}
+	return program, nil
+}
+
+// IsHelperName returns true if name is a helper available in templates
+func IsHelperName(name string) bool {
+	for _, helper := range builtinHelpers {
+		if name == helper {
+			return true
+		}
+	}
+	if name == execHelperName {
+		return true
+	}
+	for _, helper := range repoHelperNames {
+		if name == helper {
+			return true
+		}
+	}
+	_, ok := customHelpers[name]
+	return ok
+}
+
+// TemplateReferences returns the root variables referenced by a template in order of appearance.
+// Helper names and paths relative to each/with block contexts are not references
+func TemplateReferences(template string) ([]TemplateReference, error) {
+	return TemplateReferencesWithPartials(template, nil)
+}
+
+// TemplateReferencesWithPartials returns the root variables referenced by a template and the partials it uses.
+// References in a partial are reported at the position the template uses it
+func TemplateReferencesWithPartials(template string, partials map[string]string) ([]TemplateReference, error) {
+	program, err := parseTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	collector := &referenceCollector{template: template, guards: make(map[string]int), partials: make(map[string]*ast.Program)}
+	for name, partial := range partials {
+		// Partials that don't parse are reported by validation
+		if partialProgram, err := parseTemplate(partial); err == nil {
+			collector.partials[name] = partialProgram
+		}
+	}
+	collector.program(program, 0, nil)
+	return collector.references, nil
+}
+
+// MissingReferences returns the first unguarded reference of each root variable that has no value
+func MissingReferences(template string, partials map[string]string, values map[string]interface{}) ([]TemplateReference, error) {
+	references, err := TemplateReferencesWithPartials(template, partials)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []TemplateReference
+	reported := make(map[string]bool)
+	for _, reference := range references {
+		if _, ok := values[reference.Name]; ok || reference.Guarded || reported[reference.Name] {
+			continue
+		}
+		missing = append(missing, reference)
+		reported[reference.Name] = true
+	}
+	return missing, nil
+}
+
+// referenceCollector walks a template AST and collects root variable references
+type referenceCollector struct {
+	template   string
+	references []TemplateReference
+	// guards counts the enclosing blocks that only render when a root variable has a value
+	guards map[string]int
+	// partials are the parsed partials of the template
+	partials map[string]*ast.Program
+	// at is the position of the partial use while collecting the references of a partial
+	at *Position
+}
+
+// program walks the statements of a program. contextDepth counts the nested blocks
+// that changed the context (each/with), blockParams are the names of block parameters in scope
+func (c *referenceCollector) program(program *ast.Program, contextDepth int, blockParams []string) {
+	if program == nil {
+		return
+	}
+	blockParams = append(append([]string{}, blockParams...), program.BlockParams...)
+	for _, node := range program.Body {
+		switch statement := node.(type) {
+		case *ast.MustacheStatement:
+			c.expression(statement.Expression, contextDepth, blockParams)
+		case *ast.BlockStatement:
+			c.expression(statement.Expression, contextDepth, blockParams)
+			bodyDepth := contextDepth
+			helper := statement.Expression.HelperName()
+			switch helper {
+			case "each", "with":
+				bodyDepth++
+			}
+			guard := c.guardName(statement.Expression, contextDepth, blockParams)
+			c.guarded(guard, helper == "if" || helper == "with", func() {
+				c.program(statement.Program, bodyDepth, blockParams)
+			})
+			c.guarded(guard, helper == "unless", func() {
+				c.program(statement.Inverse, contextDepth, blockParams)
+			})
+		case *ast.PartialStatement:
+			for _, param := range statement.Params {
+				c.node(param, contextDepth, blockParams)
+			}
+			c.hash(statement.Hash, contextDepth, blockParams)
+			c.partial(statement, contextDepth, blockParams)
+		}
+	}
+}
+
+// partial collects the references of a partial the template uses. A partial with a parameter or a hash
+// renders in a context of its own. Partials can't use partials, their partial statements are skipped
+func (c *referenceCollector) partial(statement *ast.PartialStatement, contextDepth int, blockParams []string) {
+	name, ok := ast.HelperNameStr(statement.Name)
+	program := c.partials[name]
+	if !ok || program == nil || c.at != nil {
+		return
+	}
+	if len(statement.Params) > 0 || statement.Hash != nil {
+		contextDepth++
+	}
+
+	at := positionAt(c.template, statement.Location().Pos)
+	c.at = &at
+	c.program(program, contextDepth, blockParams)
+	c.at = nil
+}
+
+// expression collects references from a helper call or a plain path
+func (c *referenceCollector) expression(expression *ast.Expression, contextDepth int, blockParams []string) {
+	if expression == nil {
+		return
+	}
+
+	isHelperCall := len(expression.Params) > 0 || expression.Hash != nil || IsHelperName(expression.HelperName())
+	if !isHelperCall {
+		c.node(expression.Path, contextDepth, blockParams)
+	}
+
+	helper := expression.HelperName()
+	for i, param := range expression.Params {
+		collected := len(c.references)
+		c.node(param, contextDepth, blockParams)
+		if conditionHelpers[helper] || (i == 0 && fallbackHelpers[helper]) {
+			for j := collected; j < len(c.references); j++ {
+				c.references[j].Guarded = true
+			}
+		}
+	}
+	c.hash(expression.Hash, contextDepth, blockParams)
+}
+
+// guardName returns the root variable a block tests, e.g. name for {{#if name}}, empty for other conditions
+func (c *referenceCollector) guardName(expression *ast.Expression, contextDepth int, blockParams []string) string {
+	if len(expression.Params) != 1 {
+		return ""
+	}
+	path, ok := expression.Params[0].(*ast.PathExpression)
+	if !ok || len(path.Parts) != 1 {
+		return ""
+	}
+	name, _ := rootPathName(path, contextDepth, blockParams)
+	return name
+}
+
+// guarded walks a part of a block, if active with references to name guarded
+func (c *referenceCollector) guarded(name string, active bool, walk func()) {
+	if name == "" || !active {
+		walk()
+		return
+	}
+	c.guards[name]++
+	walk()
+	c.guards[name]--
+}
+
+// hash collects references from hash arguments
+func (c *referenceCollector) hash(hash *ast.Hash, contextDepth int, blockParams []string) {
+	if hash == nil {
+		return
+	}
+	for _, pair := range hash.Pairs {
+		c.node(pair.Val, contextDepth, blockParams)
+	}
+}
+
+// node collects references from a parameter node
+func (c *referenceCollector) node(node ast.Node, contextDepth int, blockParams []string) {
+	switch n := node.(type) {
+	case *ast.SubExpression:
+		c.expression(n.Expression, contextDepth, blockParams)
+	case *ast.Expression:
+		c.expression(n, contextDepth, blockParams)
+	case *ast.PathExpression:
+		if name, ok := rootPathName(n, contextDepth, blockParams); ok {
+			position := c.at
+			if position == nil {
+				at := positionAt(c.template, n.Location().Pos)
+				position = &at
+			}
+			c.references = append(c.references, TemplateReference{
+				Name:     name,
+				Guarded:  c.guards[name] > 0,
+				Position: *position,
+			})
+		}
+	}
+}
+
+// rootPathName returns the root variable a path refers to, if it refers to the root context
+func rootPathName(path *ast.PathExpression, contextDepth int, blockParams []string) (string, bool) {
+	if len(path.Parts) == 0 {
+		return "", false
+	}
+
+	if path.Data {
+		// @root.name refers to the root context, other data variables (@index, @key) are not references
+		if path.IsDataRoot() && len(path.Parts) > 1 {
+			return path.Parts[1], true
+		}
+		return "", false
+	}
+
+	// this.name and ./name refer to the current context
+	if path.Depth == 0 && path.Scoped && contextDepth > 0 {
+		return "", false
+	}
+
+	if path.Depth < contextDepth {
+		return "", false
+	}
+
+	if path.Depth == 0 {
+		for _, param := range blockParams {
+			if path.Parts[0] == param {
+				return "", false
+			}
+		}
+	}
+
+	return path.Parts[0], true
+}
+
+// positionAt converts a byte offset in text into a line and column
+func positionAt(text string, offset int) Position {
+	if offset > len(text) {
+		offset = len(text)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := 1 + strings.Count(text[:offset], "\n")
+	column := offset - strings.LastIndex(text[:offset], "\n")
+	return Position{Line: line, Column: column}
+}
+
+// dangerousNames can't be identifiers in templates or variable names, in JavaScript they reach object internals
+var dangerousNames = map[string]bool{
+	"__proto__": true, "constructor": true, "prototype": true, "toString": true, "valueOf": true,
+}
+
+// partialPattern is the pattern reported for partials with computed names, only partials the prompt ships can be used
+const partialPattern = "{{>"
+
+// TemplateIssue is a dangerous pattern found in a template
+type TemplateIssue struct {
+	Pattern string
+	Position
+}
+
+// TemplatePartial is a partial used by name in a template
+type TemplatePartial struct {
+	Name string
+	Position
+}
+
+// FindDangerousPatterns returns the dangerous identifiers, the partials with computed names and the exec calls with
+// computed commands in the expressions of a template with their positions. Text outside of expressions is not checked,
+// so prose can mention a constructor
+func FindDangerousPatterns(template string) []TemplateIssue {
+	program, err := parseTemplate(template)
+	if err != nil {
+		return nil
+	}
+	return inspectTemplate(template, program).issues
+}
+
+// FindPartials returns the partials a template uses by name in order of appearance
+func FindPartials(template string) []TemplatePartial {
+	program, err := parseTemplate(template)
+	if err != nil {
+		return nil
+	}
+	return inspectTemplate(template, program).partials
+}
+
+// templateInspection is the result of inspecting a template AST
+type templateInspection struct {
+	template string
+	issues   []TemplateIssue
+	partials []TemplatePartial
+	commands []TemplateCommand
+	// nesting is the deepest nesting of blocks and subexpressions
+	nesting int
+}
+
+// inspectTemplate walks a template AST for dangerous patterns and its nesting
+func inspectTemplate(template string, program *ast.Program) *templateInspection {
+	inspection := &templateInspection{template: template}
+	inspection.program(program, 0)
+	return inspection
+}
+
+// program inspects the statements of a program nested in depth blocks
+func (i *templateInspection) program(program *ast.Program, depth int) {
+	if program == nil {
+		return
+	}
+	for _, name := range program.BlockParams {
+		i.identifier(name, program)
+	}
+	for _, node := range program.Body {
+		switch statement := node.(type) {
+		case *ast.MustacheStatement:
+			i.expression(statement.Expression, depth)
+		case *ast.BlockStatement:
+			// {{else if}} continues the enclosing block
+			blockDepth := depth + 1
+			if program.Chained {
+				blockDepth = depth
+			}
+			i.nested(blockDepth)
+			i.expression(statement.Expression, blockDepth)
+			i.program(statement.Program, blockDepth)
+			i.program(statement.Inverse, blockDepth)
+		case *ast.PartialStatement:
+			i.partial(statement, depth)
+		}
+	}
+}
+
+// expression inspects the helper or path of an expression and its parameters
+func (i *templateInspection) expression(expression *ast.Expression, depth int) {
+	if expression == nil {
+		return
+	}
+	i.node(expression.Path, depth)
+	if expression.HelperName() == execHelperName {
+		i.command(expression)
+	}
+	for _, param := range expression.Params {
+		i.node(param, depth)
+		// lookup reads the field named by a string
+		if literal, ok := param.(*ast.StringLiteral); ok && expression.HelperName() == "lookup" {
+			i.identifier(literal.Value, literal)
+		}
+	}
+	i.hash(expression.Hash, depth)
+}
+
+// partial records a partial used by name and inspects its parameters
+func (i *templateInspection) partial(statement *ast.PartialStatement, depth int) {
+	name, ok := ast.HelperNameStr(statement.Name)
+	if !ok {
+		i.issue(partialPattern, statement)
+		return
+	}
+	i.partials = append(i.partials, TemplatePartial{Name: name, Position: positionAt(i.template, statement.Location().Pos)})
+	for _, param := range statement.Params {
+		i.node(param, depth)
+	}
+	i.hash(statement.Hash, depth)
+}
+
+// command records the command of an exec call, computed commands are reported
+func (i *templateInspection) command(expression *ast.Expression) {
+	if len(expression.Params) == 0 {
+		return
+	}
+	literal, ok := expression.Params[0].(*ast.StringLiteral)
+	if !ok {
+		i.issue(execPattern, expression)
+		return
+	}
+	i.commands = append(i.commands, TemplateCommand{Command: literal.Value, Position: positionAt(i.template, expression.Location().Pos)})
+}
+
+// hash inspects the keys and values of hash arguments
+func (i *templateInspection) hash(hash *ast.Hash, depth int) {
+	if hash == nil {
+		return
+	}
+	for _, pair := range hash.Pairs {
+		i.identifier(pair.Key, pair)
+		i.node(pair.Val, depth)
+	}
+}
+
+// node inspects a path or a subexpression
+func (i *templateInspection) node(node ast.Node, depth int) {
+	switch n := node.(type) {
+	case *ast.SubExpression:
+		i.nested(depth + 1)
+		i.expression(n.Expression, depth+1)
+	case *ast.Expression:
+		i.expression(n, depth)
+	case *ast.PathExpression:
+		for _, part := range n.Parts {
+			i.identifier(part, n)
+		}
+	}
+}
+
+// identifier reports a dangerous identifier
+func (i *templateInspection) identifier(name string, node ast.Node) {
+	if dangerousNames[name] {
+		i.issue(name, node)
+	}
+}
+
+// issue reports a dangerous pattern at a node
+func (i *templateInspection) issue(pattern string, node ast.Node) {
+	i.issues = append(i.issues, TemplateIssue{
+		Pattern:  pattern,
+		Position: positionAt(i.template, node.Location().Pos),
+	})
+}
+
+// nested records the nesting depth
+func (i *templateInspection) nested(depth int) {
+	if depth > i.nesting {
+		i.nesting = depth
+	}
+}
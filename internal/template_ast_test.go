@@ -0,0 +1,157 @@
+package internal
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTemplateReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		expected []string
+	}{
+		{
+			name:     "simple variables",
+			template: "Hello {{name}}, {{{greeting}}}",
+			expected: []string{"name", "greeting"},
+		},
+		{
+			name:     "helpers are not references",
+			template: "{{#if show}}{{#unless hide}}x{{/unless}}{{/if}}",
+			expected: []string{"show", "hide"},
+		},
+		{
+			name:     "each body is relative to item",
+			template: "{{#each (split items \",\")}}{{this}} {{name}} {{../prefix}} {{@index}}{{/each}}",
+			expected: []string{"items", "prefix"},
+		},
+		{
+			name:     "block params",
+			template: "{{#each list as |entry|}}{{entry}} {{@root.title}}{{/each}}",
+			expected: []string{"list", "title"},
+		},
+		{
+			name:     "dotted paths reference the root name",
+			template: "{{config.name}}",
+			expected: []string{"config"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			references, err := TemplateReferences(tt.template)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var names []string
+			for _, reference := range references {
+				names = append(names, reference.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected references %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestTemplateReferencesPosition(t *testing.T) {
+	references, err := TemplateReferences("first\nsecond {{name}}")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(references) != 1 || references[0].Position != (Position{Line: 2, Column: 10}) {
+		t.Errorf("Unexpected references: %+v", references)
+	}
+}
+
+func TestTemplateReferencesParseError(t *testing.T) {
+	_, err := TemplateReferences("line one\nline two\n{{#if x}}unclosed")
+
+	var templateErr *TemplateError
+	if !errors.As(err, &templateErr) {
+		t.Fatalf("Expected *TemplateError, got %v", err)
+	}
+	if templateErr.Line < 3 {
+		t.Errorf("Expected error on line 3 or later, got line %d", templateErr.Line)
+	}
+}
+
+func TestMissingReferences(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected []string
+	}{
+		{
+			name:     "all values present",
+			template: "Write hello world in {{language}}.",
+			values:   map[string]interface{}{"language": "Go"},
+			expected: nil,
+		},
+		{
+			name:     "missing values are reported once",
+			template: "Write {{language}} for {{audience}}, in {{language}}.",
+			values:   map[string]interface{}{},
+			expected: []string{"language", "audience"},
+		},
+		{
+			name:     "empty values are present",
+			template: "Hello {{name}}!",
+			values:   map[string]interface{}{"name": ""},
+			expected: nil,
+		},
+		{
+			name:     "conditions are guarded",
+			template: "{{#if docs}}docs{{/if}}{{#unless legacy}}modern{{/unless}}{{#if (and a (not b))}}x{{/if}}",
+			values:   map[string]interface{}{},
+			expected: nil,
+		},
+		{
+			name:     "values inside their own condition are guarded",
+			template: "{{#if name}}Hello {{name}}{{else}}{{name}}{{/if}}{{#unless path}}none{{else}}{{path}}{{/unless}}",
+			values:   map[string]interface{}{},
+			expected: []string{"name"},
+		},
+		{
+			name:     "default handles its first parameter",
+			template: "{{default branch \"main\"}} {{default other branch}}",
+			values:   map[string]interface{}{},
+			expected: []string{"branch"},
+		},
+		{
+			name:     "each body is relative to item",
+			template: "{{#each services}}{{name}}{{/each}}",
+			values:   map[string]interface{}{"services": []string{}},
+			expected: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			missing, err := MissingReferences(tt.template, nil, tt.values)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			var names []string
+			for _, reference := range missing {
+				names = append(names, reference.Name)
+			}
+			if !reflect.DeepEqual(names, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, names)
+			}
+		})
+	}
+}
+
+func TestFindDangerousPatterns(t *testing.T) {
+	issues := FindDangerousPatterns("safe\nuse {{constructor}}")
+	if len(issues) == 0 {
+		t.Fatal("Expected dangerous pattern to be found")
+	}
+	if issues[0].Line != 2 || issues[0].Column != 7 {
+		t.Errorf("Expected issue at 2:7, got %d:%d", issues[0].Line, issues[0].Column)
+	}
+}
@@ -1,6 +1,7 @@
 package internal
 
 import (
+	"fmt"
 	"strings"
 	"testing"
 )
@@ -182,6 +183,56 @@ func TestRenderTemplateSecurityIssues(t *testing.T) {
 	}
 }
 
+func TestValidateTemplate(t *testing.T) {
+	tests := []struct {
+		name        string
+		template    string
+		expectError string
+	}{
+		{name: "prose mentions dangerous words", template: "Refactor the constructor, keep the prototype and toString of {{name}}."},
+		{name: "comments are prose", template: "{{! call the constructor }}{{name}}"},
+		{name: "string literals are values", template: `{{#if (eq kind "constructor")}}x{{/if}}`},
+		{name: "path part", template: "{{this.constructor}}", expectError: `"constructor"`},
+		{name: "root data path", template: "{{@root.__proto__}}", expectError: `"__proto__"`},
+		{name: "helper name", template: "{{toString name}}", expectError: `"toString"`},
+		{name: "subexpression parameter", template: "{{upper (lower prototype)}}", expectError: `"prototype"`},
+		{name: "hash key", template: `{{date "date" valueOf=1}}`, expectError: `"valueOf"`},
+		{name: "block param", template: "{{#each items as |constructor|}}x{{/each}}", expectError: `"constructor"`},
+		{name: "lookup field", template: `{{lookup owner "__proto__"}}`, expectError: `"__proto__"`},
+		{name: "partial", template: "{{> header}}", expectError: `partial "header", which is not part of the prompt`},
+		{name: "computed partial", template: `{{> (lookup . "name")}}`, expectError: `"{{>"`},
+		{
+			name:     "else if chains are not nested",
+			template: "{{#if a}}a" + strings.Repeat("{{else if b}}b", 60) + "{{/if}}",
+		},
+		{
+			name:        "nested blocks",
+			template:    strings.Repeat("{{#if a}}", 51) + strings.Repeat("{{/if}}", 51),
+			expectError: "too many nested constructs (51)",
+		},
+		{
+			name:        "nested subexpressions",
+			template:    "{{not " + strings.Repeat("(not ", 51) + "a" + strings.Repeat(")", 51) + "}}",
+			expectError: "too many nested constructs (51)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTemplate(tt.template, nil)
+			if tt.expectError == "" {
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+				t.Errorf("Expected error containing %q, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
 // TestSplitHelperEdgeCases tests edge cases for the split helper
 func TestSplitHelperEdgeCases(t *testing.T) {
 	tests := []struct {
@@ -234,3 +285,124 @@ func TestSplitHelperEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+func TestRenderTemplateData(t *testing.T) {
+	values := map[string]interface{}{
+		"enabled": false,
+		"count":   3,
+		"modules": []string{"api", "web\x00"},
+		"owner":   map[string]string{"name": "Jane"},
+	}
+
+	result, err := RenderTemplateData("{{#if enabled}}on{{else}}off{{/if}} {{count}}{{#each modules}} {{this}}{{/each}} {{owner.name}}", values)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := "off 3 api web Jane"
+	if result != expected {
+		t.Errorf("Expected %q, got %q", expected, result)
+	}
+}
+
+func TestRenderTemplateDataStructured(t *testing.T) {
+	services := []interface{}{
+		map[string]interface{}{"name": "api", "owners": []interface{}{"jane", "joe"}},
+		map[interface{}]interface{}{"name": "web", "owners": []interface{}{"ann"}, 1: "dropped"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		values   map[string]interface{}
+		expected string
+	}{
+		{
+			name:     "list of maps",
+			template: "{{#each services}}{{name}}:{{#each owners}} {{this}}{{/each}};{{/each}}",
+			values:   map[string]interface{}{"services": services},
+			expected: "api: jane joe;web: ann;",
+		},
+		{
+			name:     "nested maps",
+			template: "{{team.lead.name}} {{team.lead.email}}",
+			values: map[string]interface{}{
+				"team": map[string]interface{}{"lead": map[string]interface{}{"name": "Jane\x00", "email": "jane@example.com"}},
+			},
+			expected: "Jane jane@example.com",
+		},
+		{
+			name:     "invalid keys are dropped",
+			template: "{{#each owner}}{{@key}}={{this}} {{/each}}",
+			values:   map[string]interface{}{"owner": map[string]interface{}{"name": "Jane", "__proto__": "x", "bad key": "y"}},
+			expected: "name=Jane ",
+		},
+		{
+			name:     "unsupported types are dropped",
+			template: "{{#each items}}{{this}} {{/each}}",
+			values:   map[string]interface{}{"items": []interface{}{"a", struct{}{}, 2}},
+			expected: "a 2 ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RenderTemplateData(tt.template, tt.values)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestSanitizeTemplateValuesLimits(t *testing.T) {
+	// Nesting deeper than the limit is dropped
+	var deep interface{} = "bottom"
+	for i := 0; i < maxValueDepth+5; i++ {
+		deep = []interface{}{deep}
+	}
+	sanitized := sanitizeTemplateValues(map[string]interface{}{"deep": deep})
+	depth := 0
+	for value := sanitized["deep"]; ; depth++ {
+		list, ok := value.([]interface{})
+		if !ok || len(list) == 0 {
+			break
+		}
+		value = list[0]
+	}
+	if depth != maxValueDepth {
+		t.Errorf("Expected nesting limited to %d, got %d", maxValueDepth, depth)
+	}
+
+	// Lists and maps are limited in length
+	long := make([]interface{}, maxValueItems+10)
+	wide := make(map[string]interface{})
+	for i := range long {
+		long[i] = i
+		wide[fmt.Sprintf("key%d", i)] = i
+	}
+	sanitized = sanitizeTemplateValues(map[string]interface{}{"long": long, "wide": wide})
+	if items := sanitized["long"].([]interface{}); len(items) != maxValueItems {
+		t.Errorf("Expected %d list items, got %d", maxValueItems, len(items))
+	}
+	if items := sanitized["wide"].(map[string]interface{}); len(items) != maxValueItems {
+		t.Errorf("Expected %d map items, got %d", maxValueItems, len(items))
+	}
+
+	// The total number of values is limited
+	many := make(map[string]interface{})
+	for i := 0; i < 20; i++ {
+		many[fmt.Sprintf("list%02d", i)] = long
+	}
+	sanitized = sanitizeTemplateValues(many)
+	total := 0
+	for _, value := range sanitized {
+		total += 1 + len(value.([]interface{}))
+	}
+	if total > maxValueNodes {
+		t.Errorf("Expected at most %d values, got %d", maxValueNodes, total)
+	}
+}